@@ -0,0 +1,352 @@
+// Copyright (C) 2019 WuPeng <wupeng364@outlook.com>.
+// Use of this source code is governed by an MIT-style.
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction,
+// including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software,
+// and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+// 配置文件编辑工具, 基于conftool按key路径读写JSON配置文件
+// 用法: confedit <command> [flags] <file> [args]
+// 退出码: 0 成功, 1 失败或diff有差异, 2 参数错误, 3 key不存在
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"gutils/conftool"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+)
+
+const (
+	exitOK       = 0
+	exitError    = 1
+	exitUsage    = 2
+	exitNotFound = 3
+)
+
+const usage = `Usage: confedit <command> [flags] <file> [args]
+
+Commands:
+  get <file> <key>                     print value of key
+  set [--int|--float|--bool|--json|--secret] <file> <key> <value>
+                                       set value of key, string by default
+  delete <file> <key>                  delete key
+  list [--reveal] <file>               list all key=value, sensitive values are hidden
+  validate <file>                      check that file is valid json
+  diff <file1> <file2>                 list changed keys between two files
+  rotate-key --key-file <path> <file>  re-encrypt all secrets with a new key
+
+Secrets are decrypted with the key from $` + conftool.SecretKeyEnv + ` or the file in $` + conftool.SecretKeyFileEnv + `.
+
+Exit codes: 0 ok, 1 error or files differ, 2 usage error, 3 key not found
+`
+
+// cmdError 带退出码的错误
+type cmdError struct {
+	code int
+	msg  string
+}
+
+func (err *cmdError) Error() string {
+	return err.msg
+}
+
+// stdout, stderr 命令的输出, 测试时替换
+var (
+	stdout io.Writer = os.Stdout
+	stderr io.Writer = os.Stderr
+)
+
+func main() {
+	os.Exit(run(os.Args[1:]))
+}
+
+// run 执行子命令, 返回退出码
+func run(args []string) int {
+	if len(args) < 1 {
+		fmt.Fprint(stderr, usage)
+		return exitUsage
+	}
+	commands := map[string]func(args []string) error{
+		"get":        cmdGet,
+		"set":        cmdSet,
+		"delete":     cmdDelete,
+		"list":       cmdList,
+		"validate":   cmdValidate,
+		"diff":       cmdDiff,
+		"rotate-key": cmdRotateKey,
+	}
+	command, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprint(stderr, usage)
+		return exitUsage
+	}
+	if err := command(args[1:]); nil != err {
+		fmt.Fprintln(stderr, "confedit:", err)
+		var cerr *cmdError
+		if errors.As(err, &cerr) {
+			return cerr.code
+		}
+		return exitError
+	}
+	return exitOK
+}
+
+// cmdGet 读取key, 对象和数组以json输出
+func cmdGet(args []string) error {
+	fs := newFlagSet("get")
+	if err := parseArgs(fs, args, 2); nil != err {
+		return err
+	}
+	cfg, err := openConfig(fs.Arg(0))
+	if nil != err {
+		return err
+	}
+	obj, ok, err := cfg.Lookup(fs.Arg(1))
+	if nil != err {
+		return err
+	}
+	if !ok {
+		return notFound(fs.Arg(1))
+	}
+	switch val := obj.O.(type) {
+	case string:
+		fmt.Fprintln(stdout, val)
+	case map[string]interface{}, []interface{}:
+		data, err := json.MarshalIndent(val, "", "  ")
+		if nil != err {
+			return err
+		}
+		fmt.Fprintln(stdout, string(data))
+	default:
+		data, _ := json.Marshal(val)
+		fmt.Fprintln(stdout, string(data))
+	}
+	return nil
+}
+
+// cmdSet 写入key, 一次写入整个文件
+func cmdSet(args []string) error {
+	fs := newFlagSet("set")
+	asInt := fs.Bool("int", false, "value is an integer")
+	asFloat := fs.Bool("float", false, "value is a number")
+	asBool := fs.Bool("bool", false, "value is a boolean")
+	asJSON := fs.Bool("json", false, "value is json")
+	asSecret := fs.Bool("secret", false, "encrypt value before saving")
+	if err := parseArgs(fs, args, 3); nil != err {
+		return err
+	}
+	key, raw := fs.Arg(1), fs.Arg(2)
+	var value interface{}
+	var err error
+	switch {
+	case *asInt:
+		value, err = strconv.ParseInt(raw, 10, 64)
+	case *asFloat:
+		value, err = strconv.ParseFloat(raw, 64)
+	case *asBool:
+		value, err = strconv.ParseBool(raw)
+	case *asJSON:
+		err = json.Unmarshal([]byte(raw), &value)
+	default:
+		value = raw
+	}
+	if nil != err {
+		return &cmdError{code: exitUsage, msg: "invalid value: " + err.Error()}
+	}
+	if !isFile(fs.Arg(0)) {
+		return errors.New("config file not exist: " + fs.Arg(0))
+	}
+	cfg, err := openConfig(fs.Arg(0))
+	if nil != err {
+		return err
+	}
+	if *asSecret {
+		return cfg.SetSecret(key, raw)
+	}
+	return cfg.Update(func(tx *conftool.Tx) error {
+		return tx.Set(key, value)
+	})
+}
+
+// cmdDelete 删除key
+func cmdDelete(args []string) error {
+	fs := newFlagSet("delete")
+	if err := parseArgs(fs, args, 2); nil != err {
+		return err
+	}
+	cfg, err := openConfig(fs.Arg(0))
+	if nil != err {
+		return err
+	}
+	return cfg.Update(func(tx *conftool.Tx) error {
+		if !tx.Has(fs.Arg(1)) {
+			return notFound(fs.Arg(1))
+		}
+		return tx.Delete(fs.Arg(1))
+	})
+}
+
+// cmdList 平铺输出所有配置
+func cmdList(args []string) error {
+	fs := newFlagSet("list")
+	reveal := fs.Bool("reveal", false, "do not hide values of sensitive keys, encrypted values are still hidden")
+	if err := parseArgs(fs, args, 1); nil != err {
+		return err
+	}
+	cfg, err := openConfig(fs.Arg(0))
+	if nil != err {
+		return err
+	}
+	opts := conftool.ExportOpts{}
+	if *reveal {
+		opts.Redact = []string{}
+	}
+	for _, kv := range cfg.Flatten(opts) {
+		fmt.Fprintln(stdout, kv.Key+"="+kv.Value)
+	}
+	return nil
+}
+
+// cmdValidate 检查文件是否是合法的json对象
+func cmdValidate(args []string) error {
+	fs := newFlagSet("validate")
+	if err := parseArgs(fs, args, 1); nil != err {
+		return err
+	}
+	data, err := ioutil.ReadFile(fs.Arg(0))
+	if nil != err {
+		return err
+	}
+	jsonObject := make(map[string]interface{})
+	if err = json.Unmarshal(data, &jsonObject); nil != err {
+		return errors.New(fs.Arg(0) + ": " + err.Error())
+	}
+	fmt.Fprintln(stdout, fs.Arg(0)+": ok")
+	return nil
+}
+
+// cmdDiff 对比两个配置文件, 敏感信息隐藏后输出
+func cmdDiff(args []string) error {
+	fs := newFlagSet("diff")
+	if err := parseArgs(fs, args, 2); nil != err {
+		return err
+	}
+	left, err := openConfig(fs.Arg(0))
+	if nil != err {
+		return err
+	}
+	right, err := openConfig(fs.Arg(1))
+	if nil != err {
+		return err
+	}
+	// 用原始值比较, 密文变化(如更换密钥)也是差异; 输出隐藏后的值
+	compare := conftool.ExportOpts{Raw: true}
+	leftValues, rightValues := toMap(left.Flatten(compare)), toMap(right.Flatten(compare))
+	leftShown, rightShown := toMap(left.Flatten(conftool.ExportOpts{})), toMap(right.Flatten(conftool.ExportOpts{}))
+	differ := false
+	for _, kv := range left.Flatten(compare) {
+		val, ok := rightValues[kv.Key]
+		if !ok {
+			fmt.Fprintln(stdout, "- "+kv.Key+"="+shownValue(leftShown, kv.Key))
+			differ = true
+		} else if val != kv.Value {
+			fmt.Fprintln(stdout, "~ "+kv.Key+"="+shownValue(leftShown, kv.Key)+" -> "+shownValue(rightShown, kv.Key))
+			differ = true
+		}
+	}
+	for _, kv := range right.Flatten(compare) {
+		if _, ok := leftValues[kv.Key]; !ok {
+			fmt.Fprintln(stdout, "+ "+kv.Key+"="+shownValue(rightShown, kv.Key))
+			differ = true
+		}
+	}
+	if differ {
+		return &cmdError{code: exitError, msg: "files differ"}
+	}
+	return nil
+}
+
+// cmdRotateKey 使用新密钥重新加密所有密文
+func cmdRotateKey(args []string) error {
+	fs := newFlagSet("rotate-key")
+	keyFile := fs.String("key-file", "", "file containing the new secret key")
+	if err := parseArgs(fs, args, 1); nil != err {
+		return err
+	}
+	if len(*keyFile) == 0 {
+		return &cmdError{code: exitUsage, msg: "--key-file is required"}
+	}
+	newKey, err := conftool.SecretKeyFromFile(*keyFile)
+	if nil != err {
+		return err
+	}
+	cfg, err := openConfig(fs.Arg(0))
+	if nil != err {
+		return err
+	}
+	return cfg.RotateSecretKey(newKey)
+}
+
+// newFlagSet 子命令参数
+func newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	return fs
+}
+
+// parseArgs 解析参数并检查位置参数的个数
+func parseArgs(fs *flag.FlagSet, args []string, nArg int) error {
+	if err := fs.Parse(args); nil != err {
+		return &cmdError{code: exitUsage, msg: err.Error()}
+	}
+	if fs.NArg() != nArg {
+		return &cmdError{code: exitUsage, msg: fs.Name() + ": expects " + strconv.Itoa(nArg) + " arguments, see confedit -h"}
+	}
+	return nil
+}
+
+// openConfig 打开已经存在的配置文件, 不存在时不创建
+func openConfig(path string) (*conftool.JSONCFG, error) {
+	if !isFile(path) {
+		return nil, errors.New("config file not exist: " + path)
+	}
+	cfg := &conftool.JSONCFG{}
+	return cfg, cfg.InitConfig(path)
+}
+
+// notFound key不存在的错误
+func notFound(key string) error {
+	return &cmdError{code: exitNotFound, msg: "key not found: " + key}
+}
+
+// toMap 平铺列表转为map
+func toMap(list []conftool.KeyValue) map[string]string {
+	res := make(map[string]string, len(list))
+	for _, kv := range list {
+		res[kv.Key] = kv.Value
+	}
+	return res
+}
+
+// shownValue 隐藏后的值, 上级key被整体隐藏时没有该key
+func shownValue(shown map[string]string, key string) string {
+	if val, ok := shown[key]; ok {
+		return val
+	}
+	return conftool.DefaultMask
+}
+
+// isFile 是否是文件
+func isFile(path string) bool {
+	st, err := os.Stat(path)
+	return nil == err && !st.IsDir()
+}
@@ -0,0 +1,164 @@
+// Copyright (C) 2019 WuPeng <wupeng364@outlook.com>.
+// Use of this source code is governed by an MIT-style.
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction,
+// including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software,
+// and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"bytes"
+	"gutils/conftool"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// runCmd 执行子命令, 返回退出码和输出
+func runCmd(args ...string) (int, string, string) {
+	out, errOut := new(bytes.Buffer), new(bytes.Buffer)
+	stdout, stderr = out, errOut
+	code := run(args)
+	return code, out.String(), errOut.String()
+}
+
+// mkConfig 创建配置文件
+func mkConfig(t *testing.T, name, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	if err := ioutil.WriteFile(path, []byte(content), 0666); nil != err {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// 测试读写和删除key, 以及各种错误的退出码
+func TestGetSetDelete(t *testing.T) {
+	file := mkConfig(t, "config.json", `{"server":{"host":"127.0.0.1","port":8080}}`)
+	if code, out, _ := runCmd("get", file, "server.host"); code != exitOK || out != "127.0.0.1\n" {
+		t.Fatal("读取字符串错误", code, out)
+	}
+	if code, out, _ := runCmd("get", file, "server.port"); code != exitOK || out != "8080\n" {
+		t.Fatal("读取数字错误", code, out)
+	}
+	if code, _, _ := runCmd("get", file, "server.missing"); code != exitNotFound {
+		t.Fatal("key不存在时退出码错误", code)
+	}
+	if code, _, _ := runCmd("get", file); code != exitUsage {
+		t.Fatal("参数个数错误时退出码错误", code)
+	}
+	if code, _, _ := runCmd("get", file+".missing", "server.host"); code != exitError {
+		t.Fatal("文件不存在时退出码错误", code)
+	}
+
+	if code, _, errOut := runCmd("set", "--int", file, "server.port", "9090"); code != exitOK {
+		t.Fatal("写入数字失败", code, errOut)
+	}
+	if code, _, _ := runCmd("set", "--bool", file, "server.debug", "yes"); code != exitUsage {
+		t.Fatal("值不合法时退出码错误", code)
+	}
+	if code, _, errOut := runCmd("set", "--json", file, "server.tags", `["a","b"]`); code != exitOK {
+		t.Fatal("写入json失败", code, errOut)
+	}
+	if code, out, _ := runCmd("get", file, "server.port"); code != exitOK || out != "9090\n" {
+		t.Fatal("写入后读取错误", code, out)
+	}
+	if code, out, _ := runCmd("get", file, "server.tags"); code != exitOK || !strings.Contains(out, `"b"`) {
+		t.Fatal("读取数组错误", code, out)
+	}
+
+	if code, _, _ := runCmd("delete", file, "server.tags"); code != exitOK {
+		t.Fatal("删除失败", code)
+	}
+	if code, _, _ := runCmd("delete", file, "server.tags"); code != exitNotFound {
+		t.Fatal("删除不存在的key时退出码错误", code)
+	}
+	if code, _, _ := runCmd("unknown", file); code != exitUsage {
+		t.Fatal("未知命令的退出码错误", code)
+	}
+	if code, _, _ := runCmd(); code != exitUsage {
+		t.Fatal("没有命令时退出码错误", code)
+	}
+}
+
+// 测试列出配置时隐藏敏感信息, 以及检查文件格式
+func TestListValidate(t *testing.T) {
+	t.Setenv(conftool.SecretKeyEnv, "key")
+	file := mkConfig(t, "config.json", `{"db":{"host":"localhost","password":"p@ss"}}`)
+	if code, _, errOut := runCmd("set", "--secret", file, "db.dsn", "root:p@ss@tcp"); code != exitOK {
+		t.Fatal("写入密文失败", code, errOut)
+	}
+	// 没有密钥时读取密文是错误, 不是不存在, 删除不需要密钥
+	t.Setenv(conftool.SecretKeyEnv, "")
+	if code, _, errOut := runCmd("get", file, "db.dsn"); code != exitError || !strings.Contains(errOut, "db.dsn") {
+		t.Fatal("无法解密时退出码错误", code, errOut)
+	}
+	if code, _, errOut := runCmd("delete", file, "db.dsn"); code != exitOK {
+		t.Fatal("没有密钥时删除密文失败", code, errOut)
+	}
+	t.Setenv(conftool.SecretKeyEnv, "key")
+	if code, _, errOut := runCmd("set", "--secret", file, "db.dsn", "root:p@ss@tcp"); code != exitOK {
+		t.Fatal("写入密文失败", code, errOut)
+	}
+	code, out, _ := runCmd("list", file)
+	if code != exitOK || strings.Contains(out, "p@ss") || !strings.Contains(out, "db.host=localhost\n") {
+		t.Fatal("列出配置错误", code, out)
+	}
+	code, out, _ = runCmd("list", "--reveal", file)
+	if code != exitOK || !strings.Contains(out, "db.password=p@ss\n") || !strings.Contains(out, "db.dsn="+conftool.DefaultMask+"\n") {
+		t.Fatal("--reveal错误, 密文仍应隐藏", code, out)
+	}
+
+	if code, out, _ := runCmd("validate", file); code != exitOK || !strings.HasSuffix(out, ": ok\n") {
+		t.Fatal("合法文件检查错误", code, out)
+	}
+	bad := mkConfig(t, "bad.json", `{"db":`)
+	if code, _, _ := runCmd("validate", bad); code != exitError {
+		t.Fatal("不合法文件的退出码错误", code)
+	}
+}
+
+// 测试对比配置文件, 密文变化也是差异, 输出时隐藏
+func TestDiff(t *testing.T) {
+	t.Setenv(conftool.SecretKeyEnv, "old-key")
+	left := mkConfig(t, "left.json", `{"app":{"name":"demo","token":"t1"}}`)
+	if code, _, errOut := runCmd("set", "--secret", left, "app.dsn", "root:p@ss@tcp"); code != exitOK {
+		t.Fatal("写入密文失败", code, errOut)
+	}
+	data, _ := ioutil.ReadFile(left)
+	right := mkConfig(t, "right.json", string(data))
+	if code, out, _ := runCmd("diff", left, right); code != exitOK || len(out) > 0 {
+		t.Fatal("相同文件不应有差异", code, out)
+	}
+
+	keyFile := mkConfig(t, "new.key", "new-key")
+	if code, _, errOut := runCmd("rotate-key", "--key-file", keyFile, right); code != exitOK {
+		t.Fatal("更换密钥失败", code, errOut)
+	}
+	code, out, _ := runCmd("diff", left, right)
+	if code != exitError || out != "~ app.dsn="+conftool.DefaultMask+" -> "+conftool.DefaultMask+"\n" {
+		t.Fatal("更换密钥后应有差异", code, out)
+	}
+
+	right = mkConfig(t, "changed.json", `{"app":{"name":"demo2","token":"t2","debug":true}}`)
+	code, out, _ = runCmd("diff", left, right)
+	for _, line := range []string{
+		"- app.dsn=" + conftool.DefaultMask,
+		"~ app.name=demo -> demo2",
+		"~ app.token=" + conftool.DefaultMask + " -> " + conftool.DefaultMask,
+		"+ app.debug=true",
+	} {
+		if !strings.Contains(out, line+"\n") {
+			t.Fatal("差异输出错误", code, out)
+		}
+	}
+	if code != exitError || strings.Contains(out, "t1") || strings.Contains(out, "t2") {
+		t.Fatal("差异输出错误", code, out)
+	}
+	if code, _, _ := runCmd("diff", left); code != exitUsage {
+		t.Fatal("参数个数错误时退出码错误", code)
+	}
+}
@@ -0,0 +1,338 @@
+// Copyright (C) 2019 WuPeng <wupeng364@outlook.com>.
+// Use of this source code is governed by an MIT-style.
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction,
+// including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software,
+// and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+// 配置工具-配置绑定到结构体
+// 字段名使用json标签, 没有标签时使用字段名, 匹配时不区分大小写
+// default:"值" 配置中不存在时使用的默认值, 切片用逗号分隔
+// required:"true" 配置和默认值都没有时报错
+// 结构体实现了 Validate() error 时, 解码后调用校验
+
+package conftool
+
+import (
+	"errors"
+	"fmt"
+	"gutils/types"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Validator 解码后的校验接口
+type Validator interface {
+	Validate() error
+}
+
+// Binding 绑定的配置, 配置变更时自动重新解码, 解码或校验失败时保留旧值
+type Binding struct {
+	jsoncfg *JSONCFG
+	key     string
+	typ     reflect.Type // 结构体类型
+	value   *atomic.Value
+	l       *sync.Mutex // 保证解码和替换按顺序进行, 后解码的值不会被先解码的覆盖
+	subID   uint64
+	onError func(err error)
+}
+
+// Bind 把key下的配置解码到结构体指针v
+func (jsoncfg *JSONCFG) Bind(key string, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return errors.New("bind target must be a non-nil pointer to struct")
+	}
+	res, err := jsoncfg.decodeConfig(key, rv.Elem().Type())
+	if nil != err {
+		return err
+	}
+	rv.Elem().Set(res.Elem())
+	return nil
+}
+
+// NewBinding 绑定key下的配置, v为结构体指针, 只用于确定类型
+// 配置变更后重新解码, 失败时调用onError并保留旧值
+func (jsoncfg *JSONCFG) NewBinding(key string, v interface{}, onError func(err error)) (*Binding, error) {
+	typ := reflect.TypeOf(v)
+	if nil == typ || typ.Kind() != reflect.Ptr || typ.Elem().Kind() != reflect.Struct {
+		return nil, errors.New("bind target must be a pointer to struct")
+	}
+	binding := &Binding{
+		jsoncfg: jsoncfg,
+		key:     key,
+		typ:     typ.Elem(),
+		value:   new(atomic.Value),
+		l:       new(sync.Mutex),
+		onError: onError,
+	}
+	// 先订阅再解码, 解码期间发生的变更也会重新解码
+	binding.subID = jsoncfg.Subscribe(key, func(string, types.Object, types.Object) {
+		binding.rebind()
+	})
+	binding.l.Lock()
+	res, err := jsoncfg.decodeConfig(key, binding.typ)
+	if nil == err {
+		binding.value.Store(res.Interface())
+	}
+	binding.l.Unlock()
+	if nil != err {
+		jsoncfg.Unsubscribe(binding.subID)
+		return nil, err
+	}
+	return binding, nil
+}
+
+// Get 获取最新解码的结构体指针, 返回的对象不可修改
+func (binding *Binding) Get() interface{} {
+	return binding.value.Load()
+}
+
+// Close 停止跟随配置变更
+func (binding *Binding) Close() {
+	binding.jsoncfg.Unsubscribe(binding.subID)
+}
+
+// rebind 重新解码, 成功后整体替换
+func (binding *Binding) rebind() {
+	binding.l.Lock()
+	defer binding.l.Unlock()
+	res, err := binding.jsoncfg.decodeConfig(binding.key, binding.typ)
+	if nil != err {
+		if nil != binding.onError {
+			binding.onError(err)
+		}
+		return
+	}
+	binding.value.Store(res.Interface())
+}
+
+// decodeConfig 解码key下的配置为typ类型的新对象, 返回指针
+func (jsoncfg *JSONCFG) decodeConfig(key string, typ reflect.Type) (reflect.Value, error) {
+	var src interface{}
+	if len(key) == 0 {
+		jsoncfg.l.RLock()
+		src = revealSecrets(deepCopy(jsoncfg.jsonObject), jsoncfg.secretKey)
+		jsoncfg.l.RUnlock()
+	} else {
+		src = deepCopy(jsoncfg.GetConfig(key).O)
+	}
+	res := reflect.New(typ)
+	if err := decodeValue(key, src, res.Elem()); nil != err {
+		return reflect.Value{}, err
+	}
+	if validator, ok := res.Interface().(Validator); ok {
+		if err := validator.Validate(); nil != err {
+			return reflect.Value{}, err
+		}
+	}
+	return res, nil
+}
+
+// durationType time.Duration使用字符串配置, 如: 10s
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// decodeValue 把json解析出来的值解码到dst, path用于错误信息
+func decodeValue(path string, src interface{}, dst reflect.Value) error {
+	if nil == src {
+		if dst.Kind() == reflect.Struct {
+			return decodeStruct(path, make(map[string]interface{}), dst)
+		}
+		return nil
+	}
+	if dst.Type() == durationType {
+		return decodeDuration(path, src, dst)
+	}
+	switch dst.Kind() {
+	case reflect.Ptr:
+		temp := reflect.New(dst.Type().Elem())
+		if err := decodeValue(path, src, temp.Elem()); nil != err {
+			return err
+		}
+		dst.Set(temp)
+	case reflect.Interface:
+		dst.Set(reflect.ValueOf(src))
+	case reflect.Struct:
+		temp, ok := src.(map[string]interface{})
+		if !ok {
+			return bindError(path, src, dst)
+		}
+		return decodeStruct(path, temp, dst)
+	case reflect.Map:
+		temp, ok := src.(map[string]interface{})
+		if !ok || dst.Type().Key().Kind() != reflect.String {
+			return bindError(path, src, dst)
+		}
+		res := reflect.MakeMapWithSize(dst.Type(), len(temp))
+		for key, val := range temp {
+			item := reflect.New(dst.Type().Elem()).Elem()
+			if err := decodeValue(joinKey(path, key), val, item); nil != err {
+				return err
+			}
+			res.SetMapIndex(reflect.ValueOf(key).Convert(dst.Type().Key()), item)
+		}
+		dst.Set(res)
+	case reflect.Slice:
+		var items []interface{}
+		switch src := src.(type) {
+		case []interface{}:
+			items = src
+		case string:
+			// 逗号分隔的字符串, 用于默认值
+			for _, item := range strings.Split(src, ",") {
+				if item = strings.TrimSpace(item); len(item) > 0 {
+					items = append(items, item)
+				}
+			}
+		default:
+			return bindError(path, src, dst)
+		}
+		res := reflect.MakeSlice(dst.Type(), len(items), len(items))
+		for i, item := range items {
+			if err := decodeValue(path+"["+strconv.Itoa(i)+"]", item, res.Index(i)); nil != err {
+				return err
+			}
+		}
+		dst.Set(res)
+	case reflect.String:
+		switch src := src.(type) {
+		case string:
+			dst.SetString(src)
+		case float64:
+			dst.SetString(strconv.FormatFloat(src, 'f', -1, 64))
+		case bool:
+			dst.SetString(strconv.FormatBool(src))
+		default:
+			return bindError(path, src, dst)
+		}
+	case reflect.Bool:
+		switch src := src.(type) {
+		case bool:
+			dst.SetBool(src)
+		case string:
+			res, err := strconv.ParseBool(src)
+			if nil != err {
+				return bindError(path, src, dst)
+			}
+			dst.SetBool(res)
+		default:
+			return bindError(path, src, dst)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		num, ok := toFloat(src)
+		if !ok || num != math.Trunc(num) || dst.OverflowInt(int64(num)) {
+			return bindError(path, src, dst)
+		}
+		dst.SetInt(int64(num))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		num, ok := toFloat(src)
+		if !ok || num < 0 || num != math.Trunc(num) || dst.OverflowUint(uint64(num)) {
+			return bindError(path, src, dst)
+		}
+		dst.SetUint(uint64(num))
+	case reflect.Float32, reflect.Float64:
+		num, ok := toFloat(src)
+		if !ok || dst.OverflowFloat(num) {
+			return bindError(path, src, dst)
+		}
+		dst.SetFloat(num)
+	default:
+		return errors.New(path + ": unsupported type " + dst.Type().String())
+	}
+	return nil
+}
+
+// decodeStruct 按字段解码, 处理默认值和必填项
+func decodeStruct(path string, src map[string]interface{}, dst reflect.Value) error {
+	typ := dst.Type()
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		if len(field.PkgPath) > 0 {
+			continue // 未导出字段
+		}
+		name := field.Name
+		if tag := strings.Split(field.Tag.Get("json"), ",")[0]; tag == "-" {
+			continue
+		} else if len(tag) > 0 {
+			name = tag
+		}
+		val, ok := src[name]
+		if !ok {
+			var err error
+			if val, ok, err = lookupFold(path, src, name); nil != err {
+				return err
+			}
+		}
+		if !ok || nil == val {
+			if def, hasDef := field.Tag.Lookup("default"); hasDef {
+				val = def
+			} else if field.Tag.Get("required") == "true" {
+				return errors.New(joinKey(path, name) + ": required")
+			}
+		}
+		if err := decodeValue(joinKey(path, name), val, dst.Field(i)); nil != err {
+			return err
+		}
+	}
+	return nil
+}
+
+// lookupFold 不区分大小写查找key, 有多个key只是大小写不同时无法确定使用哪个, 返回错误
+func lookupFold(path string, src map[string]interface{}, name string) (interface{}, bool, error) {
+	var keys []string
+	for key := range src {
+		if strings.EqualFold(key, name) {
+			keys = append(keys, key)
+		}
+	}
+	switch len(keys) {
+	case 0:
+		return nil, false, nil
+	case 1:
+		return src[keys[0]], true, nil
+	}
+	sort.Strings(keys)
+	return nil, false, errors.New(joinKey(path, name) + ": ambiguous keys " + strings.Join(keys, ", "))
+}
+
+// decodeDuration 解码time.Duration, 字符串使用time.ParseDuration, 数字为纳秒
+func decodeDuration(path string, src interface{}, dst reflect.Value) error {
+	switch temp := src.(type) {
+	case string:
+		res, err := time.ParseDuration(temp)
+		if nil != err {
+			return bindError(path, src, dst)
+		}
+		dst.SetInt(int64(res))
+	case float64:
+		dst.SetInt(int64(temp))
+	default:
+		return bindError(path, src, dst)
+	}
+	return nil
+}
+
+// toFloat 数字或数字字符串转为float64
+func toFloat(src interface{}) (float64, bool) {
+	switch src := src.(type) {
+	case float64:
+		return src, true
+	case string:
+		res, err := strconv.ParseFloat(strings.TrimSpace(src), 64)
+		return res, nil == err
+	}
+	return 0, false
+}
+
+// bindError 类型无法转换的错误
+func bindError(path string, src interface{}, dst reflect.Value) error {
+	return fmt.Errorf("%s: cannot bind %#v to %s", path, src, dst.Type())
+}
@@ -0,0 +1,165 @@
+// Copyright (C) 2019 WuPeng <wupeng364@outlook.com>.
+// Use of this source code is governed by an MIT-style.
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction,
+// including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software,
+// and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package conftool
+
+import (
+	"fmt"
+	"gutils/types"
+	"path/filepath"
+	"testing"
+)
+
+var (
+	_ Config = (*JSONCFG)(nil)
+	_ Config = (*MemoryCFG)(nil)
+	_ Config = (*ReadOnlyCFG)(nil)
+)
+
+// backends 可写的配置实现
+var backends = map[string]func(t *testing.T) Config{
+	"JSONCFG": func(t *testing.T) Config {
+		cfg := &JSONCFG{}
+		if err := cfg.InitConfig(filepath.Join(t.TempDir(), "config.json")); nil != err {
+			t.Fatal(err)
+		}
+		return cfg
+	},
+	"MemoryCFG": func(t *testing.T) Config {
+		cfg, err := NewMemoryCFG(nil)
+		if nil != err {
+			t.Fatal(err)
+		}
+		return cfg
+	},
+}
+
+// 所有可写的配置实现都需要通过的测试
+func TestConformance(t *testing.T) {
+	for name, newConfig := range backends {
+		t.Run(name, func(t *testing.T) {
+			testConformance(t, newConfig, func(cfg Config) Config { return cfg })
+		})
+	}
+}
+
+// 只读视图读取与原配置一致, 不能修改
+func TestReadOnly(t *testing.T) {
+	// 一致性测试中通过原配置写入, 读取和订阅使用只读视图
+	for name, newConfig := range backends {
+		t.Run(name, func(t *testing.T) {
+			testConformance(t, newConfig, func(cfg Config) Config { return NewReadOnly(cfg) })
+		})
+	}
+
+	cfg, err := NewMemoryCFG(map[string]interface{}{"a": map[string]interface{}{"b": "1"}})
+	if nil != err {
+		t.Fatal(err)
+	}
+	view := NewReadOnly(cfg)
+	if view.GetConfig("a.b").ToString("") != "1" {
+		t.Fatal("只读视图读取错误")
+	}
+	if view.SetConfig("a.b", "2") != ErrReadOnly || view.DeleteConfig("a.b") != ErrReadOnly ||
+		view.Update(func(tx *Tx) error { return tx.Set("a.b", "2") }) != ErrReadOnly {
+		t.Fatal("只读视图可以修改")
+	}
+	changed := 0
+	view.Subscribe("a", func(string, types.Object, types.Object) {
+		changed++
+	})
+	cfg.SetConfig("a.b", "2")
+	if view.GetConfig("a.b").ToString("") != "2" || changed != 1 {
+		t.Fatal("只读视图没有跟随原配置")
+	}
+}
+
+// testConformance 配置实现的一致性测试, 通过newConfig创建的配置写入, 通过view返回的配置读取和订阅
+func testConformance(t *testing.T, newConfig func(t *testing.T) Config, view func(cfg Config) Config) {
+	t.Run("GetMissing", func(t *testing.T) {
+		cfg := view(newConfig(t))
+		if nil != cfg.GetConfig("a.b").O || nil != cfg.GetConfig("").O {
+			t.Fatal("不存在的key返回了值")
+		}
+	})
+	t.Run("SetGet", func(t *testing.T) {
+		cfg := newConfig(t)
+		reader := view(cfg)
+		if nil == cfg.SetConfig("", "v") || nil == cfg.SetConfig("a", "") {
+			t.Fatal("空的key或value未报错")
+		}
+		if err := cfg.SetConfig("a.b.c", "v"); nil != err {
+			t.Fatal(err)
+		}
+		if reader.GetConfig("a.b.c").ToString("") != "v" || reader.GetConfig("a.b").ToStrMap(nil)["c"] != "v" {
+			t.Fatal("读取结果错误")
+		}
+		if nil == cfg.SetConfig("a.b.c.d", "v") {
+			t.Fatal("非对象节点下写入未报错")
+		}
+		if nil != reader.GetConfig("a.b.c.d").O {
+			t.Fatal("非对象节点下读取到了值")
+		}
+	})
+	t.Run("Delete", func(t *testing.T) {
+		cfg := newConfig(t)
+		cfg.SetConfig("a.b", "v")
+		cfg.SetConfig("a.c", "v")
+		if err := cfg.DeleteConfig("a.b"); nil != err {
+			t.Fatal(err)
+		}
+		if err := cfg.DeleteConfig("x.y"); nil != err {
+			t.Fatal("删除不存在的key报错:", err)
+		}
+		if reader := view(cfg); nil != reader.GetConfig("a.b").O || reader.GetConfig("a.c").ToString("") != "v" {
+			t.Fatal("删除结果错误")
+		}
+	})
+	t.Run("Update", func(t *testing.T) {
+		cfg := newConfig(t)
+		err := cfg.Update(func(tx *Tx) error {
+			tx.Set("n", 1)
+			tx.Set("list", []string{"a"})
+			return tx.Set("obj", map[string]interface{}{"k": true})
+		})
+		if nil != err {
+			t.Fatal(err)
+		}
+		// 值被转换为json解析后的类型
+		reader := view(cfg)
+		if reader.GetConfig("n").ToFloat64(0) != 1 || len(reader.GetConfig("list").O.([]interface{})) != 1 ||
+			!reader.GetConfig("obj.k").ToBool(false) {
+			t.Fatal("事务结果错误")
+		}
+		err = cfg.Update(func(tx *Tx) error {
+			tx.Set("n", 2)
+			return tx.Set("n.x", 1)
+		})
+		if nil == err || reader.GetConfig("n").ToFloat64(0) != 1 {
+			t.Fatal("事务失败后配置被修改")
+		}
+	})
+	t.Run("Subscribe", func(t *testing.T) {
+		cfg := newConfig(t)
+		reader := view(cfg)
+		changes := make([]string, 0)
+		id := reader.Subscribe("a", func(key string, oldVal, newVal types.Object) {
+			changes = append(changes, fmt.Sprint(key, "=", oldVal.O, ">", newVal.O))
+		})
+		cfg.SetConfig("a.b", "1")
+		cfg.SetConfig("x", "1")
+		cfg.SetConfig("a.b", "1")
+		cfg.DeleteConfig("a")
+		reader.Unsubscribe(id)
+		cfg.SetConfig("a.b", "2")
+		if len(changes) != 2 || changes[0] != "a=<nil>>map[b:1]" || changes[1] != "a=map[b:1]><nil>" {
+			t.Fatal("变更通知错误:", changes)
+		}
+	})
+}
@@ -10,3 +10,30 @@
 // 配置工具
 
 package conftool
+
+import (
+	"errors"
+	"gutils/types"
+)
+
+// Config 配置接口, JSONCFG、MemoryCFG、ReadOnlyCFG行为一致
+type Config interface {
+	// GetConfig 读取key的值, 不存在时为空
+	GetConfig(key string) types.Object
+	// SetConfig 保存配置, key value 都为stirng
+	SetConfig(key string, value string) error
+	// DeleteConfig 删除配置, key不存在时不做处理
+	DeleteConfig(key string) error
+	// Update 在事务中执行fn, fn返回nil则提交, 否则回滚
+	Update(fn func(tx *Tx) error) error
+	// Subscribe 订阅key路径的变更, 返回订阅ID
+	Subscribe(key string, callback ChangeCallback) uint64
+	// Unsubscribe 取消订阅
+	Unsubscribe(id uint64)
+}
+
+// ErrReadOnly 只读配置不能修改
+var ErrReadOnly = errors.New("config is read-only")
+
+// ErrNotSupported 当前平台不支持的操作
+var ErrNotSupported = errors.New("operation not supported on this platform")
@@ -0,0 +1,289 @@
+// Copyright (C) 2019 WuPeng <wupeng364@outlook.com>.
+// Use of this source code is governed by an MIT-style.
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction,
+// including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software,
+// and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+// 配置工具-配置导出
+// 支持json, yaml, env文件和key=value平铺格式, 导出前按key名称隐藏敏感信息
+// 加密的值无论是否匹配规则都会隐藏
+
+package conftool
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ExportFormat 导出格式
+type ExportFormat string
+
+const (
+	// FormatJSON 格式化的json
+	FormatJSON ExportFormat = "json"
+	// FormatYAML yaml
+	FormatYAML ExportFormat = "yaml"
+	// FormatEnv env文件, key路径转大写, '.'转为'_'
+	FormatEnv ExportFormat = "env"
+	// FormatFlat 平铺的 key.path=value 列表
+	FormatFlat ExportFormat = "flat"
+)
+
+// DefaultRedact 默认隐藏的key名称规则
+var DefaultRedact = []string{"*password*", "*passwd*", "*secret*", "*token*", "*credential*", "*apikey*", "*api_key*", "*privatekey*", "*private_key*"}
+
+// DefaultMask 默认用于替换敏感信息的文字
+const DefaultMask = "******"
+
+// ExportOpts 导出选项
+type ExportOpts struct {
+	// Redact 需要隐藏的key规则, 使用path.Match匹配, 不区分大小写, 匹配任意一级key名称或完整key路径
+	// 为nil时使用DefaultRedact, 为空切片时不按名称隐藏
+	Redact    []string
+	Mask      string // 替换敏感信息的文字, 默认DefaultMask
+	EnvPrefix string // env格式的变量名前缀
+	Raw       bool   // 不隐藏任何值, 加密的值输出密文, 用于比较配置, 不应直接展示
+}
+
+// KeyValue 平铺后的配置项
+type KeyValue struct {
+	Key   string
+	Value string
+}
+
+// Export 导出配置到w, 敏感信息按规则隐藏
+func (jsoncfg *JSONCFG) Export(w io.Writer, format ExportFormat, opts ExportOpts) error {
+	return ExportObject(w, jsoncfg.snapshot(), format, opts)
+}
+
+// Flatten 平铺所有配置项, 按key路径排序, 敏感信息按规则隐藏
+func (jsoncfg *JSONCFG) Flatten(opts ExportOpts) []KeyValue {
+	return FlattenObject(jsoncfg.snapshot(), opts)
+}
+
+// ExportObject 导出json对象到w, 敏感信息按规则隐藏
+func ExportObject(w io.Writer, jsonObject map[string]interface{}, format ExportFormat, opts ExportOpts) error {
+	redacted := redactObject("", jsonObject, opts)
+	buf := new(bytes.Buffer)
+	switch format {
+	case FormatJSON:
+		data, err := json.MarshalIndent(redacted, "", "  ")
+		if nil != err {
+			return err
+		}
+		buf.Write(data)
+		buf.WriteByte('\n')
+	case FormatYAML:
+		writeYAML(buf, redacted, 0)
+	case FormatEnv:
+		for _, kv := range flattenObject("", redacted) {
+			buf.WriteString(envName(opts.EnvPrefix, kv.Key) + "=" + envValue(kv.Value) + "\n")
+		}
+	case FormatFlat:
+		for _, kv := range flattenObject("", redacted) {
+			buf.WriteString(kv.Key + "=" + kv.Value + "\n")
+		}
+	default:
+		return errors.New("unsupported export format: " + string(format))
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// FlattenObject 平铺json对象, 按key路径排序, 敏感信息按规则隐藏
+// 数组作为一个值, 以json格式输出
+func FlattenObject(jsonObject map[string]interface{}, opts ExportOpts) []KeyValue {
+	return flattenObject("", redactObject("", jsonObject, opts))
+}
+
+// snapshot 复制当前配置, 加密的值保持密文
+func (jsoncfg *JSONCFG) snapshot() map[string]interface{} {
+	jsoncfg.l.RLock()
+	defer jsoncfg.l.RUnlock()
+	return deepCopy(jsoncfg.jsonObject).(map[string]interface{})
+}
+
+// redactObject 复制对象并隐藏敏感信息
+func redactObject(key string, val interface{}, opts ExportOpts) interface{} {
+	if opts.Raw {
+		return val
+	}
+	mask := opts.Mask
+	if len(mask) == 0 {
+		mask = DefaultMask
+	}
+	if len(key) > 0 && isRedacted(key, opts.Redact) {
+		return mask
+	}
+	switch val := val.(type) {
+	case map[string]interface{}:
+		res := make(map[string]interface{}, len(val))
+		for k, v := range val {
+			res[k] = redactObject(joinKey(key, k), v, opts)
+		}
+		return res
+	case []interface{}:
+		res := make([]interface{}, len(val))
+		for i, v := range val {
+			// 数组里的对象继续按key名称匹配
+			res[i] = redactObject(key, v, opts)
+		}
+		return res
+	case string:
+		if IsSecret(val) {
+			return mask
+		}
+	}
+	return val
+}
+
+// isRedacted key路径或其中任意一级名称是否匹配规则
+func isRedacted(key string, rules []string) bool {
+	if nil == rules {
+		rules = DefaultRedact
+	}
+	key = strings.ToLower(key)
+	names := strings.Split(key, ".")
+	for _, rule := range rules {
+		rule = strings.ToLower(rule)
+		if ok, _ := path.Match(rule, key); ok {
+			return true
+		}
+		if ok, _ := path.Match(rule, names[len(names)-1]); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// flattenObject 平铺对象
+func flattenObject(prefix string, val interface{}) []KeyValue {
+	res := make([]KeyValue, 0)
+	if temp, ok := val.(map[string]interface{}); ok {
+		for k, v := range temp {
+			res = append(res, flattenObject(joinKey(prefix, k), v)...)
+		}
+		sort.Slice(res, func(i, j int) bool {
+			return res[i].Key < res[j].Key
+		})
+		return res
+	}
+	return append(res, KeyValue{Key: prefix, Value: scalarString(val)})
+}
+
+// scalarString 值转为字符串, 数组和对象使用json
+func scalarString(val interface{}) string {
+	switch val := val.(type) {
+	case nil:
+		return ""
+	case string:
+		return val
+	case float64:
+		return strconv.FormatFloat(val, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(val)
+	}
+	data, _ := json.Marshal(val)
+	return string(data)
+}
+
+// envName key路径转为环境变量名
+func envName(prefix, key string) string {
+	name := []byte(strings.ToUpper(prefix + key))
+	for i, c := range name {
+		if !(c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_') {
+			name[i] = '_'
+		}
+	}
+	return string(name)
+}
+
+// envValue env文件中的值, 包含空白或特殊字符时加引号
+func envValue(val string) string {
+	if strings.ContainsAny(val, " \t\r\n#'\"\\$`") {
+		return strconv.Quote(val)
+	}
+	return val
+}
+
+// writeYAML 写入yaml, 对象的key按字母排序
+func writeYAML(buf *bytes.Buffer, val interface{}, indent int) {
+	space := strings.Repeat("  ", indent)
+	switch val := val.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(val))
+		for k := range val {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			buf.WriteString(space + yamlString(k) + ":")
+			writeYAMLChild(buf, val[k], indent)
+		}
+	case []interface{}:
+		for _, v := range val {
+			buf.WriteString(space + "-")
+			writeYAMLChild(buf, v, indent)
+		}
+	default:
+		buf.WriteString(space + yamlScalar(val) + "\n")
+	}
+}
+
+// writeYAMLChild 写入对象或数组的子项, 非空的对象和数组换行缩进
+func writeYAMLChild(buf *bytes.Buffer, val interface{}, indent int) {
+	switch temp := val.(type) {
+	case map[string]interface{}:
+		if len(temp) > 0 {
+			buf.WriteString("\n")
+			writeYAML(buf, temp, indent+1)
+			return
+		}
+	case []interface{}:
+		if len(temp) > 0 {
+			buf.WriteString("\n")
+			writeYAML(buf, temp, indent+1)
+			return
+		}
+	}
+	buf.WriteString(" " + yamlScalar(val) + "\n")
+}
+
+// yamlScalar 标量转为yaml
+func yamlScalar(val interface{}) string {
+	switch val := val.(type) {
+	case nil:
+		return "null"
+	case string:
+		return yamlString(val)
+	case map[string]interface{}:
+		return "{}"
+	case []interface{}:
+		return "[]"
+	}
+	return scalarString(val)
+}
+
+// yamlString 字符串转为yaml, 可能被误解析时使用双引号
+func yamlString(val string) string {
+	switch strings.ToLower(val) {
+	case "", "~", "null", "true", "false", "yes", "no", "on", "off", "y", "n":
+		return strconv.Quote(val)
+	}
+	if _, err := strconv.ParseFloat(val, 64); nil == err {
+		return strconv.Quote(val)
+	}
+	if strings.ContainsAny(val, ":#{}[],&*?|<>=!%@`'\"\\\n\r\t") || strings.TrimSpace(val) != val || strings.HasPrefix(val, "-") {
+		return strconv.Quote(val)
+	}
+	return val
+}
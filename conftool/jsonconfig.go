@@ -17,6 +17,7 @@ import (
 	"errors"
 	"gutils/types"
 	"os"
+	"strconv"
 	"strings"
 	"sync"
 )
@@ -26,6 +27,15 @@ type JSONCFG struct {
 	jsonObject map[string]interface{}
 	configPath string
 	l          *sync.RWMutex
+	revision   uint64                // 内存中配置的版本, 每次替换jsonObject时加1, 由l保护
+	tl         *sync.Mutex           // 事务锁, 同一配置同时只有一个事务, 在文件锁和l之前获取
+	subs       map[uint64]subscriber // 配置变更订阅
+	subSeq     uint64                // 订阅ID序号
+	sl         *sync.RWMutex         // 对subs对象的读写锁
+	watcher    *cfgwatcher           // 文件监听
+	wl         *sync.Mutex           // 对watcher对象的锁
+	secretKey  []byte                // 加密配置项的密钥
+	migrations []Migration           // 结构迁移, InitConfig时执行
 }
 
 // InitConfig 初始化解析器
@@ -34,71 +44,80 @@ func (jsoncfg *JSONCFG) InitConfig(configPath string) error {
 		return errors.New("config file path is empty")
 	}
 	jsoncfg.configPath = configPath
-	// 文件不存在则创建
+	// 文件不存在则创建, 加锁避免多个进程同时创建
 	if !isFile(jsoncfg.configPath) {
-		err := writeFileAsJSON(jsoncfg.configPath, make(map[string]interface{}))
+		lock, err := lockFile(jsoncfg.configPath, true)
+		if nil != err {
+			return err
+		}
+		if !isFile(jsoncfg.configPath) {
+			err = writeFileAsJSON(jsoncfg.configPath, make(map[string]interface{}))
+		}
+		lock.unlock()
 		if nil != err {
 			return err
 		}
 	}
 
-	jsoncfg.l = new(sync.RWMutex)
+	if err := jsoncfg.initState(); nil != err {
+		return err
+	}
 	jsoncfg.l.Lock()
-	defer jsoncfg.l.Unlock()
 	// Json to map
 	jsoncfg.jsonObject = make(map[string]interface{})
-	return readFileAsJSON(jsoncfg.configPath, &jsoncfg.jsonObject)
+	err := readFileAsJSON(jsoncfg.configPath, &jsoncfg.jsonObject)
+	jsoncfg.l.Unlock()
+	if nil != err {
+		return err
+	}
+	// 执行未完成的结构迁移
+	return jsoncfg.migrate()
+}
+
+// initState 初始化锁和订阅表, 读取环境变量中的密钥
+func (jsoncfg *JSONCFG) initState() error {
+	jsoncfg.l = new(sync.RWMutex)
+	jsoncfg.tl = new(sync.Mutex)
+	jsoncfg.sl = new(sync.RWMutex)
+	jsoncfg.wl = new(sync.Mutex)
+	jsoncfg.subs = make(map[uint64]subscriber)
+	return jsoncfg.loadSecretKeyFromEnv()
 }
 
 // GetConfig 读取key的value信息
 // 返回ConfigBody对象, 里面的值可能是string或者map
+// 加密的值会自动解密, 无法解密时为空
 func (jsoncfg *JSONCFG) GetConfig(key string) (res types.Object) {
 	jsoncfg.l.RLock()
 	defer jsoncfg.l.RUnlock()
 	if len(key) == 0 || jsoncfg.jsonObject == nil || len(jsoncfg.jsonObject) == 0 {
 		return
 	}
-	keys := strings.Split(key, ".")
-	if keys == nil {
-		return
+	if tp, ok := getPath(jsoncfg.jsonObject, strings.Split(key, ".")); ok {
+		res = types.Object{O: revealSecrets(tp, jsoncfg.secretKey)}
 	}
-	var temp interface{}
-	keyLength := len(keys)
-	for i := 0; i < keyLength; i++ {
-		// last key
-		if i == keyLength-1 {
-			if i == 0 {
-				if tp, ok := jsoncfg.jsonObject[keys[i]]; ok {
-					res = types.Object{O: tp}
-				}
-			} else if temp != nil {
-				if tp, ok := temp.(map[string]interface{})[keys[i]]; ok {
-					res = types.Object{O: tp}
-				}
-			}
-			return
-		}
-
-		//
-		var _temp interface{}
-		if temp == nil { // first
-			if tp, ok := jsoncfg.jsonObject[keys[i]]; ok {
-				_temp = tp
-			}
-		} else { //
-			if tp, ok := temp.(map[string]interface{})[keys[i]]; ok {
-				_temp = tp
-			}
-		}
+	return
+}
 
-		// find
-		if _temp != nil {
-			temp = _temp
-		} else {
-			return
-		}
+// Lookup 读取key的值, 加密的值会自动解密, 返回key是否存在
+// 与GetConfig不同, 没有密钥或解密失败时返回错误, 不会当作不存在
+func (jsoncfg *JSONCFG) Lookup(key string) (types.Object, bool, error) {
+	jsoncfg.l.RLock()
+	defer jsoncfg.l.RUnlock()
+	if len(key) == 0 {
+		return types.Object{}, false, nil
 	}
-	return
+	tp, ok := getPath(jsoncfg.jsonObject, strings.Split(key, "."))
+	if !ok {
+		return types.Object{}, false, nil
+	}
+	res, err := mapSecrets(deepCopy(tp), func(value string) (string, error) {
+		return DecryptSecret(jsoncfg.secretKey, value)
+	})
+	if nil != err {
+		return types.Object{}, true, errors.New("decrypt " + key + ": " + err.Error())
+	}
+	return types.Object{O: res}, true, nil
 }
 
 // SetConfig 保存配置, key value 都为stirng
@@ -106,50 +125,94 @@ func (jsoncfg *JSONCFG) SetConfig(key string, value string) error {
 	if len(key) == 0 || len(value) == 0 {
 		return errors.New("key or value is empty")
 	}
-	jsoncfg.l.Lock()
-	defer jsoncfg.l.Unlock()
-	keys := strings.Split(key, ".")
-	keyLength := len(keys)
-	var temp interface{}
-	for i := 0; i < keyLength; i++ {
-		// last key
-		if i == keyLength-1 {
-			if i == 0 {
-				jsoncfg.jsonObject[keys[i]] = value
-			} else if temp != nil {
-				temp.(map[string]interface{})[keys[i]] = value
-			}
-			// fmt.Println( jsoncfg.jsonObject )
-			err := writeFileAsJSON(jsoncfg.configPath, jsoncfg.jsonObject)
-			return err
-		}
+	return jsoncfg.Update(func(tx *Tx) error {
+		return tx.Set(key, value)
+	})
+}
 
-		//
-		var _temp interface{}
-		if temp == nil { // first
-			if tp, ok := jsoncfg.jsonObject[keys[i]]; ok {
-				_temp = tp
-			} else {
-				_temp = make(map[string]interface{})
-				jsoncfg.jsonObject[keys[i]] = _temp
-			}
-		} else { //
-			if tp, ok := temp.(map[string]interface{})[keys[i]]; ok {
-				_temp = tp
-			} else {
-				_temp = make(map[string]interface{})
-				temp.(map[string]interface{})[keys[i]] = _temp
-			}
+// DeleteConfig 删除配置, key不存在时不做处理
+func (jsoncfg *JSONCFG) DeleteConfig(key string) error {
+	if len(key) == 0 {
+		return errors.New("key is empty")
+	}
+	return jsoncfg.Update(func(tx *Tx) error {
+		return tx.Delete(key)
+	})
+}
+
+// getPath 按keys路径读取值
+func getPath(obj interface{}, keys []string) (interface{}, bool) {
+	for _, key := range keys {
+		temp, ok := obj.(map[string]interface{})
+		if !ok {
+			return nil, false
 		}
+		if obj, ok = temp[key]; !ok {
+			return nil, false
+		}
+	}
+	return obj, true
+}
 
-		// find
-		if _temp != nil {
-			temp = _temp
+// setPath 按keys路径写入值, 中间节点不存在则创建
+func setPath(obj map[string]interface{}, keys []string, value interface{}) error {
+	for i := 0; i < len(keys)-1; i++ {
+		temp, ok := obj[keys[i]]
+		if !ok {
+			_temp := make(map[string]interface{})
+			obj[keys[i]] = _temp
+			obj = _temp
+			continue
+		}
+		if obj, ok = temp.(map[string]interface{}); !ok {
+			return errors.New("config node is not an object: " + strings.Join(keys[:i+1], "."))
 		}
 	}
+	obj[keys[len(keys)-1]] = value
 	return nil
 }
 
+// deletePath 按keys路径删除值, 返回是否存在
+func deletePath(obj map[string]interface{}, keys []string) bool {
+	parent, ok := getPath(obj, keys[:len(keys)-1])
+	if !ok {
+		return false
+	}
+	temp, ok := parent.(map[string]interface{})
+	if !ok {
+		return false
+	}
+	if _, ok = temp[keys[len(keys)-1]]; !ok {
+		return false
+	}
+	delete(temp, keys[len(keys)-1])
+	return true
+}
+
+// deepCopy 复制json对象, 只处理json解析出来的类型
+func deepCopy(obj interface{}) interface{} {
+	switch obj := obj.(type) {
+	case map[string]interface{}:
+		res := make(map[string]interface{}, len(obj))
+		for key, val := range obj {
+			res[key] = deepCopy(val)
+		}
+		return res
+	case []interface{}:
+		res := make([]interface{}, len(obj))
+		for i, val := range obj {
+			res[i] = deepCopy(val)
+		}
+		return res
+	}
+	return obj
+}
+
+// fileLock 跨进程的文件锁, 保护配置文件的读-改-写
+type fileLock struct {
+	fp *os.File
+}
+
 // readFileAsJSON 读取Json文件
 func readFileAsJSON(path string, v interface{}) error {
 	if len(path) == 0 {
@@ -178,25 +241,37 @@ func readFileAsJSON(path string, v interface{}) error {
 }
 
 // writeFileAsJSON 写入Json文件
+// 先写入同目录下的临时文件再重命名, 避免文件只写入一半
 func writeFileAsJSON(path string, v interface{}) error {
 	if len(path) == 0 {
 		return pathNotExist("WriteFileAsJSON", path)
 	}
-	fp, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0666)
-	defer func() {
-		if nil != fp {
-			fp.Close()
-		}
-	}()
-
-	if err == nil {
-		data, err := json.Marshal(v)
-		if err == nil {
-			_, err := fp.Write(data)
-			return err
-		}
+	data, err := json.Marshal(v)
+	if nil != err {
+		return err
+	}
+	tempPath := path + ".tmp" + strconv.Itoa(os.Getpid())
+	fp, err := os.OpenFile(tempPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0666)
+	if nil != err {
 		return err
 	}
+	_, err = fp.Write(data)
+	if nil == err {
+		err = fp.Sync()
+	}
+	if closeErr := fp.Close(); nil == err {
+		err = closeErr
+	}
+	// 保持原文件的权限
+	if st, stErr := os.Stat(path); nil == err && nil == stErr {
+		err = os.Chmod(tempPath, st.Mode().Perm())
+	}
+	if nil == err {
+		err = os.Rename(tempPath, path)
+	}
+	if nil != err {
+		os.Remove(tempPath)
+	}
 	return err
 }
 
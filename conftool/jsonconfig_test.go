@@ -0,0 +1,435 @@
+// Copyright (C) 2019 WuPeng <wupeng364@outlook.com>.
+// Use of this source code is governed by an MIT-style.
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction,
+// including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software,
+// and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package conftool
+
+import (
+	"bytes"
+	"gutils/types"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// 测试文件变化后热加载并通知订阅者
+func TestWatch(t *testing.T) {
+	cfgPath := filepath.Join(t.TempDir(), "config.json")
+	if err := ioutil.WriteFile(cfgPath, []byte(`{"database":{"host":"127.0.0.1","port":"3306"}}`), 0666); nil != err {
+		t.Fatal(err)
+	}
+	cfg := &JSONCFG{}
+	if err := cfg.InitConfig(cfgPath); nil != err {
+		t.Fatal(err)
+	}
+	changed := make(chan string, 10)
+	cfg.Subscribe("database", func(key string, oldVal, newVal types.Object) {
+		changed <- key + "=" + oldVal.ToString("") + ">" + newVal.ToString("")
+	})
+	loadErr := make(chan error, 10)
+	err := cfg.Watch(WatchOpts{
+		Interval: 10 * time.Millisecond,
+		Polling:  true,
+		OnError: func(err error) {
+			loadErr <- err
+		},
+	})
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer cfg.StopWatch()
+
+	// 修改文件, 只有host变化
+	if err = ioutil.WriteFile(cfgPath, []byte(`{"database":{"host":"10.0.0.1","port":"3306"}}`), 0666); nil != err {
+		t.Fatal(err)
+	}
+	select {
+	case res := <-changed:
+		if res != "database.host=127.0.0.1>10.0.0.1" {
+			t.Fatal("unexpected change:", res)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("配置变更未通知")
+	}
+	if cfg.GetConfig("database.host").ToString("") != "10.0.0.1" {
+		t.Fatal("配置未重新加载")
+	}
+
+	// 写入错误的json, 保留旧配置
+	if err = ioutil.WriteFile(cfgPath, []byte(`{"database":`), 0666); nil != err {
+		t.Fatal(err)
+	}
+	select {
+	case <-loadErr:
+	case <-time.After(5 * time.Second):
+		t.Fatal("错误的配置未报告")
+	}
+	if cfg.GetConfig("database.host").ToString("") != "10.0.0.1" {
+		t.Fatal("错误的配置替换了旧配置")
+	}
+	if len(changed) > 0 {
+		t.Fatal("错误的配置触发了变更通知")
+	}
+}
+
+// 测试重新加载期间配置被事务修改时, 不会用读到的旧内容覆盖
+func TestReloadStale(t *testing.T) {
+	cfgPath := filepath.Join(t.TempDir(), "config.json")
+	cfg := &JSONCFG{}
+	if err := cfg.InitConfig(cfgPath); nil != err {
+		t.Fatal(err)
+	}
+	validated := 0
+	err := cfg.Watch(WatchOpts{
+		Interval: time.Hour,
+		Polling:  true,
+		Validate: func(jsonObject map[string]interface{}) error {
+			// 读取之后、替换之前提交一个事务
+			if validated++; validated == 1 {
+				return cfg.Update(func(tx *Tx) error {
+					return tx.Set("b", 2)
+				})
+			}
+			return nil
+		},
+	})
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer cfg.StopWatch()
+	if err = ioutil.WriteFile(cfgPath, []byte(`{"a":1}`), 0666); nil != err {
+		t.Fatal(err)
+	}
+	if err = cfg.Reload(); nil != err {
+		t.Fatal(err)
+	}
+	if cfg.GetConfig("a").ToFloat64(0) != 1 || cfg.GetConfig("b").ToFloat64(0) != 2 {
+		t.Fatal("旧内容覆盖了事务的修改", cfg.GetConfig("").O)
+	}
+	// 没有并发修改时正常替换
+	if err = ioutil.WriteFile(cfgPath, []byte(`{"a":3}`), 0666); nil != err {
+		t.Fatal(err)
+	}
+	if err = cfg.Reload(); nil != err || cfg.GetConfig("a").ToFloat64(0) != 3 || nil != cfg.GetConfig("b").O {
+		t.Fatal("重新加载失败", err)
+	}
+}
+
+// 测试事务一次性提交, 回滚不修改配置
+func TestUpdate(t *testing.T) {
+	cfgPath := filepath.Join(t.TempDir(), "config.json")
+	cfg := &JSONCFG{}
+	if err := cfg.InitConfig(cfgPath); nil != err {
+		t.Fatal(err)
+	}
+	err := cfg.Update(func(tx *Tx) error {
+		if err := tx.Set("module.SetupVer", "1.00"); nil != err {
+			return err
+		}
+		if tx.Get("module.SetupVer").ToString("") != "1.00" {
+			t.Fatal("事务内读取不到未提交的修改")
+		}
+		return tx.Set("module.SetupDate", "1")
+	})
+	if nil != err {
+		t.Fatal(err)
+	}
+	onDisk := make(map[string]interface{})
+	if err = readFileAsJSON(cfgPath, &onDisk); nil != err {
+		t.Fatal(err)
+	}
+	if v, _ := getPath(onDisk, []string{"module", "SetupDate"}); v != "1" {
+		t.Fatal("事务未写入文件", onDisk)
+	}
+
+	// 出错回滚
+	tx := cfg.Begin()
+	tx.Set("module.SetupVer", "2.00")
+	if err = tx.Set("module.SetupVer.sub", "x"); nil == err {
+		t.Fatal("非对象节点下写入未报错")
+	}
+	tx.Rollback()
+	if nil == tx.Commit() || cfg.GetConfig("module.SetupVer").ToString("") != "1.00" {
+		t.Fatal("回滚后配置被修改")
+	}
+}
+
+// 测试多个实例(模拟多个进程)同时写入同一个文件不丢失修改
+func TestConcurrentWriters(t *testing.T) {
+	cfgPath := filepath.Join(t.TempDir(), "config.json")
+	count := 4
+	cfgs := make([]*JSONCFG, count)
+	for i := 0; i < count; i++ {
+		cfgs[i] = &JSONCFG{}
+		if err := cfgs[i].InitConfig(cfgPath); nil != err {
+			t.Fatal(err)
+		}
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < count; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				if err := cfgs[i].SetConfig("writer"+strconv.Itoa(i)+".key"+strconv.Itoa(j), "v"); nil != err {
+					t.Error(err)
+					return
+				}
+				// 事务内读-改-写, 读到的应是其他实例提交后的值
+				err := cfgs[i].Update(func(tx *Tx) error {
+					return tx.Set("counter", tx.Get("counter").ToFloat64(0)+1)
+				})
+				if nil != err {
+					t.Error(err)
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	onDisk := &JSONCFG{}
+	if err := onDisk.InitConfig(cfgPath); nil != err {
+		t.Fatal(err)
+	}
+	for i := 0; i < count; i++ {
+		for j := 0; j < 20; j++ {
+			key := "writer" + strconv.Itoa(i) + ".key" + strconv.Itoa(j)
+			if onDisk.GetConfig(key).ToString("") != "v" {
+				t.Fatal("修改丢失:", key)
+			}
+		}
+	}
+	if counter := onDisk.GetConfig("counter").ToFloat64(0); counter != float64(count*20) {
+		t.Fatal("事务内的读-改-写覆盖了其他实例的修改:", counter)
+	}
+}
+
+// 测试加密配置项的读写和更换密钥
+func TestSecret(t *testing.T) {
+	cfgPath := filepath.Join(t.TempDir(), "config.json")
+	cfg := &JSONCFG{}
+	if err := cfg.InitConfig(cfgPath); nil != err {
+		t.Fatal(err)
+	}
+	if nil == cfg.SetSecret("database.password", "p@ss") {
+		t.Fatal("没有密钥时加密未报错")
+	}
+	cfg.SetSecretKey([]byte("old-key"))
+	if err := cfg.SetSecret("database.password", "p@ss"); nil != err {
+		t.Fatal(err)
+	}
+	data, _ := ioutil.ReadFile(cfgPath)
+	if strings.Contains(string(data), "p@ss") || !strings.Contains(string(data), "ENC(") {
+		t.Fatal("配置文件中保存了明文:", string(data))
+	}
+	if cfg.GetConfig("database.password").ToString("") != "p@ss" {
+		t.Fatal("读取时未解密")
+	}
+	if cfg.GetConfig("database").ToStrMap(nil)["password"] != "p@ss" {
+		t.Fatal("读取对象时未解密")
+	}
+
+	if err := cfg.RotateSecretKey([]byte("new-key")); nil != err {
+		t.Fatal(err)
+	}
+	other := &JSONCFG{}
+	if err := other.InitConfig(cfgPath); nil != err {
+		t.Fatal(err)
+	}
+	other.SetSecretKey([]byte("old-key"))
+	if other.GetConfig("database.password").ToString("") != "" {
+		t.Fatal("旧密钥仍然可以解密")
+	}
+	// 无法解密与不存在要区分开
+	if _, ok, err := other.Lookup("database.password"); !ok || nil == err {
+		t.Fatal("无法解密时应返回错误", ok, err)
+	}
+	if _, ok, err := other.Lookup("database.missing"); ok || nil != err {
+		t.Fatal("不存在的key错误", ok, err)
+	}
+	if err := other.Update(func(tx *Tx) error {
+		if !tx.Has("database.password") || tx.Has("database.missing") {
+			t.Fatal("事务中判断key是否存在错误")
+		}
+		return nil
+	}); nil != err {
+		t.Fatal(err)
+	}
+	other.SetSecretKey([]byte("new-key"))
+	if other.GetConfig("database.password").ToString("") != "p@ss" {
+		t.Fatal("新密钥无法解密")
+	}
+	if obj, ok, err := other.Lookup("database"); !ok || nil != err || obj.ToStrMap(nil)["password"] != "p@ss" {
+		t.Fatal("Lookup未解密", obj, err)
+	}
+}
+
+// 测试绑定结构体, 默认值, 必填项和配置变更后重新绑定
+func TestBind(t *testing.T) {
+	type dbConfig struct {
+		Host    string        `json:"host" required:"true"`
+		Port    int           `json:"port" default:"3306"`
+		Debug   bool          `json:"debug"`
+		Timeout time.Duration `json:"timeout" default:"5s"`
+		Tags    []string      `json:"tags" default:"a,b"`
+	}
+	cfgPath := filepath.Join(t.TempDir(), "config.json")
+	cfg := &JSONCFG{}
+	if err := cfg.InitConfig(cfgPath); nil != err {
+		t.Fatal(err)
+	}
+	db := dbConfig{}
+	if err := cfg.Bind("database", &db); nil == err {
+		t.Fatal("缺少必填项未报错")
+	}
+	cfg.SetConfig("database.host", "127.0.0.1")
+	cfg.SetConfig("database.debug", "true")
+	if err := cfg.Bind("database", &db); nil != err {
+		t.Fatal(err)
+	}
+	if db.Host != "127.0.0.1" || db.Port != 3306 || !db.Debug || db.Timeout != 5*time.Second || len(db.Tags) != 2 {
+		t.Fatalf("绑定结果错误: %+v", db)
+	}
+
+	binding, err := cfg.NewBinding("database", &dbConfig{}, nil)
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer binding.Close()
+	cfg.SetConfig("database.port", "5432")
+	if binding.Get().(*dbConfig).Port != 5432 {
+		t.Fatal("配置变更后未重新绑定")
+	}
+	// 转换失败时保留旧值
+	cfg.SetConfig("database.port", "x")
+	if binding.Get().(*dbConfig).Port != 5432 {
+		t.Fatal("绑定失败时替换了旧值")
+	}
+
+	// 大小写不同的key只有一个时可以匹配, 多个时报错
+	cfg.SetConfig("other.HOST", "10.0.0.1")
+	if err = cfg.Bind("other", &db); nil != err || db.Host != "10.0.0.1" {
+		t.Fatal("不区分大小写匹配失败", err, db.Host)
+	}
+	cfg.SetConfig("other.Host", "10.0.0.2")
+	for i := 0; i < 10; i++ {
+		if err = cfg.Bind("other", &db); nil == err || !strings.Contains(err.Error(), "HOST, Host") {
+			t.Fatal("多个大小写不同的key应报错", err)
+		}
+	}
+	// 首次解码失败时取消订阅
+	subs := len(cfg.subs)
+	if _, err = cfg.NewBinding("other", &dbConfig{}, nil); nil == err || len(cfg.subs) != subs {
+		t.Fatal("绑定失败时应取消订阅", err, len(cfg.subs))
+	}
+}
+
+// 测试结构迁移按版本执行并备份原文件
+func TestMigration(t *testing.T) {
+	cfgPath := filepath.Join(t.TempDir(), "config.json")
+	if err := ioutil.WriteFile(cfgPath, []byte(`{"db":{"hostname":"127.0.0.1","port":"3306"}}`), 0666); nil != err {
+		t.Fatal(err)
+	}
+	migrations := []Migration{
+		{Version: 2, Description: "端口改为数字", Migrate: ChangeType("database.port", func(val interface{}) (interface{}, error) {
+			return strconv.Atoi(val.(string))
+		})},
+		{Version: 1, Description: "调整数据库配置", Migrate: Chain(
+			MoveKey("db", "database"),
+			RenameKey("database.hostname", "host"),
+			SetDefault("database.timeout", "5s"),
+		)},
+	}
+	cfg := &JSONCFG{}
+	cfg.AddMigrations(migrations...)
+	if err := cfg.InitConfig(cfgPath); nil != err {
+		t.Fatal(err)
+	}
+	if cfg.SchemaVersion() != 2 || cfg.GetConfig("database.host").ToString("") != "127.0.0.1" ||
+		cfg.GetConfig("database.port").ToFloat64(0) != 3306 || cfg.GetConfig("database.timeout").ToString("") != "5s" {
+		t.Fatal("迁移结果错误:", cfg.GetConfig("database").O)
+	}
+	if _, err := os.Stat(cfgPath + ".v0.bak"); nil != err {
+		t.Fatal("迁移前未备份:", err)
+	}
+	// 已经迁移过的不再执行
+	again := &JSONCFG{}
+	again.AddMigrations(migrations...)
+	if err := again.InitConfig(cfgPath); nil != err {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(cfgPath + ".v2.bak"); nil == err {
+		t.Fatal("没有迁移时不需要备份")
+	}
+
+	// 多个实例(模拟多个进程)同时启动, 迁移只执行一次
+	if err := ioutil.WriteFile(cfgPath, []byte(`{"db":{"count":0}}`), 0666); nil != err {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			cfg := &JSONCFG{}
+			cfg.AddMigrations(Migration{Version: 1, Migrate: Chain(
+				ChangeType("db.count", func(val interface{}) (interface{}, error) {
+					return val.(float64) + 1, nil
+				}),
+				MoveKey("db", "database"),
+			)})
+			if err := cfg.InitConfig(cfgPath); nil != err {
+				t.Error(err)
+			} else if cfg.SchemaVersion() != 1 || cfg.GetConfig("database.count").ToFloat64(-1) != 1 {
+				t.Error("其他实例完成迁移后未读取最新配置:", cfg.GetConfig("database").O)
+			}
+		}()
+	}
+	wg.Wait()
+	onDisk := &JSONCFG{}
+	if err := onDisk.InitConfig(cfgPath); nil != err {
+		t.Fatal(err)
+	}
+	if onDisk.GetConfig("database.count").ToFloat64(-1) != 1 || nil != onDisk.GetConfig("db").O {
+		t.Fatal("迁移重复执行:", onDisk.GetConfig("database").O, onDisk.GetConfig("db").O)
+	}
+}
+
+// 测试导出时隐藏敏感信息
+func TestExport(t *testing.T) {
+	cfgPath := filepath.Join(t.TempDir(), "config.json")
+	cfg := &JSONCFG{}
+	if err := cfg.InitConfig(cfgPath); nil != err {
+		t.Fatal(err)
+	}
+	cfg.SetSecretKey([]byte("key"))
+	cfg.SetConfig("database.host", "127.0.0.1")
+	cfg.SetConfig("database.password", "p@ss")
+	cfg.SetSecret("database.dsn", "root:p@ss@tcp")
+	for _, format := range []ExportFormat{FormatJSON, FormatYAML, FormatEnv, FormatFlat} {
+		buf := new(bytes.Buffer)
+		if err := cfg.Export(buf, format, ExportOpts{}); nil != err {
+			t.Fatal(err)
+		}
+		if strings.Contains(buf.String(), "p@ss") || !strings.Contains(buf.String(), "127.0.0.1") {
+			t.Fatal(format, "导出结果错误:", buf.String())
+		}
+	}
+	list := cfg.Flatten(ExportOpts{Redact: []string{}})
+	if len(list) != 3 || list[2].Key != "database.password" || list[2].Value != "p@ss" || list[0].Value != DefaultMask {
+		t.Fatal("平铺结果错误:", list)
+	}
+	if raw := cfg.Flatten(ExportOpts{Raw: true}); !IsSecret(raw[0].Value) || raw[2].Value != "p@ss" {
+		t.Fatal("原始值不应隐藏:", raw)
+	}
+}
@@ -0,0 +1,52 @@
+// Copyright (C) 2019 WuPeng <wupeng364@outlook.com>.
+// Use of this source code is governed by an MIT-style.
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction,
+// including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software,
+// and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+// +build darwin dragonfly freebsd linux netbsd openbsd
+
+// 配置工具-跨进程文件锁, flock实现
+
+package conftool
+
+import (
+	"os"
+	"syscall"
+)
+
+// lockFile 对配置文件加建议锁, 锁在path.lock文件上, 配置文件会被重命名替换所以不能直接锁
+func lockFile(path string, exclusive bool) (*fileLock, error) {
+	fp, err := os.OpenFile(path+".lock", os.O_CREATE|os.O_RDWR, 0666)
+	if nil != err {
+		return nil, err
+	}
+	how := syscall.LOCK_SH
+	if exclusive {
+		how = syscall.LOCK_EX
+	}
+	for {
+		err = syscall.Flock(int(fp.Fd()), how)
+		if err != syscall.EINTR {
+			break
+		}
+	}
+	if nil != err {
+		fp.Close()
+		return nil, os.NewSyscallError("flock", err)
+	}
+	return &fileLock{fp: fp}, nil
+}
+
+// unlock 释放锁, 锁文件保留以免其他进程锁在已删除的文件上
+func (fl *fileLock) unlock() error {
+	err := syscall.Flock(int(fl.fp.Fd()), syscall.LOCK_UN)
+	if closeErr := fl.fp.Close(); nil == err {
+		err = closeErr
+	}
+	return err
+}
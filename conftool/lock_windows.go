@@ -0,0 +1,60 @@
+// Copyright (C) 2019 WuPeng <wupeng364@outlook.com>.
+// Use of this source code is governed by an MIT-style.
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction,
+// including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software,
+// and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+//go:build windows
+// +build windows
+
+// 配置工具-跨进程文件锁, LockFileEx实现
+
+package conftool
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	procLockFileEx   = syscall.NewLazyDLL("kernel32.dll").NewProc("LockFileEx")
+	procUnlockFileEx = syscall.NewLazyDLL("kernel32.dll").NewProc("UnlockFileEx")
+)
+
+// lockfileExclusiveLock LockFileEx的排他锁标志
+const lockfileExclusiveLock = 0x2
+
+// lockFile 对配置文件加锁, 锁在path.lock文件的第一个字节上, 配置文件会被重命名替换所以不能直接锁
+func lockFile(path string, exclusive bool) (*fileLock, error) {
+	fp, err := os.OpenFile(path+".lock", os.O_CREATE|os.O_RDWR, 0666)
+	if nil != err {
+		return nil, err
+	}
+	var flags uintptr
+	if exclusive {
+		flags = lockfileExclusiveLock
+	}
+	overlapped := new(syscall.Overlapped)
+	if r, _, e := procLockFileEx.Call(fp.Fd(), flags, 0, 1, 0, uintptr(unsafe.Pointer(overlapped))); r == 0 {
+		fp.Close()
+		return nil, os.NewSyscallError("LockFileEx", e)
+	}
+	return &fileLock{fp: fp}, nil
+}
+
+// unlock 释放锁, 锁文件保留以免其他进程锁在已删除的文件上
+func (fl *fileLock) unlock() error {
+	var err error
+	overlapped := new(syscall.Overlapped)
+	if r, _, e := procUnlockFileEx.Call(fl.fp.Fd(), 0, 1, 0, uintptr(unsafe.Pointer(overlapped))); r == 0 {
+		err = os.NewSyscallError("UnlockFileEx", e)
+	}
+	if closeErr := fl.fp.Close(); nil == err {
+		err = closeErr
+	}
+	return err
+}
@@ -0,0 +1,145 @@
+// Copyright (C) 2019 WuPeng <wupeng364@outlook.com>.
+// Use of this source code is governed by an MIT-style.
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction,
+// including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software,
+// and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+// 配置工具-内存配置和只读视图
+// MemoryCFG 与JSONCFG共用实现, 只是不读写文件, 可以在测试中代替JSONCFG
+
+package conftool
+
+import (
+	"gutils/types"
+	"io"
+)
+
+// MemoryCFG 内存配置
+type MemoryCFG struct {
+	cfg *JSONCFG
+}
+
+// NewMemoryCFG 创建内存配置, jsonObject为初始配置, 会被复制, 可以为nil
+func NewMemoryCFG(jsonObject map[string]interface{}) (*MemoryCFG, error) {
+	cfg := &JSONCFG{}
+	if err := cfg.initState(); nil != err {
+		return nil, err
+	}
+	init, err := normalizeValue(jsonObject)
+	if nil != err {
+		return nil, err
+	}
+	cfg.jsonObject, _ = init.(map[string]interface{})
+	if nil == cfg.jsonObject {
+		cfg.jsonObject = make(map[string]interface{})
+	}
+	return &MemoryCFG{cfg: cfg}, nil
+}
+
+// GetConfig 读取key的value信息
+func (memcfg *MemoryCFG) GetConfig(key string) types.Object {
+	return memcfg.cfg.GetConfig(key)
+}
+
+// SetConfig 保存配置, key value 都为stirng
+func (memcfg *MemoryCFG) SetConfig(key string, value string) error {
+	return memcfg.cfg.SetConfig(key, value)
+}
+
+// DeleteConfig 删除配置, key不存在时不做处理
+func (memcfg *MemoryCFG) DeleteConfig(key string) error {
+	return memcfg.cfg.DeleteConfig(key)
+}
+
+// Begin 开始一个事务
+func (memcfg *MemoryCFG) Begin() *Tx {
+	return memcfg.cfg.Begin()
+}
+
+// Update 在事务中执行fn, fn返回nil则提交, 否则回滚
+func (memcfg *MemoryCFG) Update(fn func(tx *Tx) error) error {
+	return memcfg.cfg.Update(fn)
+}
+
+// Subscribe 订阅key路径的变更, 返回订阅ID
+func (memcfg *MemoryCFG) Subscribe(key string, callback ChangeCallback) uint64 {
+	return memcfg.cfg.Subscribe(key, callback)
+}
+
+// Unsubscribe 取消订阅
+func (memcfg *MemoryCFG) Unsubscribe(id uint64) {
+	memcfg.cfg.Unsubscribe(id)
+}
+
+// SetSecretKey 设置加解密使用的密钥
+func (memcfg *MemoryCFG) SetSecretKey(key []byte) {
+	memcfg.cfg.SetSecretKey(key)
+}
+
+// SetSecret 加密后保存配置
+func (memcfg *MemoryCFG) SetSecret(key string, plaintext string) error {
+	return memcfg.cfg.SetSecret(key, plaintext)
+}
+
+// Bind 把key下的配置解码到结构体指针v
+func (memcfg *MemoryCFG) Bind(key string, v interface{}) error {
+	return memcfg.cfg.Bind(key, v)
+}
+
+// NewBinding 绑定key下的配置, 配置变更后重新解码
+func (memcfg *MemoryCFG) NewBinding(key string, v interface{}, onError func(err error)) (*Binding, error) {
+	return memcfg.cfg.NewBinding(key, v, onError)
+}
+
+// Export 导出配置到w, 敏感信息按规则隐藏
+func (memcfg *MemoryCFG) Export(w io.Writer, format ExportFormat, opts ExportOpts) error {
+	return memcfg.cfg.Export(w, format, opts)
+}
+
+// Flatten 平铺所有配置项, 敏感信息按规则隐藏
+func (memcfg *MemoryCFG) Flatten(opts ExportOpts) []KeyValue {
+	return memcfg.cfg.Flatten(opts)
+}
+
+// ReadOnlyCFG 只读视图, 读取和订阅与原配置一致, 修改返回ErrReadOnly
+type ReadOnlyCFG struct {
+	cfg Config
+}
+
+// NewReadOnly 创建配置的只读视图
+func NewReadOnly(cfg Config) *ReadOnlyCFG {
+	return &ReadOnlyCFG{cfg: cfg}
+}
+
+// GetConfig 读取key的value信息
+func (rocfg *ReadOnlyCFG) GetConfig(key string) types.Object {
+	return rocfg.cfg.GetConfig(key)
+}
+
+// SetConfig 只读, 返回ErrReadOnly
+func (rocfg *ReadOnlyCFG) SetConfig(key string, value string) error {
+	return ErrReadOnly
+}
+
+// DeleteConfig 只读, 返回ErrReadOnly
+func (rocfg *ReadOnlyCFG) DeleteConfig(key string) error {
+	return ErrReadOnly
+}
+
+// Update 只读, 不执行fn, 返回ErrReadOnly
+func (rocfg *ReadOnlyCFG) Update(fn func(tx *Tx) error) error {
+	return ErrReadOnly
+}
+
+// Subscribe 订阅key路径的变更, 返回订阅ID
+func (rocfg *ReadOnlyCFG) Subscribe(key string, callback ChangeCallback) uint64 {
+	return rocfg.cfg.Subscribe(key, callback)
+}
+
+// Unsubscribe 取消订阅
+func (rocfg *ReadOnlyCFG) Unsubscribe(id uint64) {
+	rocfg.cfg.Unsubscribe(id)
+}
@@ -0,0 +1,175 @@
+// Copyright (C) 2019 WuPeng <wupeng364@outlook.com>.
+// Use of this source code is governed by an MIT-style.
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction,
+// including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software,
+// and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+// 配置工具-配置结构迁移
+// 配置文件中保存结构版本号, InitConfig时按版本顺序执行未完成的迁移
+// 迁移前备份原文件, 所有迁移在一个事务中完成, 失败时配置文件不变
+
+package conftool
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// SchemaVersionKey 配置文件中保存结构版本号的key
+const SchemaVersionKey = "_schemaVersion"
+
+// MigrateFunc 迁移操作
+type MigrateFunc func(tx *Tx) error
+
+// Migration 配置结构迁移, 把配置升级到Version版本
+type Migration struct {
+	Version     int         // 迁移后的版本号, 从1开始
+	Description string      // 迁移描述
+	Migrate     MigrateFunc // 迁移操作
+}
+
+// AddMigrations 注册结构迁移, 需要在InitConfig之前调用
+func (jsoncfg *JSONCFG) AddMigrations(migrations ...Migration) {
+	jsoncfg.migrations = append(jsoncfg.migrations, migrations...)
+}
+
+// SchemaVersion 获取配置文件的结构版本号, 没有记录时为0
+func (jsoncfg *JSONCFG) SchemaVersion() int {
+	return schemaVersion(jsoncfg.GetConfig(SchemaVersionKey).O)
+}
+
+// migrate 执行未完成的迁移
+func (jsoncfg *JSONCFG) migrate() error {
+	if len(jsoncfg.migrations) == 0 {
+		return nil
+	}
+	migrations := make([]Migration, len(jsoncfg.migrations))
+	copy(migrations, jsoncfg.migrations)
+	sort.SliceStable(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	for i := 1; i < len(migrations); i++ {
+		if migrations[i].Version == migrations[i-1].Version {
+			return errors.New("duplicate migration version: " + strconv.Itoa(migrations[i].Version))
+		}
+	}
+
+	return jsoncfg.Update(func(tx *Tx) error {
+		// 事务开始时已经加了文件锁并从文件读取, 版本号是磁盘上最新的, 其他进程可能已经完成了迁移
+		raw, _ := tx.getRaw(SchemaVersionKey)
+		current := schemaVersion(raw)
+		if migrations[len(migrations)-1].Version <= current {
+			return nil
+		}
+		// 备份与版本检查在同一个锁内, 不会备份到迁移了一半的文件
+		if err := backupFile(jsoncfg.configPath, jsoncfg.configPath+".v"+strconv.Itoa(current)+".bak"); nil != err {
+			return err
+		}
+		for _, migration := range migrations {
+			if migration.Version <= current {
+				continue
+			}
+			if nil != migration.Migrate {
+				if err := migration.Migrate(tx); nil != err {
+					return errors.New("migrate to version " + strconv.Itoa(migration.Version) + ": " + err.Error())
+				}
+			}
+			if err := tx.Set(SchemaVersionKey, migration.Version); nil != err {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Chain 按顺序执行多个迁移操作
+func Chain(fns ...MigrateFunc) MigrateFunc {
+	return func(tx *Tx) error {
+		for _, fn := range fns {
+			if err := fn(tx); nil != err {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// RenameKey 重命名key, newName为新的最后一级名称, 如: RenameKey("database.hostname", "host")
+func RenameKey(key, newName string) MigrateFunc {
+	parent := ""
+	if index := strings.LastIndex(key, "."); index > -1 {
+		parent = key[:index]
+	}
+	return MoveKey(key, joinKey(parent, newName))
+}
+
+// MoveKey 移动key及其下级配置到新的路径, key不存在时不做处理
+func MoveKey(key, newKey string) MigrateFunc {
+	return func(tx *Tx) error {
+		val, ok := tx.getRaw(key)
+		if !ok {
+			return nil
+		}
+		if err := tx.Delete(key); nil != err {
+			return err
+		}
+		return tx.Set(newKey, val)
+	}
+}
+
+// ChangeType 转换key的值, convert收到的是原始值(加密项为密文), key不存在时不做处理
+func ChangeType(key string, convert func(val interface{}) (interface{}, error)) MigrateFunc {
+	return func(tx *Tx) error {
+		val, ok := tx.getRaw(key)
+		if !ok {
+			return nil
+		}
+		res, err := convert(val)
+		if nil != err {
+			return errors.New(key + ": " + err.Error())
+		}
+		return tx.Set(key, res)
+	}
+}
+
+// SetDefault key不存在时设置值
+func SetDefault(key string, value interface{}) MigrateFunc {
+	return func(tx *Tx) error {
+		if _, ok := tx.getRaw(key); ok {
+			return nil
+		}
+		return tx.Set(key, value)
+	}
+}
+
+// schemaVersion 解析版本号
+func schemaVersion(val interface{}) int {
+	switch val := val.(type) {
+	case float64:
+		return int(val)
+	case string:
+		res, _ := strconv.Atoi(val)
+		return res
+	}
+	return 0
+}
+
+// backupFile 复制文件作为备份
+func backupFile(src, dst string) error {
+	st, err := os.Stat(src)
+	if nil != err {
+		return err
+	}
+	data, err := ioutil.ReadFile(src)
+	if nil != err {
+		return err
+	}
+	return ioutil.WriteFile(dst, data, st.Mode().Perm())
+}
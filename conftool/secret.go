@@ -0,0 +1,278 @@
+// Copyright (C) 2019 WuPeng <wupeng364@outlook.com>.
+// Use of this source code is governed by an MIT-style.
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction,
+// including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software,
+// and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+// 配置工具-加密配置项
+// 密文格式为 ENC(base64), 使用AES-256-GCM加密, 密钥为任意字节经sha256得到
+// GetConfig时自动解密, 没有密钥或解密失败时返回空值, 不会把密文当成明文使用
+
+package conftool
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+const (
+	// SecretKeyEnv 存放密钥的环境变量, InitConfig时自动读取
+	SecretKeyEnv = "GUTILS_CONFTOOL_KEY"
+	// SecretKeyFileEnv 存放密钥文件路径的环境变量, SecretKeyEnv为空时读取
+	SecretKeyFileEnv = "GUTILS_CONFTOOL_KEYFILE"
+
+	secretPrefix = "ENC("
+	secretSuffix = ")"
+)
+
+// SecretKeyFromEnv 从环境变量读取密钥
+func SecretKeyFromEnv(name string) ([]byte, error) {
+	key := os.Getenv(name)
+	if len(key) == 0 {
+		return nil, errors.New("secret key env is empty: " + name)
+	}
+	return []byte(key), nil
+}
+
+// SecretKeyFromFile 从文件读取密钥, 忽略首尾空白
+func SecretKeyFromFile(path string) ([]byte, error) {
+	data, err := ioutil.ReadFile(path)
+	if nil != err {
+		return nil, err
+	}
+	key := strings.TrimSpace(string(data))
+	if len(key) == 0 {
+		return nil, errors.New("secret key file is empty: " + path)
+	}
+	return []byte(key), nil
+}
+
+// IsSecret 是否是加密的值
+func IsSecret(value string) bool {
+	return strings.HasPrefix(value, secretPrefix) && strings.HasSuffix(value, secretSuffix)
+}
+
+// EncryptSecret 加密明文, 返回 ENC(base64) 格式的密文
+func EncryptSecret(key []byte, plaintext string) (string, error) {
+	gcm, err := newSecretCipher(key)
+	if nil != err {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err = io.ReadFull(rand.Reader, nonce); nil != err {
+		return "", err
+	}
+	data := gcm.Seal(nonce, nonce, []byte(plaintext), nil)
+	return secretPrefix + base64.StdEncoding.EncodeToString(data) + secretSuffix, nil
+}
+
+// DecryptSecret 解密 ENC(base64) 格式的密文
+func DecryptSecret(key []byte, value string) (string, error) {
+	if !IsSecret(value) {
+		return "", errors.New("value is not a secret")
+	}
+	gcm, err := newSecretCipher(key)
+	if nil != err {
+		return "", err
+	}
+	data, err := base64.StdEncoding.DecodeString(value[len(secretPrefix) : len(value)-len(secretSuffix)])
+	if nil != err {
+		return "", err
+	}
+	if len(data) < gcm.NonceSize() {
+		return "", errors.New("secret is too short")
+	}
+	plaintext, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+	if nil != err {
+		return "", err
+	}
+	return string(plaintext), nil
+}
+
+// SetSecretKey 设置加解密使用的密钥
+func (jsoncfg *JSONCFG) SetSecretKey(key []byte) {
+	jsoncfg.l.Lock()
+	defer jsoncfg.l.Unlock()
+	jsoncfg.secretKey = key
+}
+
+// SetSecret 加密后保存配置
+func (jsoncfg *JSONCFG) SetSecret(key string, plaintext string) error {
+	return jsoncfg.Update(func(tx *Tx) error {
+		return tx.SetSecret(key, plaintext)
+	})
+}
+
+// SetSecret 加密后保存配置
+func (tx *Tx) SetSecret(key string, plaintext string) error {
+	secretKey := tx.jsoncfg.getSecretKey()
+	if len(secretKey) == 0 {
+		return errNoSecretKey
+	}
+	value, err := EncryptSecret(secretKey, plaintext)
+	if nil != err {
+		return err
+	}
+	return tx.Set(key, value)
+}
+
+// RotateSecretKey 使用新密钥重新加密所有密文, 写入成功后切换为新密钥
+func (jsoncfg *JSONCFG) RotateSecretKey(newKey []byte) error {
+	if len(newKey) == 0 {
+		return errors.New("new secret key is empty")
+	}
+	tx := jsoncfg.Begin()
+	defer tx.Rollback()
+	if nil != tx.err {
+		return tx.err
+	}
+	oldKey := jsoncfg.getSecretKey()
+	if len(oldKey) == 0 {
+		return errNoSecretKey
+	}
+	for key, val := range tx.view {
+		res, err := mapSecrets(val, func(value string) (string, error) {
+			plaintext, err := DecryptSecret(oldKey, value)
+			if nil != err {
+				return "", err
+			}
+			return EncryptSecret(newKey, plaintext)
+		})
+		if nil != err {
+			return errors.New("re-encrypt " + key + ": " + err.Error())
+		}
+		tx.view[key] = res
+	}
+	// 明文没有变化, 不需要通知订阅者
+	jsoncfg.l.Lock()
+	defer jsoncfg.l.Unlock()
+	_, err := jsoncfg.commitLocked(tx.view)
+	if nil == err {
+		jsoncfg.secretKey = newKey
+	}
+	return err
+}
+
+// errNoSecretKey 未设置密钥
+var errNoSecretKey = errors.New("secret key is not set")
+
+// getSecretKey 获取当前密钥
+func (jsoncfg *JSONCFG) getSecretKey() []byte {
+	jsoncfg.l.RLock()
+	defer jsoncfg.l.RUnlock()
+	return jsoncfg.secretKey
+}
+
+// loadSecretKeyFromEnv 从环境变量读取密钥, 都没有设置时不处理
+func (jsoncfg *JSONCFG) loadSecretKeyFromEnv() error {
+	if len(os.Getenv(SecretKeyEnv)) > 0 {
+		jsoncfg.secretKey, _ = SecretKeyFromEnv(SecretKeyEnv)
+		return nil
+	}
+	if keyFile := os.Getenv(SecretKeyFileEnv); len(keyFile) > 0 {
+		key, err := SecretKeyFromFile(keyFile)
+		if nil != err {
+			return err
+		}
+		jsoncfg.secretKey = key
+	}
+	return nil
+}
+
+// revealSecrets 解密值中所有的密文, 无法解密的密文替换为nil, 没有密文时返回原值
+func revealSecrets(val interface{}, key []byte) interface{} {
+	res, _ := mapSecrets(val, func(value string) (string, error) {
+		return DecryptSecret(key, value)
+	})
+	return res
+}
+
+// mapSecrets 对值中所有的密文做转换, fn返回错误时该值为nil, 返回第一个错误
+// 只有包含密文的对象才会被复制, 否则返回原值
+func mapSecrets(val interface{}, fn func(value string) (string, error)) (interface{}, error) {
+	switch val := val.(type) {
+	case string:
+		if !IsSecret(val) {
+			return val, nil
+		}
+		res, err := fn(val)
+		if nil != err {
+			return nil, err
+		}
+		return res, nil
+	case map[string]interface{}:
+		if !containsSecret(val) {
+			return val, nil
+		}
+		var firstErr error
+		res := make(map[string]interface{}, len(val))
+		for k, v := range val {
+			temp, err := mapSecrets(v, fn)
+			if nil != err && nil == firstErr {
+				firstErr = err
+			}
+			res[k] = temp
+		}
+		return res, firstErr
+	case []interface{}:
+		if !containsSecret(val) {
+			return val, nil
+		}
+		var firstErr error
+		res := make([]interface{}, len(val))
+		for i, v := range val {
+			temp, err := mapSecrets(v, fn)
+			if nil != err && nil == firstErr {
+				firstErr = err
+			}
+			res[i] = temp
+		}
+		return res, firstErr
+	}
+	return val, nil
+}
+
+// containsSecret 值中是否包含密文
+func containsSecret(val interface{}) bool {
+	switch val := val.(type) {
+	case string:
+		return IsSecret(val)
+	case map[string]interface{}:
+		for _, v := range val {
+			if containsSecret(v) {
+				return true
+			}
+		}
+	case []interface{}:
+		for _, v := range val {
+			if containsSecret(v) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// newSecretCipher 由密钥创建AES-GCM
+func newSecretCipher(key []byte) (cipher.AEAD, error) {
+	if len(key) == 0 {
+		return nil, errNoSecretKey
+	}
+	sum := sha256.Sum256(key)
+	block, err := aes.NewCipher(sum[:])
+	if nil != err {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,242 @@
+// Copyright (C) 2019 WuPeng <wupeng364@outlook.com>.
+// Use of this source code is governed by an MIT-style.
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction,
+// including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software,
+// and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+// 配置工具-JSON配置事务
+// 开始事务时加文件锁并重新读取配置文件, 锁持有到提交或回滚, 事务内的读-改-写不会覆盖其他进程的修改
+// 事务内的修改在提交时只写入一次文件
+
+package conftool
+
+import (
+	"encoding/json"
+	"errors"
+	"gutils/types"
+	"os"
+	"strings"
+)
+
+// Tx 配置事务, 不能在多个goroutine中同时使用, 必须调用Commit或Rollback结束
+type Tx struct {
+	jsoncfg *JSONCFG
+	view    map[string]interface{} // 事务内看到的配置, 包含未提交的修改
+	lock    *fileLock              // 文件锁, 事务结束时释放
+	err     error                  // 开始事务时的错误, 提交时返回
+	changed bool                   // 是否有修改
+	loaded  bool                   // view是否从文件读取
+	closed  bool
+	held    bool // 是否持有事务锁
+}
+
+// Begin 开始一个事务, 加锁后从文件读取最新的配置, 锁持有到Commit或Rollback
+// 同一配置同时只有一个事务, 其他事务(包括其他进程)会等待, 不能在事务内再开始事务
+func (jsoncfg *JSONCFG) Begin() *Tx {
+	jsoncfg.tl.Lock()
+	tx := &Tx{jsoncfg: jsoncfg, held: true}
+	tx.lock, tx.view, tx.err = jsoncfg.lockAndRead()
+	if nil != tx.err {
+		tx.release()
+	}
+	tx.loaded = nil != tx.view
+	if nil == tx.view {
+		jsoncfg.l.RLock()
+		tx.view = deepCopy(jsoncfg.jsonObject).(map[string]interface{})
+		jsoncfg.l.RUnlock()
+	}
+	return tx
+}
+
+// lockAndRead 加文件锁后读取磁盘上的配置, 内存配置或文件不存在时返回的配置为nil
+func (jsoncfg *JSONCFG) lockAndRead() (*fileLock, map[string]interface{}, error) {
+	if len(jsoncfg.configPath) == 0 {
+		return nil, nil, nil
+	}
+	lock, err := lockFile(jsoncfg.configPath, true)
+	if nil != err {
+		return nil, nil, err
+	}
+	onDisk := make(map[string]interface{})
+	if err = readFileAsJSON(jsoncfg.configPath, &onDisk); nil != err {
+		if os.IsNotExist(err) {
+			return lock, nil, nil
+		}
+		lock.unlock()
+		return nil, nil, err
+	}
+	if nil == onDisk {
+		onDisk = make(map[string]interface{})
+	}
+	return lock, onDisk, nil
+}
+
+// Update 在事务中执行fn, fn返回nil则提交, 否则回滚
+func (jsoncfg *JSONCFG) Update(fn func(tx *Tx) error) error {
+	tx := jsoncfg.Begin()
+	if nil != tx.err {
+		tx.Rollback()
+		return tx.err
+	}
+	if err := fn(tx); nil != err {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// Get 读取事务内的配置, 包含未提交的修改, 加密的值会自动解密
+func (tx *Tx) Get(key string) (res types.Object) {
+	if len(key) == 0 || nil == tx.view {
+		return
+	}
+	if tp, ok := getPath(tx.view, strings.Split(key, ".")); ok {
+		res = types.Object{O: revealSecrets(deepCopy(tp), tx.jsoncfg.getSecretKey())}
+	}
+	return
+}
+
+// getRaw 读取事务内的原始值, 不解密
+func (tx *Tx) getRaw(key string) (interface{}, bool) {
+	if nil == tx.view {
+		return nil, false
+	}
+	res, ok := getPath(tx.view, strings.Split(key, "."))
+	return deepCopy(res), ok
+}
+
+// Has key是否存在, 不解密, 没有密钥或无法解密的密文也算存在
+func (tx *Tx) Has(key string) bool {
+	if len(key) == 0 {
+		return false
+	}
+	_, ok := tx.getRaw(key)
+	return ok
+}
+
+// Set 设置配置, value需要可以序列化为json
+func (tx *Tx) Set(key string, value interface{}) error {
+	if len(key) == 0 {
+		return errors.New("key is empty")
+	}
+	value, err := normalizeValue(value)
+	if nil != err {
+		return err
+	}
+	keys := strings.Split(key, ".")
+	return tx.apply(func(jsonObject map[string]interface{}) error {
+		return setPath(jsonObject, keys, deepCopy(value))
+	})
+}
+
+// Delete 删除配置, key不存在时不做处理
+func (tx *Tx) Delete(key string) error {
+	if len(key) == 0 {
+		return errors.New("key is empty")
+	}
+	keys := strings.Split(key, ".")
+	return tx.apply(func(jsonObject map[string]interface{}) error {
+		deletePath(jsonObject, keys)
+		return nil
+	})
+}
+
+// Commit 提交事务, 所有修改一次性写入文件, 写入失败则内存中的配置不变
+func (tx *Tx) Commit() error {
+	if tx.closed {
+		return errTxClosed
+	}
+	tx.closed = true
+	if nil != tx.err || !tx.changed && !tx.loaded {
+		tx.release()
+		return tx.err
+	}
+	jsoncfg := tx.jsoncfg
+	jsoncfg.l.Lock()
+	var changes []change
+	var err error
+	if tx.changed {
+		changes, err = jsoncfg.commitLocked(tx.view)
+	} else {
+		// 没有修改时不写入文件, 但内存中的配置更新为读到的最新配置
+		changes = diffObject("", jsoncfg.jsonObject, tx.view)
+		jsoncfg.jsonObject = tx.view
+		jsoncfg.revision++
+	}
+	jsoncfg.l.Unlock()
+	tx.release()
+	if nil != err {
+		return err
+	}
+	jsoncfg.notify(changes)
+	return nil
+}
+
+// commitLocked 写入事务内的配置并替换内存中的配置, 返回变更, 调用前需持有事务锁和jsoncfg.l
+// 事务开始时已经加了文件锁并读取了最新的配置, 可以直接写入
+func (jsoncfg *JSONCFG) commitLocked(jsonObject map[string]interface{}) ([]change, error) {
+	if len(jsoncfg.configPath) > 0 {
+		if err := writeFileAsJSON(jsoncfg.configPath, jsonObject); nil != err {
+			return nil, err
+		}
+	}
+	changes := diffObject("", jsoncfg.jsonObject, jsonObject)
+	jsoncfg.jsonObject = jsonObject
+	jsoncfg.revision++
+	return changes, nil
+}
+
+// Rollback 放弃事务内的修改, 已经提交或回滚时不做处理
+func (tx *Tx) Rollback() {
+	tx.closed = true
+	tx.view = nil
+	tx.release()
+}
+
+// release 释放文件锁和事务锁
+func (tx *Tx) release() {
+	if nil != tx.lock {
+		tx.lock.unlock()
+		tx.lock = nil
+	}
+	if tx.held {
+		tx.held = false
+		tx.jsoncfg.tl.Unlock()
+	}
+}
+
+// errTxClosed 事务已经提交或回滚
+var errTxClosed = errors.New("transaction is already committed or rolled back")
+
+// apply 修改事务内的配置
+func (tx *Tx) apply(op func(jsonObject map[string]interface{}) error) error {
+	if tx.closed {
+		return errTxClosed
+	}
+	if nil != tx.err {
+		return tx.err
+	}
+	if err := op(tx.view); nil != err {
+		return err
+	}
+	tx.changed = true
+	return nil
+}
+
+// normalizeValue 转换为json解析后的类型, 保证与重新读取文件后的值一致
+func normalizeValue(value interface{}) (interface{}, error) {
+	switch value.(type) {
+	case nil, bool, string, float64:
+		return value, nil
+	}
+	data, err := json.Marshal(value)
+	if nil != err {
+		return nil, err
+	}
+	var res interface{}
+	err = json.Unmarshal(data, &res)
+	return res, err
+}
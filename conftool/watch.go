@@ -0,0 +1,251 @@
+// Copyright (C) 2019 WuPeng <wupeng364@outlook.com>.
+// Use of this source code is governed by an MIT-style.
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction,
+// including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software,
+// and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+// 配置工具-JSON文件监听与热加载
+// 文件发生变化后重新读取, 校验通过才替换内存中的配置, 并按key路径通知订阅者
+
+package conftool
+
+import (
+	"errors"
+	"gutils/fstool"
+	"gutils/types"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// watchDebounce 合并短时间内的多次写入, 避免读到写了一半的文件
+const watchDebounce = 100 * time.Millisecond
+
+// ChangeCallback 配置变更回调(变更的key路径, 旧值, 新值)
+type ChangeCallback func(key string, oldVal, newVal types.Object)
+
+// WatchOpts 配置文件监听选项
+type WatchOpts struct {
+	Interval time.Duration                                 // 轮询间隔, 默认1秒
+	Polling  bool                                          // 强制使用轮询方式, 不使用inotify
+	Validate func(jsonObject map[string]interface{}) error // 替换前校验新配置, 返回错误则保留旧配置
+	OnError  func(err error)                               // 重新加载失败时回调
+}
+
+// subscriber 配置变更订阅者
+type subscriber struct {
+	id       uint64
+	key      string
+	callback ChangeCallback
+}
+
+// change 一处配置变更
+type change struct {
+	key    string
+	oldVal interface{}
+	newVal interface{}
+}
+
+// cfgwatcher 配置文件监听器
+type cfgwatcher struct {
+	opts    WatchOpts
+	watcher *fstool.Watcher
+	done    chan struct{}
+}
+
+// Subscribe 订阅key路径的变更, key为空则订阅全部, 返回订阅ID
+// key路径本身、其下级或上级发生变化时都会通知, 加密的值会解密后通知
+func (jsoncfg *JSONCFG) Subscribe(key string, callback ChangeCallback) uint64 {
+	jsoncfg.sl.Lock()
+	defer jsoncfg.sl.Unlock()
+	jsoncfg.subSeq++
+	jsoncfg.subs[jsoncfg.subSeq] = subscriber{id: jsoncfg.subSeq, key: key, callback: callback}
+	return jsoncfg.subSeq
+}
+
+// Unsubscribe 取消订阅
+func (jsoncfg *JSONCFG) Unsubscribe(id uint64) {
+	jsoncfg.sl.Lock()
+	defer jsoncfg.sl.Unlock()
+	delete(jsoncfg.subs, id)
+}
+
+// Watch 开始监听配置文件, 文件变化后自动重新加载
+// Linux下优先使用inotify, 不可用时使用轮询方式
+func (jsoncfg *JSONCFG) Watch(opts WatchOpts) error {
+	jsoncfg.wl.Lock()
+	defer jsoncfg.wl.Unlock()
+	if nil != jsoncfg.watcher {
+		return errors.New("config file is already watched")
+	}
+	if opts.Interval <= 0 {
+		opts.Interval = time.Second
+	}
+	w, err := fstool.NewWatcher(jsoncfg.configPath, fstool.WatcherOpts{
+		Debounce: watchDebounce,
+		Polling:  opts.Polling,
+		Interval: opts.Interval,
+	})
+	if nil != err {
+		return err
+	}
+	jsoncfg.watcher = &cfgwatcher{
+		opts:    opts,
+		watcher: w,
+		done:    make(chan struct{}),
+	}
+	go jsoncfg.watcher.run(jsoncfg)
+	return nil
+}
+
+// StopWatch 停止监听配置文件
+func (jsoncfg *JSONCFG) StopWatch() {
+	jsoncfg.wl.Lock()
+	defer jsoncfg.wl.Unlock()
+	if nil == jsoncfg.watcher {
+		return
+	}
+	close(jsoncfg.watcher.done)
+	jsoncfg.watcher.watcher.Close()
+	jsoncfg.watcher = nil
+}
+
+// Reload 重新读取配置文件, 校验通过后替换并通知订阅者
+// 读取时加共享的文件锁, 读取期间内存中的配置被事务更新时放弃本次结果, 避免用旧内容覆盖
+func (jsoncfg *JSONCFG) Reload() error {
+	jsoncfg.l.RLock()
+	revision := jsoncfg.revision
+	jsoncfg.l.RUnlock()
+	lock, err := lockFile(jsoncfg.configPath, false)
+	if nil != err {
+		return err
+	}
+	jsonObject := make(map[string]interface{})
+	err = readFileAsJSON(jsoncfg.configPath, &jsonObject)
+	lock.unlock()
+	if nil != err {
+		return err
+	}
+	if validate := jsoncfg.getValidate(); nil != validate {
+		if err = validate(jsonObject); nil != err {
+			return err
+		}
+	}
+	jsoncfg.l.Lock()
+	if revision != jsoncfg.revision {
+		jsoncfg.l.Unlock()
+		return nil
+	}
+	changes := diffObject("", jsoncfg.jsonObject, jsonObject)
+	jsoncfg.jsonObject = jsonObject
+	jsoncfg.revision++
+	jsoncfg.l.Unlock()
+	jsoncfg.notify(changes)
+	return nil
+}
+
+// getValidate 获取监听时设置的校验函数
+func (jsoncfg *JSONCFG) getValidate() func(map[string]interface{}) error {
+	jsoncfg.wl.Lock()
+	defer jsoncfg.wl.Unlock()
+	if nil == jsoncfg.watcher {
+		return nil
+	}
+	return jsoncfg.watcher.opts.Validate
+}
+
+// notify 通知订阅者, 不能在持有jsoncfg.l时调用
+func (jsoncfg *JSONCFG) notify(changes []change) {
+	if len(changes) == 0 {
+		return
+	}
+	jsoncfg.sl.RLock()
+	subs := make([]subscriber, 0, len(jsoncfg.subs))
+	for _, sub := range jsoncfg.subs {
+		subs = append(subs, sub)
+	}
+	jsoncfg.sl.RUnlock()
+	sort.Slice(subs, func(i, j int) bool {
+		return subs[i].id < subs[j].id
+	})
+	secretKey := jsoncfg.getSecretKey()
+	reveal := func(val interface{}) types.Object {
+		return types.Object{O: revealSecrets(deepCopy(val), secretKey)}
+	}
+
+	for _, sub := range subs {
+		for _, c := range changes {
+			// 变更在订阅路径之下
+			if len(sub.key) == 0 || c.key == sub.key || strings.HasPrefix(c.key, sub.key+".") {
+				sub.callback(c.key, reveal(c.oldVal), reveal(c.newVal))
+				continue
+			}
+			// 订阅路径的上级被替换
+			if strings.HasPrefix(sub.key, c.key+".") {
+				keys := strings.Split(sub.key[len(c.key)+1:], ".")
+				oldVal, _ := getPath(c.oldVal, keys)
+				newVal, _ := getPath(c.newVal, keys)
+				if !reflect.DeepEqual(oldVal, newVal) {
+					sub.callback(sub.key, reveal(oldVal), reveal(newVal))
+				}
+			}
+		}
+	}
+}
+
+// diffObject 对比两个json对象, 返回按key路径排序的变更列表
+func diffObject(prefix string, oldVal, newVal interface{}) []change {
+	oldMap, oldOk := oldVal.(map[string]interface{})
+	newMap, newOk := newVal.(map[string]interface{})
+	if !oldOk || !newOk {
+		if reflect.DeepEqual(oldVal, newVal) {
+			return nil
+		}
+		return []change{{key: prefix, oldVal: oldVal, newVal: newVal}}
+	}
+	changes := make([]change, 0)
+	for key, val := range oldMap {
+		changes = append(changes, diffObject(joinKey(prefix, key), val, newMap[key])...)
+	}
+	for key, val := range newMap {
+		if _, ok := oldMap[key]; !ok {
+			changes = append(changes, diffObject(joinKey(prefix, key), nil, val)...)
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].key < changes[j].key
+	})
+	return changes
+}
+
+// joinKey 拼接key路径
+func joinKey(prefix, key string) string {
+	if len(prefix) == 0 {
+		return key
+	}
+	return prefix + "." + key
+}
+
+// run 处理文件变化通知, 文件被删除时保留当前配置
+func (watcher *cfgwatcher) run(jsoncfg *JSONCFG) {
+	for {
+		select {
+		case <-watcher.done:
+			return
+		case ev, ok := <-watcher.watcher.Events():
+			if !ok {
+				return
+			}
+			if !ev.Op.Has(fstool.WatchCreate|fstool.WatchRename) && (ev.Op.Has(fstool.WatchRemove) || !ev.Op.Has(fstool.WatchWrite)) {
+				continue
+			}
+			if err := jsoncfg.Reload(); nil != err && nil != watcher.opts.OnError {
+				watcher.opts.OnError(err)
+			}
+		}
+	}
+}
@@ -0,0 +1,568 @@
+// Copyright (C) 2019 WuPeng <wupeng364@outlook.com>.
+// Use of this source code is governed by an MIT-style.
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction,
+// including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software,
+// and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+// 文件工具-压缩包
+// 支持zip和tar.gz, 可以打包到文件或直接写入io.Writer(如http.ResponseWriter)
+// 解压时检查条目路径不能超出目标文件夹(zip-slip), 并可以限制条目数和解压后的大小
+
+package fstool
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ArchiveFormat 压缩包格式
+type ArchiveFormat string
+
+const (
+	// ArchiveZip zip格式
+	ArchiveZip ArchiveFormat = "zip"
+	// ArchiveTarGz tar.gz格式
+	ArchiveTarGz ArchiveFormat = "tar.gz"
+)
+
+var (
+	// ErrUnknownFormat 不支持的压缩包格式
+	ErrUnknownFormat = errors.New("unknown archive format")
+	// ErrUnsafePath 条目路径超出目标文件夹, 或需要经过符号链接写入
+	ErrUnsafePath = errors.New("unsafe archive entry path")
+	// ErrArchiveLimit 条目数或解压后的大小超出限制
+	ErrArchiveLimit = errors.New("archive exceeds limit")
+)
+
+// ArchiveFormatOf 根据扩展名判断格式, 支持.zip .tar.gz .tgz
+func ArchiveFormatOf(name string) (ArchiveFormat, error) {
+	lower := strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(lower, ".zip"):
+		return ArchiveZip, nil
+	case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		return ArchiveTarGz, nil
+	}
+	return "", &os.PathError{Op: "archive", Path: name, Err: ErrUnknownFormat}
+}
+
+// ArchiveEntry 压缩包中的条目
+type ArchiveEntry struct {
+	Name     string      // 使用'/'分隔的路径, 文件夹不带结尾的'/'
+	Size     int64       // 解压后的大小
+	Mode     os.FileMode // 权限和类型
+	ModTime  time.Time   // 修改时间
+	IsDir    bool        // 是否是文件夹
+	Linkname string      // 符号链接的目标
+}
+
+// ArchiveOpts 打包选项
+type ArchiveOpts struct {
+	Format ArchiveFormat // 格式, 为空时按目标文件的扩展名判断, 写入io.Writer时默认zip
+	Walk   WalkOpts      // 遍历源目录的选项, 可以过滤文件, 默认保存符号链接本身
+	Prefix string        // 所有条目的上级目录, 如 "backup-20190101"
+}
+
+// CreateArchive 把文件|夹打包到dst, 先写入同目录下的临时文件, 完成后重命名
+// 打包文件夹时条目为其中内容的相对路径, dst位于src中时会被排除
+func CreateArchive(src, dst string, opts ArchiveOpts) error {
+	if len(opts.Format) == 0 {
+		format, err := ArchiveFormatOf(dst)
+		if nil != err {
+			return err
+		}
+		opts.Format = format
+	}
+	w, err := NewAtomicWriter(dst, 0)
+	if nil != err {
+		return err
+	}
+	defer w.Close()
+	if err = writeArchive(w, src, opts, []string{dst, w.Name()}); nil != err {
+		return err
+	}
+	return w.Commit()
+}
+
+// WriteArchive 把文件|夹打包后写入w, 不会关闭w
+func WriteArchive(w io.Writer, src string, opts ArchiveOpts) error {
+	if len(opts.Format) == 0 {
+		opts.Format = ArchiveZip
+	}
+	return writeArchive(w, src, opts, nil)
+}
+
+// archiveWriter 写入一个条目, 文件内容从r读取
+type archiveWriter interface {
+	add(name string, info os.FileInfo, link string, r io.Reader) error
+	Close() error
+}
+
+// writeArchive 打包, exclude为需要跳过的文件
+func writeArchive(w io.Writer, src string, opts ArchiveOpts, exclude []string) error {
+	var aw archiveWriter
+	switch opts.Format {
+	case ArchiveZip:
+		aw = &zipWriter{zw: zip.NewWriter(w)}
+	case ArchiveTarGz:
+		gw := gzip.NewWriter(w)
+		aw = &tarWriter{gw: gw, tw: tar.NewWriter(gw)}
+	default:
+		return &os.PathError{Op: "archive", Path: string(opts.Format), Err: ErrUnknownFormat}
+	}
+	err := addArchiveEntries(aw, src, opts, exclude)
+	if cerr := aw.Close(); nil == err {
+		err = cerr
+	}
+	return err
+}
+
+// addArchiveEntries 遍历src写入条目
+func addArchiveEntries(aw archiveWriter, src string, opts ArchiveOpts, exclude []string) error {
+	prefix := strings.Trim(path.Clean("/"+filepath.ToSlash(opts.Prefix)), "/")
+	st, err := os.Stat(src)
+	if nil != err {
+		return err
+	}
+	if !st.IsDir() {
+		return addArchiveFile(aw, src, path.Join(prefix, filepath.Base(src)), false)
+	}
+	if len(prefix) > 0 {
+		if err = aw.add(prefix, st, "", nil); nil != err {
+			return err
+		}
+	}
+	skip := make(map[string]bool)
+	for _, name := range exclude {
+		if abs, err := filepath.Abs(name); nil == err {
+			skip[abs] = true
+		}
+	}
+	walkOpts := opts.Walk
+	walkOpts.Sorted = true
+	return Walk(src, walkOpts, func(entry WalkEntry, err error) error {
+		if nil != err {
+			return err
+		}
+		if abs, err := filepath.Abs(entry.Path); nil == err && skip[abs] {
+			return nil
+		}
+		keepLink := entry.Symlink && walkOpts.Symlinks == SymlinkNoFollow
+		return addArchiveFile(aw, entry.Path, path.Join(prefix, entry.RelPath), keepLink)
+	})
+}
+
+// addArchiveFile 写入一个文件|夹|符号链接
+func addArchiveFile(aw archiveWriter, file, name string, keepLink bool) error {
+	stat := os.Stat
+	if keepLink {
+		stat = os.Lstat
+	}
+	info, err := stat(file)
+	if nil != err {
+		return err
+	}
+	if info.Mode()&os.ModeSymlink != 0 {
+		link, err := os.Readlink(file)
+		if nil != err {
+			return err
+		}
+		return aw.add(name, info, link, nil)
+	}
+	if info.IsDir() || !info.Mode().IsRegular() {
+		return aw.add(name, info, "", nil)
+	}
+	fp, err := os.Open(file)
+	if nil != err {
+		return err
+	}
+	defer fp.Close()
+	return aw.add(name, info, "", fp)
+}
+
+// zipWriter 写入zip
+type zipWriter struct {
+	zw *zip.Writer
+}
+
+func (aw *zipWriter) add(name string, info os.FileInfo, link string, r io.Reader) error {
+	if !info.IsDir() && info.Mode()&os.ModeSymlink == 0 && !info.Mode().IsRegular() {
+		return nil // 设备|管道等无法打包
+	}
+	hdr, err := zip.FileInfoHeader(info)
+	if nil != err {
+		return err
+	}
+	hdr.Name = name
+	if info.IsDir() {
+		hdr.Name += "/"
+		hdr.Method = zip.Store
+	} else {
+		hdr.Method = zip.Deflate
+	}
+	w, err := aw.zw.CreateHeader(hdr)
+	if nil != err {
+		return err
+	}
+	if len(link) > 0 {
+		_, err = io.WriteString(w, link)
+	} else if nil != r {
+		_, err = io.Copy(w, r)
+	}
+	return err
+}
+
+func (aw *zipWriter) Close() error {
+	return aw.zw.Close()
+}
+
+// tarWriter 写入tar.gz
+type tarWriter struct {
+	gw *gzip.Writer
+	tw *tar.Writer
+}
+
+func (aw *tarWriter) add(name string, info os.FileInfo, link string, r io.Reader) error {
+	if !info.IsDir() && info.Mode()&os.ModeSymlink == 0 && !info.Mode().IsRegular() {
+		return nil // 设备|管道等无法打包
+	}
+	hdr, err := tar.FileInfoHeader(info, link)
+	if nil != err {
+		return err
+	}
+	hdr.Name = name
+	if info.IsDir() {
+		hdr.Name += "/"
+	}
+	if err = aw.tw.WriteHeader(hdr); nil != err {
+		return err
+	}
+	if nil != r && hdr.Typeflag == tar.TypeReg {
+		_, err = io.CopyN(aw.tw, r, hdr.Size)
+	}
+	return err
+}
+
+func (aw *tarWriter) Close() error {
+	err := aw.tw.Close()
+	if gerr := aw.gw.Close(); nil == err {
+		err = gerr
+	}
+	return err
+}
+
+// archiveReader 逐个读取条目, 结束时返回io.EOF
+type archiveReader interface {
+	next() (ArchiveEntry, io.Reader, error)
+	Close() error
+}
+
+// openArchive 按扩展名打开压缩包
+func openArchive(src string, format ArchiveFormat) (archiveReader, error) {
+	if len(format) == 0 {
+		var err error
+		if format, err = ArchiveFormatOf(src); nil != err {
+			return nil, err
+		}
+	}
+	switch format {
+	case ArchiveZip:
+		zr, err := zip.OpenReader(src)
+		if nil != err {
+			return nil, err
+		}
+		return &zipReader{zr: zr}, nil
+	case ArchiveTarGz:
+		fp, err := os.Open(src)
+		if nil != err {
+			return nil, err
+		}
+		gr, err := gzip.NewReader(fp)
+		if nil != err {
+			fp.Close()
+			return nil, err
+		}
+		return &tarReader{fp: fp, gr: gr, tr: tar.NewReader(gr)}, nil
+	}
+	return nil, &os.PathError{Op: "archive", Path: string(format), Err: ErrUnknownFormat}
+}
+
+// zipReader 读取zip
+type zipReader struct {
+	zr  *zip.ReadCloser
+	i   int
+	cur io.ReadCloser
+}
+
+func (ar *zipReader) next() (ArchiveEntry, io.Reader, error) {
+	if nil != ar.cur {
+		ar.cur.Close()
+		ar.cur = nil
+	}
+	if ar.i >= len(ar.zr.File) {
+		return ArchiveEntry{}, nil, io.EOF
+	}
+	f := ar.zr.File[ar.i]
+	ar.i++
+	info := f.FileInfo()
+	entry := ArchiveEntry{Name: f.Name, Size: int64(f.UncompressedSize64), Mode: info.Mode(), ModTime: f.Modified, IsDir: info.IsDir()}
+	r, err := f.Open()
+	if nil != err {
+		return entry, nil, err
+	}
+	ar.cur = r
+	if entry.Mode&os.ModeSymlink != 0 {
+		// zip中符号链接的目标保存为内容
+		link, err := io.ReadAll(io.LimitReader(r, 4096))
+		if nil != err {
+			return entry, nil, err
+		}
+		entry.Linkname, entry.Size = string(link), 0
+	}
+	return normalizeEntry(entry), r, nil
+}
+
+func (ar *zipReader) Close() error {
+	if nil != ar.cur {
+		ar.cur.Close()
+	}
+	return ar.zr.Close()
+}
+
+// tarReader 读取tar.gz
+type tarReader struct {
+	fp *os.File
+	gr *gzip.Reader
+	tr *tar.Reader
+}
+
+func (ar *tarReader) next() (ArchiveEntry, io.Reader, error) {
+	hdr, err := ar.tr.Next()
+	if nil != err {
+		return ArchiveEntry{}, nil, err
+	}
+	info := hdr.FileInfo()
+	entry := ArchiveEntry{Name: hdr.Name, Size: hdr.Size, Mode: info.Mode(), ModTime: hdr.ModTime, IsDir: info.IsDir(), Linkname: hdr.Linkname}
+	switch hdr.Typeflag {
+	case tar.TypeReg, tar.TypeDir, tar.TypeSymlink:
+	default:
+		// 硬链接|设备等不解压
+		entry.Mode |= os.ModeIrregular
+	}
+	if hdr.Typeflag != tar.TypeReg {
+		entry.Size = 0
+	}
+	return normalizeEntry(entry), ar.tr, nil
+}
+
+func (ar *tarReader) Close() error {
+	ar.gr.Close()
+	return ar.fp.Close()
+}
+
+// normalizeEntry 统一条目名字的格式
+func normalizeEntry(entry ArchiveEntry) ArchiveEntry {
+	entry.Name = strings.TrimSuffix(strings.ReplaceAll(entry.Name, "\\", "/"), "/")
+	return entry
+}
+
+// ListArchive 列出压缩包中的条目, 格式按扩展名判断
+func ListArchive(src string) ([]ArchiveEntry, error) {
+	ar, err := openArchive(src, "")
+	if nil != err {
+		return nil, err
+	}
+	defer ar.Close()
+	var list []ArchiveEntry
+	for {
+		entry, _, err := ar.next()
+		if err == io.EOF {
+			return list, nil
+		}
+		if nil != err {
+			return list, err
+		}
+		entry.Mode &^= os.ModeIrregular
+		list = append(list, entry)
+	}
+}
+
+// ExtractOpts 解压选项
+type ExtractOpts struct {
+	Format      ArchiveFormat // 格式, 为空时按扩展名判断
+	Replace     bool          // 重复覆盖
+	Ignore      bool          // 重复忽略
+	Symlinks    bool          // 是否解压符号链接, 链接目标必须在目标文件夹内, 默认跳过
+	MaxEntries  int           // 最多条目数, 0不限制
+	MaxFileSize int64         // 单个文件解压后的大小上限, 0不限制
+	MaxSize     int64         // 解压后的总大小上限, 0不限制
+}
+
+// ExtractArchive 解压到dst文件夹, 不存在时创建
+// 条目路径为绝对路径、包含..超出dst或需要经过符号链接写入时返回ErrUnsafePath, 超出限制时返回ErrArchiveLimit
+// 硬链接和设备等特殊文件会被跳过, 出错时已经解压的文件不会被删除
+func ExtractArchive(src, dst string, opts ExtractOpts) error {
+	ar, err := openArchive(src, opts.Format)
+	if nil != err {
+		return err
+	}
+	defer ar.Close()
+	if err = os.MkdirAll(dst, os.ModePerm); nil != err {
+		return err
+	}
+	dst = filepath.Clean(dst)
+	var entries int
+	var total int64
+	var dirs []ArchiveEntry
+	for {
+		entry, r, err := ar.next()
+		if err == io.EOF {
+			break
+		}
+		if nil != err {
+			return err
+		}
+		if entries++; opts.MaxEntries > 0 && entries > opts.MaxEntries {
+			return &os.PathError{Op: "extract", Path: entry.Name, Err: ErrArchiveLimit}
+		}
+		target, err := safeArchivePath(dst, entry.Name)
+		if nil != err {
+			return err
+		}
+		switch {
+		case entry.Mode&os.ModeIrregular != 0:
+			continue
+		case entry.IsDir:
+			if target == dst {
+				continue
+			}
+			err = os.MkdirAll(target, os.ModePerm)
+			dirs = append(dirs, entry)
+		case entry.Mode&os.ModeSymlink != 0:
+			if opts.Symlinks {
+				err = extractSymlink(dst, target, entry, opts)
+			}
+		default:
+			// 已经写满MaxSize, 剩余0字节不能再交给extractFile, 那里0表示不限制
+			if opts.MaxSize > 0 && opts.MaxSize-total <= 0 {
+				return &os.PathError{Op: "extract", Path: entry.Name, Err: ErrArchiveLimit}
+			}
+			limit := opts.MaxFileSize
+			if opts.MaxSize > 0 && (limit <= 0 || opts.MaxSize-total < limit) {
+				limit = opts.MaxSize - total
+			}
+			var n int64
+			n, err = extractFile(target, entry, r, limit, opts)
+			total += n
+		}
+		if nil != err {
+			return err
+		}
+	}
+	// 文件夹的权限和时间最后设置, 避免写入内容时被修改
+	for i := len(dirs) - 1; i >= 0; i-- {
+		target := filepath.Join(dst, filepath.FromSlash(dirs[i].Name))
+		if st, err := os.Lstat(target); nil != err || !st.IsDir() {
+			continue // 已经被后面同名的条目覆盖
+		}
+		if err := os.Chmod(target, dirs[i].Mode.Perm()|0700); nil != err {
+			return err
+		}
+		if err := os.Chtimes(target, dirs[i].ModTime, dirs[i].ModTime); nil != err {
+			return err
+		}
+	}
+	return nil
+}
+
+// safeArchivePath 条目在dst中的路径, 不能超出dst, 上级路径中不能有符号链接
+func safeArchivePath(dst, name string) (string, error) {
+	clean := path.Clean("/" + name)
+	if path.IsAbs(name) || len(filepath.VolumeName(name)) > 0 || strings.HasPrefix(path.Clean(name), "../") || path.Clean(name) == ".." {
+		return "", &os.PathError{Op: "extract", Path: name, Err: ErrUnsafePath}
+	}
+	target := filepath.Join(dst, filepath.FromSlash(clean))
+	// 上级路径是符号链接时可能写到dst以外
+	for p := filepath.Dir(target); len(p) > len(dst); p = filepath.Dir(p) {
+		if st, err := os.Lstat(p); nil == err && st.Mode()&os.ModeSymlink != 0 {
+			return "", &os.PathError{Op: "extract", Path: name, Err: ErrUnsafePath}
+		}
+	}
+	return target, nil
+}
+
+// extractFile 解压一个文件, 返回写入的字节数, limit>0时限制大小
+func extractFile(target string, entry ArchiveEntry, r io.Reader, limit int64, opts ExtractOpts) (int64, error) {
+	if limit > 0 && entry.Size > limit {
+		return 0, &os.PathError{Op: "extract", Path: entry.Name, Err: ErrArchiveLimit}
+	}
+	if isExistLstat(target) {
+		if !opts.Replace {
+			if opts.Ignore {
+				return 0, nil
+			}
+			return 0, PathExist("extract", target)
+		}
+		if err := os.RemoveAll(target); nil != err {
+			return 0, err
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(target), os.ModePerm); nil != err {
+		return 0, err
+	}
+	fp, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_EXCL, entry.Mode.Perm()|0600)
+	if nil != err {
+		return 0, err
+	}
+	// 声明的大小可能不准确, 按实际读取的字节数限制
+	if limit > 0 {
+		r = io.LimitReader(r, limit+1)
+	}
+	n, err := io.Copy(fp, r)
+	if cerr := fp.Close(); nil == err {
+		err = cerr
+	}
+	if nil == err && limit > 0 && n > limit {
+		err = &os.PathError{Op: "extract", Path: entry.Name, Err: ErrArchiveLimit}
+	}
+	if nil != err {
+		os.Remove(target)
+		return n, err
+	}
+	return n, os.Chtimes(target, entry.ModTime, entry.ModTime)
+}
+
+// extractSymlink 创建符号链接, 目标必须是dst中的相对路径
+func extractSymlink(dst, target string, entry ArchiveEntry, opts ExtractOpts) error {
+	link := filepath.FromSlash(entry.Linkname)
+	resolved := filepath.Join(filepath.Dir(target), link)
+	if filepath.IsAbs(link) || len(filepath.VolumeName(link)) > 0 || (resolved != dst && !strings.HasPrefix(resolved, dst+string(filepath.Separator))) {
+		return &os.PathError{Op: "extract", Path: entry.Name, Err: ErrUnsafePath}
+	}
+	if isExistLstat(target) {
+		if !opts.Replace {
+			if opts.Ignore {
+				return nil
+			}
+			return PathExist("extract", target)
+		}
+		if err := os.RemoveAll(target); nil != err {
+			return err
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(target), os.ModePerm); nil != err {
+		return err
+	}
+	return os.Symlink(link, target)
+}
@@ -0,0 +1,181 @@
+// Copyright (C) 2019 WuPeng <wupeng364@outlook.com>.
+// Use of this source code is governed by an MIT-style.
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction,
+// including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software,
+// and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+// 文件工具-冲突处理
+// 复制或移动时目标位置已存在的处理策略, 文件夹之间总是合并, 策略作用于其中的每个文件
+
+package fstool
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// ConflictPolicy 目标位置已存在时的处理策略
+type ConflictPolicy int
+
+const (
+	// ConflictDefault 未设置, CopyOpts中按Replace/Ignore处理, 其他地方同ConflictError
+	ConflictDefault ConflictPolicy = iota
+	// ConflictError 返回ErrExist错误
+	ConflictError
+	// ConflictOverwrite 覆盖
+	ConflictOverwrite
+	// ConflictSkip 跳过
+	ConflictSkip
+	// ConflictRename 使用带序号的新名字, 如 "name (1).txt"
+	ConflictRename
+	// ConflictOverwriteNewer 源文件的修改时间比目标新时覆盖, 否则跳过
+	ConflictOverwriteNewer
+	// ConflictOverwriteDifferent 源文件与目标的大小或sha256不同时覆盖, 否则跳过
+	ConflictOverwriteDifferent
+	// ConflictAsk 对每个冲突调用ConflictOpts.Ask决定
+	ConflictAsk
+)
+
+// String 策略名称
+func (policy ConflictPolicy) String() string {
+	switch policy {
+	case ConflictDefault:
+		return "default"
+	case ConflictError:
+		return "error"
+	case ConflictOverwrite:
+		return "overwrite"
+	case ConflictSkip:
+		return "skip"
+	case ConflictRename:
+		return "rename"
+	case ConflictOverwriteNewer:
+		return "overwrite-newer"
+	case ConflictOverwriteDifferent:
+		return "overwrite-different"
+	case ConflictAsk:
+		return "ask"
+	}
+	return fmt.Sprintf("ConflictPolicy(%d)", int(policy))
+}
+
+// ConflictFunc 询问冲突的处理方式(源路径, 已存在的目标路径), 返回ConflictAsk|ConflictDefault时按ConflictError处理
+// 返回错误则终止操作
+type ConflictFunc func(src, dst string) (ConflictPolicy, error)
+
+// ConflictOpts 冲突处理选项
+type ConflictOpts struct {
+	Policy ConflictPolicy // 处理策略
+	Ask    ConflictFunc   // Policy为ConflictAsk时调用, 为nil时按ConflictError处理
+}
+
+// conflictFromFlags 把重复覆盖, 重复忽略转换为冲突策略, 覆盖优先
+func conflictFromFlags(replace, ignore bool) ConflictOpts {
+	if replace {
+		return ConflictOpts{Policy: ConflictOverwrite}
+	}
+	if ignore {
+		return ConflictOpts{Policy: ConflictSkip}
+	}
+	return ConflictOpts{Policy: ConflictError}
+}
+
+// resolve 决定已存在的目标位置如何处理, 返回ConflictOverwrite|ConflictSkip|ConflictRename|ConflictError之一
+// ConflictRename时返回新的目标路径, taken为已被占用但还不存在的路径
+func (conflict ConflictOpts) resolve(srcFS FS, src string, dstFS FS, dst string, taken map[string]bool) (ConflictPolicy, string, error) {
+	policy := conflict.Policy
+	if policy == ConflictAsk {
+		if nil == conflict.Ask {
+			return ConflictError, dst, nil
+		}
+		var err error
+		if policy, err = conflict.Ask(src, dst); nil != err {
+			return ConflictError, dst, err
+		}
+	}
+	switch policy {
+	case ConflictOverwrite, ConflictSkip:
+		return policy, dst, nil
+	case ConflictRename:
+		return policy, uniqueName(dstFS, dst, taken), nil
+	case ConflictOverwriteNewer:
+		newer, err := isNewer(srcFS, src, dstFS, dst)
+		if nil != err || !newer {
+			return ConflictSkip, dst, err
+		}
+		return ConflictOverwrite, dst, nil
+	case ConflictOverwriteDifferent:
+		same, err := isSameContent(srcFS, src, dstFS, dst)
+		if nil != err || same {
+			return ConflictSkip, dst, err
+		}
+		return ConflictOverwrite, dst, nil
+	}
+	return ConflictError, dst, nil
+}
+
+// uniqueName 生成不存在的路径 "name (n).ext", 以点开头且没有其他点的文件名没有扩展名
+func uniqueName(fsys FS, dst string, taken map[string]bool) string {
+	dir, name := filepath.Split(dst)
+	ext := filepath.Ext(name)
+	if ext == name {
+		ext = ""
+	}
+	base := strings.TrimSuffix(name, ext)
+	for i := 1; ; i++ {
+		target := filepath.Join(dir, fmt.Sprintf("%s (%d)%s", base, i, ext))
+		if !taken[target] && !existFS(fsys, target) {
+			return target
+		}
+	}
+}
+
+// isExistLstat 路径是否存在, 不跟随符号链接
+func isExistLstat(path string) bool {
+	return existFS(osfs, path)
+}
+
+// isNewer 源文件的修改时间是否比目标新
+func isNewer(srcFS FS, src string, dstFS FS, dst string) (bool, error) {
+	srcSt, err := srcFS.Stat(src)
+	if nil != err {
+		return false, err
+	}
+	dstSt, err := dstFS.Stat(dst)
+	if nil != err {
+		return false, err
+	}
+	return srcSt.ModTime().After(dstSt.ModTime()), nil
+}
+
+// isSameContent 源文件与目标的类型, 大小和sha256是否一致
+func isSameContent(srcFS FS, src string, dstFS FS, dst string) (bool, error) {
+	srcSt, err := srcFS.Stat(src)
+	if nil != err {
+		return false, err
+	}
+	dstSt, err := dstFS.Stat(dst)
+	if nil != err {
+		return false, err
+	}
+	if srcSt.IsDir() || dstSt.IsDir() {
+		return srcSt.IsDir() && dstSt.IsDir(), nil
+	}
+	if srcSt.Size() != dstSt.Size() {
+		return false, nil
+	}
+	srcSum, err := HashFileFS(srcFS, src)
+	if nil != err {
+		return false, err
+	}
+	dstSum, err := HashFileFS(dstFS, dst)
+	if nil != err {
+		return false, err
+	}
+	return bytes.Equal(srcSum, dstSum), nil
+}
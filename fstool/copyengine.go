@@ -0,0 +1,452 @@
+// Copyright (C) 2019 WuPeng <wupeng364@outlook.com>.
+// Use of this source code is governed by an MIT-style.
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction,
+// including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software,
+// and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+// 文件工具-并发复制
+// 先遍历源目录生成复制计划, 再按顺序创建文件夹, 文件交给多个worker并发复制
+// 复制过程中按字节报告进度, 可以通过context取消
+
+package fstool
+
+import (
+	"context"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// CopyAction 计划中的操作
+type CopyAction string
+
+const (
+	// CopyActionMkdir 创建文件夹
+	CopyActionMkdir CopyAction = "mkdir"
+	// CopyActionCopy 复制文件
+	CopyActionCopy CopyAction = "copy"
+	// CopyActionReplace 覆盖已存在的文件, 或删除同名的文件后创建文件夹
+	CopyActionReplace CopyAction = "replace"
+	// CopyActionSkip 目标已存在, 忽略, 文件夹则忽略其中的所有内容
+	CopyActionSkip CopyAction = "skip"
+	// CopyActionConflict 目标已存在, 既不覆盖也不忽略, 执行时报错
+	CopyActionConflict CopyAction = "conflict"
+)
+
+// CopyOp 复制计划中的一项
+type CopyOp struct {
+	Src     string
+	Dst     string
+	IsDir   bool
+	Symlink bool // 复制为符号链接
+	Size    int64
+	Action  CopyAction
+}
+
+// CopyProgress 复制进度
+type CopyProgress struct {
+	TotalFiles  int64         // 需要复制的文件数
+	CopiedFiles int64         // 已完成的文件数
+	TotalBytes  int64         // 需要复制的字节数
+	CopiedBytes int64         // 已复制的字节数
+	Rate        float64       // 速度, 字节每秒
+	ETA         time.Duration // 预计剩余时间, 速度为0时为-1
+	Elapsed     time.Duration // 已用时间
+	Done        bool          // 是否是结束时的最后一次报告
+}
+
+// CopyOpts 复制选项
+type CopyOpts struct {
+	Replace          bool                 // 重复覆盖
+	Ignore           bool                 // 重复忽略
+	Conflict         ConflictOpts         // 冲突处理策略, 设置后忽略Replace和Ignore
+	Workers          int                  // 同时复制的文件数, 默认4
+	BufferSize       int                  // 每个文件的复制缓冲区, 默认1MB
+	DryRun           bool                 // 只生成复制计划, 不执行
+	Atomic           bool                 // 先写入同目录下的临时文件, 完成后重命名, 不会出现只复制了一半的目标文件
+	Resume           bool                 // 保留未完成的临时文件, 下次从校验一致的位置继续复制, 包含Atomic
+	Verify           bool                 // 复制完成后校验大小和sha256, 不一致时返回ErrVerifyFailed
+	Walk             WalkOpts             // 遍历源目录的选项, 可以过滤文件
+	Preserve         PreserveOpts         // 保留的元数据, 不保留符号链接时跟随链接复制内容
+	Progress         func(p CopyProgress) // 进度回调, 在单独的goroutine中调用
+	ProgressInterval time.Duration        // 进度回调间隔, 默认200毫秒
+	Callback         CopyCallback         // 每个文件|夹完成或遍历源文件夹出错后回调, 返回错误则终止, 为nil时出错即终止
+}
+
+// CopyTree 复制文件|夹(源路径, 目标路径, 选项), 返回复制计划
+// 同一时间只有一个Callback在执行, 文件的完成顺序与计划中的顺序不一定一致
+func CopyTree(ctx context.Context, src, dst string, opts CopyOpts) ([]CopyOp, error) {
+	src = filepath.Clean(src)
+	dst = filepath.Clean(dst)
+	if src == dst {
+		return nil, nil
+	}
+	plan, err := PlanCopy(src, dst, opts)
+	if nil != err || opts.DryRun {
+		return plan, err
+	}
+	return plan, newCopyEngine(opts).run(ctx, plan)
+}
+
+// PlanCopy 生成复制计划, 文件夹在其内容之前
+// 目标位置已存在时按冲突策略决定操作, 文件夹之间合并, ConflictAsk在生成计划时询问
+func PlanCopy(src, dst string, opts CopyOpts) ([]CopyOp, error) {
+	st, err := os.Stat(src)
+	if nil != err {
+		return nil, PathNotExist("CopyTree", src)
+	}
+	planner := &copyPlanner{opts: opts, conflict: opts.Conflict, taken: make(map[string]bool)}
+	if planner.conflict.Policy == ConflictDefault {
+		planner.conflict = conflictFromFlags(opts.Replace, opts.Ignore)
+	}
+	if !st.IsDir() {
+		op, err := planner.file(src, dst, st.Size())
+		if lst, lerr := os.Lstat(src); nil == lerr && lst.Mode()&os.ModeSymlink != 0 && opts.Preserve.Symlinks {
+			op.Symlink, op.Size = true, 0
+		}
+		return []CopyOp{op}, err
+	}
+	root, err := planner.dir(src, dst)
+	if nil != err || root.Action == CopyActionSkip || root.Action == CopyActionConflict {
+		if root.Action == CopyActionConflict {
+			err = PathExist("CopyTree", dst)
+		}
+		return []CopyOp{root}, err
+	}
+	walkOpts := opts.Walk
+	if !opts.Preserve.Symlinks && walkOpts.Symlinks == SymlinkNoFollow {
+		walkOpts.Symlinks = SymlinkFollow
+	}
+	// 相对路径的文件夹对应的目标路径, 文件夹可能被重命名
+	dirs := map[string]string{".": root.Dst}
+	plan := []CopyOp{root}
+	err = Walk(src, walkOpts, func(entry WalkEntry, err error) error {
+		target := filepath.Join(dirs[path.Dir(entry.RelPath)], entry.Name)
+		if nil != err {
+			// 无法读取的源文件|夹交给Callback决定是否继续, 返回nil时跳过
+			if nil != opts.Callback {
+				err = opts.Callback(entry.Path, target, err)
+			}
+			return err
+		}
+		if entry.IsDir {
+			op, err := planner.dir(entry.Path, target)
+			if nil != err {
+				return err
+			}
+			plan = append(plan, op)
+			if op.Action == CopyActionSkip || op.Action == CopyActionConflict {
+				return SkipDir
+			}
+			dirs[entry.RelPath] = op.Dst
+			return nil
+		}
+		size := entry.Size
+		if entry.Symlink && walkOpts.Symlinks == SymlinkNoFollow {
+			size = 0
+		}
+		op, err := planner.file(entry.Path, target, size)
+		op.Symlink = entry.Symlink && walkOpts.Symlinks == SymlinkNoFollow
+		plan = append(plan, op)
+		return err
+	})
+	return plan, err
+}
+
+// copyPlanner 生成复制计划时处理冲突
+type copyPlanner struct {
+	opts     CopyOpts
+	conflict ConflictOpts
+	taken    map[string]bool // 重命名后计划使用的路径
+}
+
+// file 根据目标是否存在决定文件的操作
+func (planner *copyPlanner) file(src, dst string, size int64) (CopyOp, error) {
+	op := CopyOp{Src: src, Dst: dst, Size: size, Action: CopyActionCopy}
+	if !isExistLstat(dst) {
+		return op, nil
+	}
+	return planner.resolve(op)
+}
+
+// dir 根据目标是否存在决定文件夹的操作, 已存在的文件夹直接合并
+func (planner *copyPlanner) dir(src, dst string) (CopyOp, error) {
+	op := CopyOp{Src: src, Dst: dst, IsDir: true, Action: CopyActionMkdir}
+	if !isExistLstat(dst) || IsDir(dst) {
+		return op, nil
+	}
+	return planner.resolve(op)
+}
+
+// resolve 按冲突策略设置操作
+func (planner *copyPlanner) resolve(op CopyOp) (CopyOp, error) {
+	policy, target, err := planner.conflict.resolve(osfs, op.Src, osfs, op.Dst, planner.taken)
+	switch policy {
+	case ConflictOverwrite:
+		op.Action = CopyActionReplace
+	case ConflictSkip:
+		op.Action = CopyActionSkip
+	case ConflictRename:
+		planner.taken[target] = true
+		op.Dst = target
+		if !op.IsDir {
+			op.Action = CopyActionCopy
+		}
+	default:
+		op.Action = CopyActionConflict
+	}
+	return op, err
+}
+
+// copyEngine 执行复制计划
+type copyEngine struct {
+	opts        CopyOpts
+	totalFiles  int64
+	totalBytes  int64
+	copiedFiles int64       // atomic
+	copiedBytes int64       // atomic
+	cl          *sync.Mutex // 保证Callback串行执行
+}
+
+// newCopyEngine 创建复制引擎, 填充默认值
+func newCopyEngine(opts CopyOpts) *copyEngine {
+	if opts.Workers <= 0 {
+		opts.Workers = 4
+	}
+	if opts.BufferSize <= 0 {
+		opts.BufferSize = 1 << 20
+	}
+	if opts.ProgressInterval <= 0 {
+		opts.ProgressInterval = 200 * time.Millisecond
+	}
+	return &copyEngine{opts: opts, cl: new(sync.Mutex)}
+}
+
+// run 按计划复制
+func (engine *copyEngine) run(ctx context.Context, plan []CopyOp) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	files := make([]CopyOp, 0, len(plan))
+	for _, op := range plan {
+		if !op.IsDir && op.Action != CopyActionSkip {
+			engine.totalFiles++
+			engine.totalBytes += op.Size
+		}
+	}
+	stopProgress := engine.reportProgress()
+	defer stopProgress()
+
+	// 文件夹按顺序创建
+	for _, op := range plan {
+		if !op.IsDir {
+			files = append(files, op)
+			continue
+		}
+		if err := ctx.Err(); nil != err {
+			return err
+		}
+		if err := engine.callback(op, engine.mkdir(op)); nil != err {
+			return err
+		}
+	}
+
+	// 文件并发复制
+	var firstErr error
+	var el sync.Mutex
+	fail := func(err error) {
+		el.Lock()
+		if nil == firstErr {
+			firstErr = err
+		}
+		el.Unlock()
+		cancel()
+	}
+	jobs := make(chan CopyOp)
+	var wg sync.WaitGroup
+	for i := 0; i < engine.opts.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			buf := make([]byte, engine.opts.BufferSize)
+			for op := range jobs {
+				err := engine.copyFile(ctx, op, buf)
+				if nil != ctx.Err() {
+					continue // 已取消, 不再回调
+				}
+				if err = engine.callback(op, err); nil != err {
+					fail(err)
+				}
+			}
+		}()
+	}
+	for _, op := range files {
+		if nil != ctx.Err() {
+			break
+		}
+		select {
+		case jobs <- op:
+		case <-ctx.Done():
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	if nil != firstErr {
+		return firstErr
+	}
+	if err := ctx.Err(); nil != err {
+		return err
+	}
+	// 文件夹的元数据最后倒序处理, 避免复制内容时修改时间被改变或只读文件夹无法写入
+	if engine.opts.Preserve != (PreserveOpts{}) {
+		for i := len(plan) - 1; i >= 0; i-- {
+			if plan[i].IsDir && plan[i].Action != CopyActionSkip {
+				if err := CopyMetadata(plan[i].Src, plan[i].Dst, engine.opts.Preserve); nil != err {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// mkdir 创建计划中的文件夹
+func (engine *copyEngine) mkdir(op CopyOp) error {
+	switch op.Action {
+	case CopyActionSkip:
+		return nil
+	case CopyActionConflict:
+		return PathExist("CopyTree", op.Dst)
+	case CopyActionReplace:
+		if !IsDir(op.Dst) {
+			if err := os.RemoveAll(op.Dst); nil != err {
+				return err
+			}
+		}
+	}
+	if IsDir(op.Dst) {
+		return nil
+	}
+	if isExistLstat(op.Dst) {
+		return PathExist("CopyTree", op.Dst)
+	}
+	return os.Mkdir(op.Dst, os.ModePerm)
+}
+
+// copyFile 复制一个文件, 取消时删除未复制完的目标文件
+func (engine *copyEngine) copyFile(ctx context.Context, op CopyOp, buf []byte) error {
+	if op.Action == CopyActionSkip {
+		return nil
+	}
+	if isExistLstat(op.Dst) {
+		if op.Action != CopyActionReplace {
+			return PathExist("CopyTree", op.Dst)
+		}
+		// 写入临时文件时, 目标文件在重命名时被替换
+		if op.Symlink || IsDir(op.Dst) || !(engine.opts.Atomic || engine.opts.Resume) {
+			if err := os.RemoveAll(op.Dst); nil != err {
+				return err
+			}
+		}
+	}
+	if op.Symlink {
+		if err := copySymlink(op.Src, op.Dst); nil != err {
+			return err
+		}
+		atomic.AddInt64(&engine.copiedFiles, 1)
+		return CopyMetadata(op.Src, op.Dst, engine.opts.Preserve)
+	}
+	if err := copyFileData(ctx, op.Src, op.Dst, engine.opts, buf, &engine.copiedBytes); nil != err {
+		return err
+	}
+	atomic.AddInt64(&engine.copiedFiles, 1)
+	if engine.opts.Preserve != (PreserveOpts{}) {
+		return CopyMetadata(op.Src, op.Dst, engine.opts.Preserve)
+	}
+	return nil
+}
+
+// callback 串行执行回调, 没有设置回调时直接返回错误
+func (engine *copyEngine) callback(op CopyOp, err error) error {
+	if nil == engine.opts.Callback {
+		return err
+	}
+	engine.cl.Lock()
+	defer engine.cl.Unlock()
+	return engine.opts.Callback(op.Src, op.Dst, err)
+}
+
+// reportProgress 定时报告进度, 返回的函数用于结束并做最后一次报告
+func (engine *copyEngine) reportProgress() func() {
+	if nil == engine.opts.Progress {
+		return func() {}
+	}
+	start := time.Now()
+	done := make(chan struct{})
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		ticker := time.NewTicker(engine.opts.ProgressInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				engine.opts.Progress(engine.progress(start, false))
+			case <-done:
+				engine.opts.Progress(engine.progress(start, true))
+				return
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-finished
+	}
+}
+
+// progress 计算当前进度
+func (engine *copyEngine) progress(start time.Time, isDone bool) CopyProgress {
+	p := CopyProgress{
+		TotalFiles:  engine.totalFiles,
+		CopiedFiles: atomic.LoadInt64(&engine.copiedFiles),
+		TotalBytes:  engine.totalBytes,
+		CopiedBytes: atomic.LoadInt64(&engine.copiedBytes),
+		Elapsed:     time.Since(start),
+		ETA:         -1,
+		Done:        isDone,
+	}
+	if p.Elapsed > 0 {
+		p.Rate = float64(p.CopiedBytes) / p.Elapsed.Seconds()
+	}
+	if p.Rate > 0 {
+		remaining := p.TotalBytes - p.CopiedBytes
+		if remaining < 0 {
+			remaining = 0
+		}
+		p.ETA = time.Duration(float64(remaining) / p.Rate * float64(time.Second))
+	}
+	return p
+}
+
+// progressReader 统计读取的字节数, 取消后停止读取
+type progressReader struct {
+	ctx context.Context
+	r   io.Reader
+	n   *int64
+}
+
+// Read 读取并累计字节数
+func (pr *progressReader) Read(p []byte) (int, error) {
+	if err := pr.ctx.Err(); nil != err {
+		return 0, err
+	}
+	n, err := pr.r.Read(p)
+	atomic.AddInt64(pr.n, int64(n))
+	return n, err
+}
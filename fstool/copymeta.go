@@ -0,0 +1,72 @@
+// Copyright (C) 2019 WuPeng <wupeng364@outlook.com>.
+// Use of this source code is governed by an MIT-style.
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction,
+// including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software,
+// and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+// 文件工具-复制元数据
+// 权限和修改时间所有平台都支持, 访问时间、所有者和扩展属性只在Linux下处理
+
+package fstool
+
+import (
+	"os"
+)
+
+// PreserveOpts 复制时保留的元数据
+type PreserveOpts struct {
+	Mode     bool // 权限位, 包括setuid/setgid/sticky
+	Times    bool // 访问时间和修改时间
+	Owner    bool // 所有者uid/gid, 没有权限时忽略
+	Xattrs   bool // 扩展属性, 文件系统不支持或没有权限时忽略
+	Symlinks bool // 符号链接复制为符号链接, 否则复制链接指向的内容
+}
+
+// PreserveAll 保留所有元数据
+var PreserveAll = PreserveOpts{Mode: true, Times: true, Owner: true, Xattrs: true, Symlinks: true}
+
+// CopyMetadata 把src的元数据复制到dst, 符号链接只复制所有者
+func CopyMetadata(src, dst string, preserve PreserveOpts) error {
+	st, err := os.Lstat(src)
+	if nil != err {
+		return err
+	}
+	isLink := st.Mode()&os.ModeSymlink != 0
+	// 先修改所有者, chown会清除setuid/setgid
+	if preserve.Owner {
+		if err = copyOwner(st, dst); nil != err {
+			return err
+		}
+	}
+	if isLink {
+		return nil
+	}
+	if preserve.Xattrs {
+		if err = copyXattrs(src, dst); nil != err {
+			return err
+		}
+	}
+	if preserve.Mode {
+		if err = os.Chmod(dst, st.Mode()&(os.ModePerm|os.ModeSetuid|os.ModeSetgid|os.ModeSticky)); nil != err {
+			return err
+		}
+	}
+	if preserve.Times {
+		if err = os.Chtimes(dst, accessTime(st), st.ModTime()); nil != err {
+			return err
+		}
+	}
+	return nil
+}
+
+// copySymlink 复制符号链接本身
+func copySymlink(src, dst string) error {
+	target, err := os.Readlink(src)
+	if nil != err {
+		return err
+	}
+	return os.Symlink(target, dst)
+}
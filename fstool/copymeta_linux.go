@@ -0,0 +1,80 @@
+// Copyright (C) 2019 WuPeng <wupeng364@outlook.com>.
+// Use of this source code is governed by an MIT-style.
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction,
+// including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software,
+// and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+// 文件工具-复制元数据, Linux实现
+
+package fstool
+
+import (
+	"os"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// accessTime 访问时间
+func accessTime(st os.FileInfo) time.Time {
+	if sys, ok := st.Sys().(*syscall.Stat_t); ok {
+		return time.Unix(int64(sys.Atim.Sec), int64(sys.Atim.Nsec))
+	}
+	return st.ModTime()
+}
+
+// copyOwner 复制所有者, 没有权限时忽略
+func copyOwner(st os.FileInfo, dst string) error {
+	sys, ok := st.Sys().(*syscall.Stat_t)
+	if !ok {
+		return nil
+	}
+	err := os.Lchown(dst, int(sys.Uid), int(sys.Gid))
+	if nil != err && os.IsPermission(err) {
+		return nil
+	}
+	return err
+}
+
+// copyXattrs 复制扩展属性, 不支持或没有权限时忽略
+func copyXattrs(src, dst string) error {
+	size, err := syscall.Listxattr(src, nil)
+	if nil != err || size == 0 {
+		return ignoreXattrError(err)
+	}
+	buf := make([]byte, size)
+	if size, err = syscall.Listxattr(src, buf); nil != err {
+		return ignoreXattrError(err)
+	}
+	for _, name := range strings.Split(strings.TrimRight(string(buf[:size]), "\x00"), "\x00") {
+		if len(name) == 0 {
+			continue
+		}
+		vsize, err := syscall.Getxattr(src, name, nil)
+		if nil != err {
+			if err = ignoreXattrError(err); nil != err {
+				return err
+			}
+			continue
+		}
+		value := make([]byte, vsize)
+		if vsize, err = syscall.Getxattr(src, name, value); nil == err {
+			err = syscall.Setxattr(dst, name, value[:vsize], 0)
+		}
+		if err = ignoreXattrError(err); nil != err {
+			return &os.PathError{Op: "setxattr", Path: dst, Err: err}
+		}
+	}
+	return nil
+}
+
+// ignoreXattrError 忽略不支持和没有权限的错误
+func ignoreXattrError(err error) error {
+	if err == syscall.ENOTSUP || err == syscall.EOPNOTSUPP || err == syscall.EPERM || err == syscall.EACCES || err == syscall.ENODATA {
+		return nil
+	}
+	return err
+}
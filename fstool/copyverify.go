@@ -0,0 +1,196 @@
+// Copyright (C) 2019 WuPeng <wupeng364@outlook.com>.
+// Use of this source code is governed by an MIT-style.
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction,
+// including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software,
+// and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+// 文件工具-可续传和校验的文件复制
+// 续传时未完成的内容保存在目标目录下的 .名称.partial 文件中, 与源文件相同长度的前缀校验一致才继续
+
+package fstool
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+)
+
+// ErrVerifyFailed 复制后校验不一致
+var ErrVerifyFailed = errors.New("copy verification failed")
+
+// PartialPath 续传时未完成的临时文件路径
+func PartialPath(dst string) string {
+	return filepath.Join(filepath.Dir(dst), "."+filepath.Base(dst)+".partial")
+}
+
+// HashFile 计算文件的sha256
+func HashFile(path string) ([]byte, error) {
+	fp, err := OpenFile(path)
+	if nil != err {
+		return nil, err
+	}
+	defer fp.Close()
+	return hashReader(fp)
+}
+
+// hashReader 计算读取内容的sha256
+func hashReader(r io.Reader) ([]byte, error) {
+	h := sha256.New()
+	if _, err := io.Copy(h, r); nil != err {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+// copyFileData 复制文件内容, 按选项写入临时文件、续传和校验, counter累计复制的字节数
+func copyFileData(ctx context.Context, src, dst string, opts CopyOpts, buf []byte, counter *int64) error {
+	rsrc, err := OpenFile(src)
+	if nil != err {
+		return err
+	}
+	defer rsrc.Close()
+	srcInfo, err := rsrc.Stat()
+	if nil != err {
+		return err
+	}
+	var h hash.Hash
+	if opts.Verify {
+		h = sha256.New()
+	}
+
+	// 确定写入的位置
+	var wdst *os.File
+	var offset int64
+	if opts.Resume {
+		if offset, err = resumeOffset(rsrc, PartialPath(dst), srcInfo.Size(), h); nil != err {
+			return err
+		}
+		if wdst, err = os.OpenFile(PartialPath(dst), os.O_WRONLY|os.O_CREATE, 0666); nil == err {
+			if err = wdst.Truncate(offset); nil == err {
+				_, err = wdst.Seek(offset, io.SeekStart)
+			}
+		}
+	} else if opts.Atomic {
+		if wdst, err = createTemp(filepath.Dir(dst), "."+filepath.Base(dst)+".", ".tmp"); nil == err {
+			// 与直接创建的目标文件权限一致, 需要保留源文件权限时由元数据复制覆盖
+			err = wdst.Chmod(defaultFilePerm())
+		}
+	} else {
+		wdst, err = os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
+	}
+	if nil != err {
+		if nil != wdst {
+			wdst.Close()
+		}
+		return err
+	}
+	target := wdst.Name()
+	atomic.AddInt64(counter, offset)
+
+	var reader io.Reader = &progressReader{ctx: ctx, r: rsrc, n: counter}
+	if nil != h {
+		reader = io.TeeReader(reader, h)
+	}
+	_, err = io.CopyBuffer(wdst, reader, buf)
+	if nil == err && target != dst {
+		err = wdst.Sync()
+	}
+	if closeErr := wdst.Close(); nil == err {
+		err = closeErr
+	}
+	if nil == err && nil != h {
+		err = verifyFile(target, srcInfo.Size(), h.Sum(nil))
+	}
+	if nil != err {
+		// 续传时只有校验失败才丢弃已复制的内容
+		if !opts.Resume || err == ErrVerifyFailed {
+			os.Remove(target)
+		}
+		return err
+	}
+	if target != dst {
+		if err = os.Rename(target, dst); nil != err {
+			os.Remove(target)
+		}
+	}
+	return err
+}
+
+// resumeOffset 校验未完成文件与源文件相同长度的前缀, 一致时返回续传位置, rsrc定位到该位置
+// h不为空时写入源文件前缀的内容, 用于复制完成后的校验
+func resumeOffset(rsrc *os.File, partial string, srcSize int64, h hash.Hash) (int64, error) {
+	st, err := os.Stat(partial)
+	if nil != err || st.Size() == 0 || st.Size() > srcSize {
+		return 0, nil
+	}
+	size := st.Size()
+	partialHash, err := hashPrefix(partial, size)
+	if nil != err {
+		return 0, nil
+	}
+	srcHash := sha256.New()
+	writers := []io.Writer{srcHash}
+	if nil != h {
+		writers = append(writers, h)
+	}
+	if _, err = io.CopyN(io.MultiWriter(writers...), rsrc, size); nil != err {
+		return 0, err
+	}
+	if bytes.Equal(srcHash.Sum(nil), partialHash) {
+		return size, nil
+	}
+	// 内容不一致, 从头开始
+	if nil != h {
+		h.Reset()
+	}
+	_, err = rsrc.Seek(0, io.SeekStart)
+	return 0, err
+}
+
+// hashPrefix 计算文件前size个字节的sha256
+func hashPrefix(path string, size int64) ([]byte, error) {
+	fp, err := OpenFile(path)
+	if nil != err {
+		return nil, err
+	}
+	defer fp.Close()
+	h := sha256.New()
+	if _, err = io.CopyN(h, fp, size); nil != err {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+// verifyFile 校验文件大小和sha256
+func verifyFile(path string, size int64, sum []byte) error {
+	st, err := os.Stat(path)
+	if nil != err {
+		return err
+	}
+	if st.Size() != size {
+		return ErrVerifyFailed
+	}
+	res, err := HashFile(path)
+	if nil != err {
+		return err
+	}
+	if !bytes.Equal(res, sum) {
+		return ErrVerifyFailed
+	}
+	return nil
+}
+
+// createTemp 在dir下创建名称为 prefix+随机字符串+suffix 的新文件, 权限为0600
+// 需要其他权限时由调用方在写入完成后设置, 避免写入过程中其他用户读到内容
+func createTemp(dir, prefix, suffix string) (*os.File, error) {
+	return os.CreateTemp(dir, prefix+"*"+suffix)
+}
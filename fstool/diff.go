@@ -0,0 +1,275 @@
+// Copyright (C) 2019 WuPeng <wupeng364@outlook.com>.
+// Use of this source code is governed by an MIT-style.
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction,
+// including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software,
+// and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+// 文件工具-目录比较与重复文件查找
+// 比较两个文件夹的差异, 查找内容相同的文件; 需要计算sha256时多个文件并发计算
+
+package fstool
+
+import (
+	"context"
+	"encoding/hex"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DiffKind 差异类型
+type DiffKind string
+
+const (
+	// DiffAdded 新增
+	DiffAdded DiffKind = "added"
+	// DiffRemoved 删除
+	DiffRemoved DiffKind = "removed"
+	// DiffModified 修改, 包括文件与文件夹互相替换
+	DiffModified DiffKind = "modified"
+)
+
+// CompareMode 判断文件是否修改的方式
+type CompareMode int
+
+const (
+	// CompareSizeTime 比较大小和修改时间
+	CompareSizeTime CompareMode = iota
+	// CompareHash 比较大小和sha256, 忽略修改时间
+	CompareHash
+)
+
+// DiffEntry 一项差异
+type DiffEntry struct {
+	Path       string   // 相对路径, 使用'/'分隔
+	Kind       DiffKind // 差异类型
+	IsDir      bool     // 是否是文件夹, 修改时为新的类型
+	OldSize    int64
+	NewSize    int64
+	OldModTime time.Time
+	NewModTime time.Time
+}
+
+// DiffOpts 比较选项
+type DiffOpts struct {
+	Compare       CompareMode   // 判断修改的方式
+	Walk          WalkOpts      // 遍历选项, 两边使用相同的过滤规则
+	Workers       int           // 并发计算sha256的文件数, 默认4
+	TimeTolerance time.Duration // 修改时间相差不超过该值视为相同, 如FAT文件系统为2秒
+}
+
+// DiffDirs 比较两个文件夹, 返回按路径排序的差异
+// 新增或删除的文件夹中的内容也会逐项列出
+func DiffDirs(ctx context.Context, oldDir, newDir string, opts DiffOpts) ([]DiffEntry, error) {
+	diffs, _, _, err := diffDirs(ctx, oldDir, newDir, opts, false)
+	return diffs, err
+}
+
+// diffDirs 比较两个文件夹, 同时返回两边的遍历结果, oldMissing为true时旧文件夹可以不存在
+func diffDirs(ctx context.Context, oldDir, newDir string, opts DiffOpts, oldMissing bool) ([]DiffEntry, map[string]WalkEntry, map[string]WalkEntry, error) {
+	oldEntries := make(map[string]WalkEntry)
+	if !oldMissing || IsExist(oldDir) {
+		var err error
+		if oldEntries, err = collectEntries(ctx, oldDir, opts.Walk); nil != err {
+			return nil, nil, nil, err
+		}
+	}
+	newEntries, err := collectEntries(ctx, newDir, opts.Walk)
+	if nil != err {
+		return nil, nil, nil, err
+	}
+	var diffs []DiffEntry
+	var hashPairs []DiffEntry // 大小相同, 需要比较内容
+	for rel, newEntry := range newEntries {
+		oldEntry, ok := oldEntries[rel]
+		if !ok {
+			diffs = append(diffs, DiffEntry{Path: rel, Kind: DiffAdded, IsDir: newEntry.IsDir, NewSize: newEntry.Size, NewModTime: newEntry.ModTime})
+			continue
+		}
+		diff := DiffEntry{Path: rel, Kind: DiffModified, IsDir: newEntry.IsDir,
+			OldSize: oldEntry.Size, NewSize: newEntry.Size, OldModTime: oldEntry.ModTime, NewModTime: newEntry.ModTime}
+		switch {
+		case oldEntry.IsDir != newEntry.IsDir || oldEntry.Symlink != newEntry.Symlink:
+			diffs = append(diffs, diff)
+		case newEntry.IsDir:
+		case oldEntry.Size != newEntry.Size:
+			diffs = append(diffs, diff)
+		case opts.Compare == CompareHash && !newEntry.Symlink:
+			hashPairs = append(hashPairs, diff)
+		case !withinTolerance(oldEntry.ModTime, newEntry.ModTime, opts.TimeTolerance):
+			diffs = append(diffs, diff)
+		}
+	}
+	for rel, oldEntry := range oldEntries {
+		if _, ok := newEntries[rel]; !ok {
+			diffs = append(diffs, DiffEntry{Path: rel, Kind: DiffRemoved, IsDir: oldEntry.IsDir, OldSize: oldEntry.Size, OldModTime: oldEntry.ModTime})
+		}
+	}
+	if len(hashPairs) > 0 {
+		paths := make([]string, 0, 2*len(hashPairs))
+		for _, pair := range hashPairs {
+			paths = append(paths, oldEntries[pair.Path].Path, newEntries[pair.Path].Path)
+		}
+		sums, err := hashFiles(ctx, paths, opts.Workers)
+		if nil != err {
+			return nil, nil, nil, err
+		}
+		for _, pair := range hashPairs {
+			if sums[oldEntries[pair.Path].Path] != sums[newEntries[pair.Path].Path] {
+				diffs = append(diffs, pair)
+			}
+		}
+	}
+	sort.Slice(diffs, func(i, j int) bool { return diffs[i].Path < diffs[j].Path })
+	return diffs, oldEntries, newEntries, nil
+}
+
+// collectEntries 遍历文件夹, 按相对路径索引
+func collectEntries(ctx context.Context, dir string, opts WalkOpts) (map[string]WalkEntry, error) {
+	entries := make(map[string]WalkEntry)
+	err := Walk(dir, opts, func(entry WalkEntry, err error) error {
+		if nil != err {
+			return err
+		}
+		if err = ctx.Err(); nil != err {
+			return err
+		}
+		entries[entry.RelPath] = entry
+		return nil
+	})
+	return entries, err
+}
+
+// withinTolerance 两个时间是否在误差范围内
+func withinTolerance(a, b time.Time, tolerance time.Duration) bool {
+	d := a.Sub(b)
+	if d < 0 {
+		d = -d
+	}
+	return d <= tolerance
+}
+
+// hashFiles 并发计算文件的sha256, 返回路径对应的十六进制摘要
+func hashFiles(ctx context.Context, paths []string, workers int) (map[string]string, error) {
+	if workers <= 0 {
+		workers = 4
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	sums := make(map[string]string, len(paths))
+	var firstErr error
+	var l sync.Mutex
+	jobs := make(chan string)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for file := range jobs {
+				sum, err := HashFile(file)
+				l.Lock()
+				if nil != err && nil == firstErr {
+					firstErr = err
+					cancel()
+				}
+				sums[file] = hex.EncodeToString(sum)
+				l.Unlock()
+			}
+		}()
+	}
+	for _, file := range paths {
+		if nil != ctx.Err() {
+			break
+		}
+		select {
+		case jobs <- file:
+		case <-ctx.Done():
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	if nil != firstErr {
+		return nil, firstErr
+	}
+	return sums, ctx.Err()
+}
+
+// DupOpts 重复文件查找选项
+type DupOpts struct {
+	Walk    WalkOpts // 遍历选项, 符号链接和非普通文件总是跳过
+	Workers int      // 并发计算sha256的文件数, 默认4
+	MinSize int64    // 小于该大小的文件不参与比较, 默认只跳过空文件
+}
+
+// DupGroup 一组内容相同的文件
+type DupGroup struct {
+	Size  int64    // 文件大小
+	Hash  string   // sha256, 十六进制
+	Paths []string // 文件路径, 已排序
+}
+
+// FindDuplicates 在多个文件夹中查找内容相同的文件
+// 先按大小分组, 只对大小相同的文件计算sha256; 结果按文件大小从大到小排序
+func FindDuplicates(ctx context.Context, opts DupOpts, roots ...string) ([]DupGroup, error) {
+	minSize := opts.MinSize
+	if minSize <= 0 {
+		minSize = 1
+	}
+	bySize := make(map[int64][]string)
+	seen := make(map[string]bool) // 多个起点重叠时避免重复统计
+	for _, root := range roots {
+		err := Walk(root, opts.Walk, func(entry WalkEntry, err error) error {
+			if nil != err {
+				return err
+			}
+			if err = ctx.Err(); nil != err {
+				return err
+			}
+			if entry.IsDir || !entry.Mode.IsRegular() || entry.Size < minSize || seen[entry.Path] {
+				return nil
+			}
+			seen[entry.Path] = true
+			bySize[entry.Size] = append(bySize[entry.Size], entry.Path)
+			return nil
+		})
+		if nil != err {
+			return nil, err
+		}
+	}
+	var candidates []string
+	for _, paths := range bySize {
+		if len(paths) > 1 {
+			candidates = append(candidates, paths...)
+		}
+	}
+	sums, err := hashFiles(ctx, candidates, opts.Workers)
+	if nil != err {
+		return nil, err
+	}
+	var groups []DupGroup
+	for size, paths := range bySize {
+		if len(paths) < 2 {
+			continue
+		}
+		byHash := make(map[string][]string)
+		for _, file := range paths {
+			byHash[sums[file]] = append(byHash[sums[file]], file)
+		}
+		for hash, same := range byHash {
+			if len(same) > 1 {
+				sort.Strings(same)
+				groups = append(groups, DupGroup{Size: size, Hash: hash, Paths: same})
+			}
+		}
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		if groups[i].Size != groups[j].Size {
+			return groups[i].Size > groups[j].Size
+		}
+		return groups[i].Paths[0] < groups[j].Paths[0]
+	})
+	return groups, nil
+}
@@ -0,0 +1,84 @@
+// Copyright (C) 2019 WuPeng <wupeng364@outlook.com>.
+// Use of this source code is governed by an MIT-style.
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction,
+// including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software,
+// and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+// 文件工具-错误定义
+// 可以使用errors.Is判断错误类型
+
+package fstool
+
+import (
+	"errors"
+	"os"
+	"runtime"
+	"syscall"
+)
+
+var (
+	// ErrExist 目标位置已经存在
+	ErrExist = os.ErrExist
+	// ErrNotExist 路径不存在
+	ErrNotExist = os.ErrNotExist
+	// ErrCrossDevice 不能跨分区重命名, 需要复制后删除
+	ErrCrossDevice = errors.New("cross-device link")
+	// ErrReadOnly 只读文件系统不能写入
+	ErrReadOnly = errors.New("read-only file system")
+	// ErrNotSupported 当前平台或文件系统不支持该操作
+	ErrNotSupported = errors.New("operation not supported on this platform")
+	// ErrSymlink 限定目录的文件系统不经过符号链接, 避免访问目录以外的内容
+	ErrSymlink = errors.New("path contains symbolic link")
+)
+
+// errorNotSameDevice Windows下跨磁盘移动的错误码 ERROR_NOT_SAME_DEVICE
+const errorNotSameDevice = syscall.Errno(17)
+
+// rename 重命名文件|夹, 测试时可以替换
+var rename = os.Rename
+
+// renameFile 重命名文件|夹, 跨分区时返回的错误可以用errors.Is(err, ErrCrossDevice)判断
+func renameFile(src, dst string) error {
+	err := rename(src, dst)
+	if nil == err {
+		return nil
+	}
+	if linkErr, ok := err.(*os.LinkError); ok && isCrossDeviceErrno(linkErr.Err) {
+		return &os.LinkError{Op: linkErr.Op, Old: linkErr.Old, New: linkErr.New, Err: &crossDeviceError{err: linkErr.Err}}
+	}
+	return err
+}
+
+// isCrossDeviceErrno 系统错误是否是跨分区
+func isCrossDeviceErrno(err error) bool {
+	var errno syscall.Errno
+	if !errors.As(err, &errno) {
+		return false
+	}
+	if runtime.GOOS == "windows" && errno == errorNotSameDevice {
+		return true
+	}
+	return errno == syscall.EXDEV
+}
+
+// crossDeviceError 跨分区错误, 保留原始的系统错误
+type crossDeviceError struct {
+	err error
+}
+
+func (e *crossDeviceError) Error() string {
+	return e.err.Error()
+}
+
+// Is errors.Is(err, ErrCrossDevice)
+func (e *crossDeviceError) Is(target error) bool {
+	return target == ErrCrossDevice
+}
+
+// Unwrap 返回原始的系统错误
+func (e *crossDeviceError) Unwrap() error {
+	return e.err
+}
@@ -0,0 +1,101 @@
+// Copyright (C) 2019 WuPeng <wupeng364@outlook.com>.
+// Use of this source code is governed by an MIT-style.
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction,
+// including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software,
+// and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+// 文件工具-文件元数据
+// 一次获取创建时间、访问时间、inode、链接数、所有者等信息, 平台或文件系统不支持的字段为零值
+
+package fstool
+
+import (
+	"os"
+	"os/user"
+	"strconv"
+	"time"
+)
+
+// FileMeta 文件|夹的元数据
+type FileMeta struct {
+	Path         string      // 路径
+	Name         string      // 名称
+	Size         int64       // 大小
+	Mode         os.FileMode // 权限和类型
+	IsDir        bool        // 是否是文件夹
+	Symlink      bool        // 是否是符号链接, 只有LstatFileMeta会返回true
+	ModTime      time.Time   // 内容修改时间
+	AccessTime   time.Time   // 访问时间, 受noatime等挂载选项影响, 不支持时为修改时间
+	ChangeTime   time.Time   // 元数据修改时间(ctime), Windows不支持, 为零值
+	BirthTime    time.Time   // 创建时间, HasBirthTime为false时为零值
+	HasBirthTime bool        // 平台和文件系统是否提供了创建时间
+	Inode        uint64      // inode编号, Windows为0
+	Device       uint64      // 所在设备编号, Windows为0
+	Links        uint64      // 硬链接数, 不支持时为1
+	UID          int         // 所有者ID, 不支持时为-1
+	GID          int         // 所属组ID, 不支持时为-1
+}
+
+// GetFileMeta 获取文件|夹的元数据, 跟随符号链接
+func GetFileMeta(path string) (*FileMeta, error) {
+	return fileMeta(path, true)
+}
+
+// LstatFileMeta 获取文件|夹的元数据, 路径是符号链接时返回链接本身的信息
+func LstatFileMeta(path string) (*FileMeta, error) {
+	return fileMeta(path, false)
+}
+
+// fileMeta 获取元数据, 公共字段来自Stat, 其余由各平台补充
+func fileMeta(path string, follow bool) (*FileMeta, error) {
+	stat := os.Stat
+	if !follow {
+		stat = os.Lstat
+	}
+	st, err := stat(path)
+	if nil != err {
+		return nil, err
+	}
+	meta := &FileMeta{
+		Path:       path,
+		Name:       st.Name(),
+		Size:       st.Size(),
+		Mode:       st.Mode(),
+		IsDir:      st.IsDir(),
+		Symlink:    st.Mode()&os.ModeSymlink != 0,
+		ModTime:    st.ModTime(),
+		AccessTime: st.ModTime(),
+		Links:      1,
+		UID:        -1,
+		GID:        -1,
+	}
+	fillFileMeta(meta, st, follow)
+	return meta, nil
+}
+
+// Owner 所有者的用户名, 平台不支持时返回ErrNotSupported
+func (meta *FileMeta) Owner() (string, error) {
+	if meta.UID < 0 {
+		return "", &os.PathError{Op: "Owner", Path: meta.Path, Err: ErrNotSupported}
+	}
+	u, err := user.LookupId(strconv.Itoa(meta.UID))
+	if nil != err {
+		return "", err
+	}
+	return u.Username, nil
+}
+
+// Group 所属组的名称, 平台不支持时返回ErrNotSupported
+func (meta *FileMeta) Group() (string, error) {
+	if meta.GID < 0 {
+		return "", &os.PathError{Op: "Group", Path: meta.Path, Err: ErrNotSupported}
+	}
+	g, err := user.LookupGroupId(strconv.Itoa(meta.GID))
+	if nil != err {
+		return "", err
+	}
+	return g.Name, nil
+}
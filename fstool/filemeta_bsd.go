@@ -0,0 +1,40 @@
+// Copyright (C) 2019 WuPeng <wupeng364@outlook.com>.
+// Use of this source code is governed by an MIT-style.
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction,
+// including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software,
+// and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+//go:build darwin || freebsd || netbsd
+// +build darwin freebsd netbsd
+
+// 文件工具-文件元数据, Stat_t中带有创建时间的平台
+
+package fstool
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+// fillFileMeta 补充Stat_t中的字段
+func fillFileMeta(meta *FileMeta, st os.FileInfo, follow bool) {
+	sys, ok := st.Sys().(*syscall.Stat_t)
+	if !ok {
+		return
+	}
+	meta.AccessTime = time.Unix(int64(sys.Atimespec.Sec), int64(sys.Atimespec.Nsec))
+	meta.ChangeTime = time.Unix(int64(sys.Ctimespec.Sec), int64(sys.Ctimespec.Nsec))
+	meta.Inode = uint64(sys.Ino)
+	meta.Device = uint64(sys.Dev)
+	meta.Links = uint64(sys.Nlink)
+	meta.UID, meta.GID = int(sys.Uid), int(sys.Gid)
+	// 文件系统不支持时创建时间为0或-1
+	if sys.Birthtimespec.Sec > 0 {
+		meta.BirthTime = time.Unix(int64(sys.Birthtimespec.Sec), int64(sys.Birthtimespec.Nsec))
+		meta.HasBirthTime = true
+	}
+}
@@ -0,0 +1,115 @@
+// Copyright (C) 2019 WuPeng <wupeng364@outlook.com>.
+// Use of this source code is governed by an MIT-style.
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction,
+// including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software,
+// and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+// 文件工具-文件元数据, Linux实现, 创建时间使用statx获取(内核4.11+)
+
+package fstool
+
+import (
+	"os"
+	"runtime"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+const (
+	// statxBtime statx的STATX_BTIME
+	statxBtime = 0x800
+	// atFDCWD AT_FDCWD, 相对路径从当前目录开始
+	atFDCWD = -0x64
+	// atSymlinkNoFollow AT_SYMLINK_NOFOLLOW
+	atSymlinkNoFollow = 0x100
+)
+
+// sysStatx 各架构的statx系统调用号, syscall包没有定义
+var sysStatx = map[string]uintptr{
+	"386":      383,
+	"amd64":    332,
+	"arm":      397,
+	"arm64":    291,
+	"loong64":  291,
+	"mips":     4366,
+	"mipsle":   4366,
+	"mips64":   5326,
+	"mips64le": 5326,
+	"ppc64":    383,
+	"ppc64le":  383,
+	"riscv64":  291,
+	"s390x":    379,
+}
+
+// statxTimestamp struct statx_timestamp
+type statxTimestamp struct {
+	Sec  int64
+	Nsec uint32
+	_    int32
+}
+
+// statxT struct statx, 只使用其中的创建时间
+type statxT struct {
+	Mask           uint32
+	Blksize        uint32
+	Attributes     uint64
+	Nlink          uint32
+	Uid            uint32
+	Gid            uint32
+	Mode           uint16
+	_              uint16
+	Ino            uint64
+	Size           uint64
+	Blocks         uint64
+	AttributesMask uint64
+	Atime          statxTimestamp
+	Btime          statxTimestamp
+	Ctime          statxTimestamp
+	Mtime          statxTimestamp
+	RdevMajor      uint32
+	RdevMinor      uint32
+	DevMajor       uint32
+	DevMinor       uint32
+	_              [14]uint64
+}
+
+// fillFileMeta 补充Stat_t中的字段和statx中的创建时间
+func fillFileMeta(meta *FileMeta, st os.FileInfo, follow bool) {
+	if sys, ok := st.Sys().(*syscall.Stat_t); ok {
+		meta.AccessTime = time.Unix(int64(sys.Atim.Sec), int64(sys.Atim.Nsec))
+		meta.ChangeTime = time.Unix(int64(sys.Ctim.Sec), int64(sys.Ctim.Nsec))
+		meta.Inode = uint64(sys.Ino)
+		meta.Device = uint64(sys.Dev)
+		meta.Links = uint64(sys.Nlink)
+		meta.UID, meta.GID = int(sys.Uid), int(sys.Gid)
+	}
+	if btime, ok := birthTime(meta.Path, follow); ok {
+		meta.BirthTime, meta.HasBirthTime = btime, true
+	}
+}
+
+// birthTime 使用statx获取创建时间, 内核或文件系统不支持时返回false
+func birthTime(path string, follow bool) (time.Time, bool) {
+	trap, ok := sysStatx[runtime.GOARCH]
+	if !ok {
+		return time.Time{}, false
+	}
+	p, err := syscall.BytePtrFromString(path)
+	if nil != err {
+		return time.Time{}, false
+	}
+	dirfd, flags := atFDCWD, 0
+	if !follow {
+		flags = atSymlinkNoFollow
+	}
+	var stx statxT
+	_, _, errno := syscall.Syscall6(trap, uintptr(dirfd), uintptr(unsafe.Pointer(p)), uintptr(flags), statxBtime, uintptr(unsafe.Pointer(&stx)), 0)
+	if errno != 0 || stx.Mask&statxBtime == 0 {
+		return time.Time{}, false
+	}
+	return time.Unix(stx.Btime.Sec, int64(stx.Btime.Nsec)), true
+}
@@ -0,0 +1,459 @@
+// Copyright (C) 2019 WuPeng <wupeng364@outlook.com>.
+// Use of this source code is governed by an MIT-style.
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction,
+// including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software,
+// and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+// 文件工具-文件系统接口
+// 复制、移动、JSON读写等工具可以作用在本地磁盘、内存、只读或限定目录的文件系统上
+// 通过IOFS和FromIOFS与io/fs互通
+// CopyTree、Walk、原子写入、校验和续传、压缩包、同步和回收站只作用在本地磁盘, 需要这些功能时使用本地路径
+
+package fstool
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// File 文件对象, *os.File实现了该接口, 同时满足fs.ReadDirFile
+type File interface {
+	io.Reader
+	io.Writer
+	io.Seeker
+	io.Closer
+	Name() string
+	Stat() (os.FileInfo, error)
+	ReadDir(n int) ([]os.DirEntry, error)
+}
+
+// FS 文件系统, 路径使用本地分隔符, 错误与os包一致为*os.PathError, 可以用errors.Is判断
+type FS interface {
+	Stat(name string) (os.FileInfo, error)
+	Open(name string) (File, error)
+	Create(name string) (File, error)
+	OpenFile(name string, flag int, perm os.FileMode) (File, error)
+	Mkdir(name string, perm os.FileMode) error
+	Remove(name string) error
+	Rename(oldname, newname string) error
+	ReadDir(name string) ([]os.DirEntry, error)
+	Chmod(name string, mode os.FileMode) error
+}
+
+// lstatFS 支持符号链接的文件系统
+type lstatFS interface {
+	Lstat(name string) (os.FileInfo, error)
+}
+
+// mkdirAllFS 可以直接创建多级文件夹的文件系统
+type mkdirAllFS interface {
+	MkdirAll(name string, perm os.FileMode) error
+}
+
+// removeAllFS 可以直接递归删除的文件系统
+type removeAllFS interface {
+	RemoveAll(name string) error
+}
+
+// osfs 本地文件系统
+var osfs FS = osFS{}
+
+// NewOSFS 本地文件系统
+func NewOSFS() FS {
+	return osfs
+}
+
+// osFS 本地文件系统, 重命名跨分区时返回ErrCrossDevice
+type osFS struct{}
+
+func (osFS) Stat(name string) (os.FileInfo, error)  { return os.Stat(name) }
+func (osFS) Lstat(name string) (os.FileInfo, error) { return os.Lstat(name) }
+func (osFS) Open(name string) (File, error)         { return openOS(os.Open(name)) }
+func (osFS) Create(name string) (File, error)       { return openOS(os.Create(name)) }
+func (osFS) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	return openOS(os.OpenFile(name, flag, perm))
+}
+func (osFS) Mkdir(name string, perm os.FileMode) error    { return os.Mkdir(name, perm) }
+func (osFS) MkdirAll(name string, perm os.FileMode) error { return os.MkdirAll(name, perm) }
+func (osFS) Remove(name string) error                     { return os.Remove(name) }
+func (osFS) RemoveAll(name string) error                  { return os.RemoveAll(name) }
+func (osFS) Rename(oldname, newname string) error         { return renameFile(oldname, newname) }
+func (osFS) ReadDir(name string) ([]os.DirEntry, error)   { return os.ReadDir(name) }
+func (osFS) Chmod(name string, mode os.FileMode) error    { return os.Chmod(name, mode) }
+
+// openOS 避免把值为nil的*os.File转换为非nil的File
+func openOS(fp *os.File, err error) (File, error) {
+	if nil != err {
+		return nil, err
+	}
+	return fp, nil
+}
+
+// LstatFS 获取文件信息, 不跟随符号链接, 文件系统不支持符号链接时同Stat
+func LstatFS(fsys FS, name string) (os.FileInfo, error) {
+	if lfs, ok := fsys.(lstatFS); ok {
+		return lfs.Lstat(name)
+	}
+	return fsys.Stat(name)
+}
+
+// IsExistFS 文件/夹是否存在
+func IsExistFS(fsys FS, name string) bool {
+	_, err := fsys.Stat(name)
+	return nil == err
+}
+
+// IsDirFS 是否是文件夹
+func IsDirFS(fsys FS, name string) bool {
+	st, err := fsys.Stat(name)
+	return nil == err && st.IsDir()
+}
+
+// IsFileFS 是否是文件
+func IsFileFS(fsys FS, name string) bool {
+	st, err := fsys.Stat(name)
+	return nil == err && !st.IsDir()
+}
+
+// existFS 路径是否存在, 不跟随符号链接
+func existFS(fsys FS, name string) bool {
+	_, err := LstatFS(fsys, name)
+	return nil == err
+}
+
+// MkdirAllFS 创建文件夹-多级
+func MkdirAllFS(fsys FS, name string) error {
+	if mfs, ok := fsys.(mkdirAllFS); ok {
+		return mfs.MkdirAll(name, os.ModePerm)
+	}
+	if st, err := fsys.Stat(name); nil == err {
+		if st.IsDir() {
+			return nil
+		}
+		return PathExist("mkdir", name)
+	}
+	if parent := filepath.Dir(name); parent != name {
+		if err := MkdirAllFS(fsys, parent); nil != err {
+			return err
+		}
+	}
+	if err := fsys.Mkdir(name, os.ModePerm); nil != err && !IsDirFS(fsys, name) {
+		return err
+	}
+	return nil
+}
+
+// RemoveAllFS 删除文件|夹及其中的内容, 路径不存在时不报错
+func RemoveAllFS(fsys FS, name string) error {
+	if rfs, ok := fsys.(removeAllFS); ok {
+		return rfs.RemoveAll(name)
+	}
+	st, err := LstatFS(fsys, name)
+	if nil != err {
+		if IsNotExistError(err) {
+			return nil
+		}
+		return err
+	}
+	if st.IsDir() {
+		entries, err := fsys.ReadDir(name)
+		if nil != err {
+			return err
+		}
+		for _, entry := range entries {
+			if err = RemoveAllFS(fsys, filepath.Join(name, entry.Name())); nil != err {
+				return err
+			}
+		}
+	}
+	return fsys.Remove(name)
+}
+
+// ReadDirNamesFS 获取一级子目录名字, 按名字排序
+func ReadDirNamesFS(fsys FS, name string) ([]string, error) {
+	entries, err := fsys.ReadDir(name)
+	if nil != err {
+		return nil, err
+	}
+	names := make([]string, len(entries))
+	for i, entry := range entries {
+		names[i] = entry.Name()
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// ReadFileFS 读取文件内容
+func ReadFileFS(fsys FS, name string) ([]byte, error) {
+	fp, err := fsys.Open(name)
+	if nil != err {
+		return nil, err
+	}
+	defer fp.Close()
+	return io.ReadAll(fp)
+}
+
+// WriteFileFS 写入文件内容, 文件已存在时清空
+func WriteFileFS(fsys FS, name string, data []byte) error {
+	fp, err := fsys.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0666)
+	if nil != err {
+		return err
+	}
+	_, err = fp.Write(data)
+	if cerr := fp.Close(); nil == err {
+		err = cerr
+	}
+	return err
+}
+
+// WriteTextFileFS 写入文本文件
+func WriteTextFileFS(fsys FS, name, text string) error {
+	if len(name) == 0 {
+		return PathNotExist("WriteFile", name)
+	}
+	return WriteFileFS(fsys, name, []byte(text))
+}
+
+// ReadFileAsJSONFS 读取Json文件
+func ReadFileAsJSONFS(fsys FS, name string, v interface{}) error {
+	if len(name) == 0 {
+		return PathNotExist("ReadFileAsJSON", name)
+	}
+	data, err := ReadFileFS(fsys, name)
+	if nil != err {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// WriteFileAsJSONFS 写入Json文件
+func WriteFileAsJSONFS(fsys FS, name string, v interface{}) error {
+	if len(name) == 0 {
+		return PathNotExist("WriteFileAsJSON", name)
+	}
+	data, err := json.Marshal(v)
+	if nil != err {
+		return err
+	}
+	return WriteFileFS(fsys, name, data)
+}
+
+// HashFileFS 计算文件的sha256
+func HashFileFS(fsys FS, name string) ([]byte, error) {
+	fp, err := fsys.Open(name)
+	if nil != err {
+		return nil, err
+	}
+	defer fp.Close()
+	return hashReader(fp)
+}
+
+// CopyFileFS 复制文件(源文件系统, 源路径, 目标文件系统, 目标路径, 冲突策略)
+// 只复制内容, 不支持原子写入、校验和保留元数据, 两边都是本地文件系统时与CopyFileWith相同
+func CopyFileFS(srcFS FS, src string, dstFS FS, dst string, conflict ConflictOpts) error {
+	if srcFS == osfs && dstFS == osfs {
+		return CopyFileWith(src, dst, conflict)
+	}
+	if srcFS == dstFS && src == dst && len(src) > 0 {
+		return nil
+	}
+	if !IsFileFS(srcFS, src) {
+		return PathNotExist("CopyFile", src)
+	}
+	if existFS(dstFS, dst) {
+		policy, target, err := conflict.resolve(srcFS, src, dstFS, dst, nil)
+		if nil != err {
+			return err
+		}
+		switch policy {
+		case ConflictOverwrite:
+			if err = RemoveAllFS(dstFS, dst); err != nil {
+				return err
+			}
+		case ConflictSkip:
+			return nil
+		case ConflictRename:
+			dst = target
+		default:
+			return PathExist("CopyFile", dst)
+		}
+	}
+	rsrc, err := srcFS.Open(src)
+	if err != nil {
+		return err
+	}
+	defer rsrc.Close()
+	wdst, err := dstFS.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(wdst, rsrc)
+	if cerr := wdst.Close(); nil == err {
+		err = cerr
+	}
+	return err
+}
+
+// CopyFilesFS 复制文件夹 (源文件系统, 源路径, 目标文件系统, 目标路径, 冲突策略, 操作回调) 返回错误即可终止后续拷贝
+// 文件夹之间合并, 其中的文件按冲突策略处理, 两边都是本地文件系统时与CopyFilesWith相同
+func CopyFilesFS(srcFS FS, src string, dstFS FS, dst string, conflict ConflictOpts, callback CopyCallback) error {
+	if srcFS == osfs && dstFS == osfs {
+		return CopyFilesWith(src, dst, conflict, callback)
+	}
+	if srcFS == dstFS && src == dst && len(src) > 0 {
+		return nil
+	}
+	if !IsExistFS(srcFS, src) {
+		return callback(src, dst, PathNotExist("CopyFiles", src))
+	}
+	if IsFileFS(dstFS, dst) {
+		return callback(src, dst, PathExist("CopyFiles", dst))
+	}
+	// 源文件夹对应的目标文件夹, 文件夹可能被重命名
+	dirs := map[string]string{src: dst}
+	return walkFS(srcFS, src, func(s string, f os.FileInfo, err error) error {
+		d := dst
+		if s != src {
+			d = filepath.Join(dirs[filepath.Dir(s)], filepath.Base(s))
+		}
+		if err == nil {
+			if f.IsDir() {
+				var skip bool
+				if d, skip, err = mkdirFS(srcFS, s, dstFS, d, conflict); skip && nil == err {
+					if err = callback(s, d, nil); nil != err {
+						return err
+					}
+					return filepath.SkipDir
+				}
+				dirs[s] = d
+			} else {
+				err = CopyFileFS(srcFS, s, dstFS, d, conflict)
+			}
+		}
+		return callback(s, d, err)
+	})
+}
+
+// mkdirFS 创建文件夹, 已存在同名的文件时按冲突策略处理, 返回实际的目标路径和是否跳过
+func mkdirFS(srcFS FS, src string, dstFS FS, dst string, conflict ConflictOpts) (string, bool, error) {
+	if IsDirFS(dstFS, dst) {
+		return dst, false, nil
+	}
+	if existFS(dstFS, dst) {
+		policy, target, err := conflict.resolve(srcFS, src, dstFS, dst, nil)
+		if nil != err {
+			return dst, false, err
+		}
+		switch policy {
+		case ConflictOverwrite:
+			if err = RemoveAllFS(dstFS, dst); nil != err {
+				return dst, false, err
+			}
+		case ConflictSkip:
+			return dst, true, nil
+		case ConflictRename:
+			dst = target
+		default:
+			return dst, false, PathExist("CopyFiles", dst)
+		}
+	}
+	return dst, false, dstFS.Mkdir(dst, os.ModePerm)
+}
+
+// MoveFilesFS 移动文件|夹, 如果存在的话就列表后逐一移动 (文件系统, 源路径, 目标路径, 冲突策略, 操作回调) 操作结果
+// 文件夹之间合并, 其中的文件按冲突策略处理, 跳过的源文件在合并结束后随源文件夹一起删除
+func MoveFilesFS(fsys FS, src, dst string, conflict ConflictOpts, callback MoveCallback) error {
+	if src == dst && len(src) > 0 {
+		return nil
+	}
+	if !IsExistFS(fsys, src) {
+		return PathNotExist("MoveFiles", src)
+	}
+	if existFS(fsys, dst) {
+		var err error
+		// src&dst都是文件夹, 则考虑合并规则, 处理里面的文件
+		if IsDirFS(fsys, src) && IsDirFS(fsys, dst) {
+			list, _ := ReadDirNamesFS(fsys, src)
+			for i := 0; i < len(list); i++ {
+				err = MoveFilesFS(fsys, filepath.Join(src, list[i]), filepath.Join(dst, list[i]), conflict, callback)
+				if err != nil {
+					return err // 返回终止信号
+				}
+			}
+			if IsExistFS(fsys, src) {
+				return callback(src, dst, RemoveAllFS(fsys, src))
+			}
+			return nil
+		}
+		// 非合并模式按冲突策略处理目标位置
+		policy, target, err := conflict.resolve(fsys, src, fsys, dst, nil)
+		if nil != err {
+			return callback(src, dst, err)
+		}
+		switch policy {
+		case ConflictSkip:
+			// 如果忽略则不返回错误
+			return callback(src, dst, nil)
+		case ConflictRename:
+			dst = target
+		case ConflictOverwrite:
+			// 如果覆盖, 则先删除目标位置
+			err = RemoveAllFS(fsys, dst)
+		default:
+			err = PathExist("MoveFiles", dst)
+		}
+		if nil != err {
+			return callback(src, dst, err)
+		}
+		return callback(src, dst, fsys.Rename(src, dst))
+	}
+	// 如果目标文件/夹不存在就直接移动
+	return callback(src, dst, fsys.Rename(src, dst))
+}
+
+// walkFS 与filepath.Walk一致, 遍历文件系统
+func walkFS(fsys FS, root string, fn filepath.WalkFunc) error {
+	info, err := LstatFS(fsys, root)
+	if nil != err {
+		err = fn(root, nil, err)
+	} else {
+		err = walkFSDir(fsys, root, info, fn)
+	}
+	if err == filepath.SkipDir {
+		return nil
+	}
+	return err
+}
+
+// walkFSDir 递归遍历
+func walkFSDir(fsys FS, name string, info os.FileInfo, fn filepath.WalkFunc) error {
+	if !info.IsDir() {
+		return fn(name, info, nil)
+	}
+	names, err := ReadDirNamesFS(fsys, name)
+	err1 := fn(name, info, err)
+	if nil != err || nil != err1 {
+		return err1
+	}
+	for _, child := range names {
+		filename := filepath.Join(name, child)
+		fileInfo, err := LstatFS(fsys, filename)
+		if nil != err {
+			if err = fn(filename, fileInfo, err); nil != err && err != filepath.SkipDir {
+				return err
+			}
+			continue
+		}
+		err = walkFSDir(fsys, filename, fileInfo, fn)
+		if nil != err && (!fileInfo.IsDir() || err != filepath.SkipDir) {
+			return err
+		}
+	}
+	return nil
+}
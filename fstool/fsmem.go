@@ -0,0 +1,466 @@
+// Copyright (C) 2019 WuPeng <wupeng364@outlook.com>.
+// Use of this source code is governed by an MIT-style.
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction,
+// including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software,
+// and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+// 文件工具-内存文件系统
+// 所有内容保存在内存中, 路径统一转换为以'/'开头的绝对路径, 不支持符号链接
+
+package fstool
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	errIsDir    = errors.New("is a directory")
+	errNotDir   = errors.New("not a directory")
+	errNotEmpty = errors.New("directory not empty")
+)
+
+// MemFS 内存文件系统, 可以并发使用
+type MemFS struct {
+	root *memNode
+	l    *sync.RWMutex
+}
+
+// memNode 文件|夹节点
+type memNode struct {
+	name     string
+	mode     os.FileMode
+	modTime  time.Time
+	data     []byte
+	children map[string]*memNode // 文件夹的内容, 文件为nil
+}
+
+// NewMemFS 创建空的内存文件系统
+func NewMemFS() *MemFS {
+	return &MemFS{
+		root: &memNode{name: "/", mode: os.ModeDir | 0777, modTime: time.Now(), children: make(map[string]*memNode)},
+		l:    new(sync.RWMutex),
+	}
+}
+
+// memPath 转换为以'/'开头的路径
+func memPath(name string) string {
+	return path.Clean("/" + filepath.ToSlash(name))
+}
+
+// lookup 查找节点
+func (mfs *MemFS) lookup(name string) (*memNode, error) {
+	node := mfs.root
+	for _, part := range strings.Split(memPath(name), "/")[1:] {
+		if len(part) == 0 {
+			continue
+		}
+		if nil == node.children {
+			return nil, errNotDir
+		}
+		child, ok := node.children[part]
+		if !ok {
+			return nil, os.ErrNotExist
+		}
+		node = child
+	}
+	return node, nil
+}
+
+// lookupParent 查找上级文件夹节点, 返回上级和名字
+func (mfs *MemFS) lookupParent(name string) (*memNode, string, error) {
+	p := memPath(name)
+	if p == "/" {
+		return nil, "", os.ErrExist
+	}
+	parent, err := mfs.lookup(path.Dir(p))
+	if nil != err {
+		return nil, "", err
+	}
+	if nil == parent.children {
+		return nil, "", errNotDir
+	}
+	return parent, path.Base(p), nil
+}
+
+// Stat 获取文件信息
+func (mfs *MemFS) Stat(name string) (os.FileInfo, error) {
+	mfs.l.RLock()
+	defer mfs.l.RUnlock()
+	node, err := mfs.lookup(name)
+	if nil != err {
+		return nil, &os.PathError{Op: "stat", Path: name, Err: err}
+	}
+	return node.info(), nil
+}
+
+// Open 只读打开
+func (mfs *MemFS) Open(name string) (File, error) {
+	return mfs.OpenFile(name, os.O_RDONLY, 0)
+}
+
+// Create 创建或清空文件, 读写打开
+func (mfs *MemFS) Create(name string) (File, error) {
+	return mfs.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+}
+
+// OpenFile 按标志打开文件, 与os.OpenFile一致
+func (mfs *MemFS) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	mfs.l.Lock()
+	defer mfs.l.Unlock()
+	writable := flag&(os.O_WRONLY|os.O_RDWR) != 0
+	node, err := mfs.lookup(name)
+	if nil == err {
+		if flag&os.O_CREATE != 0 && flag&os.O_EXCL != 0 {
+			return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrExist}
+		}
+		if nil != node.children && writable {
+			return nil, &os.PathError{Op: "open", Path: name, Err: errIsDir}
+		}
+		if writable && flag&os.O_TRUNC != 0 {
+			node.data, node.modTime = nil, time.Now()
+		}
+	} else if err == os.ErrNotExist && flag&os.O_CREATE != 0 {
+		parent, base, err := mfs.lookupParent(name)
+		if nil != err {
+			return nil, &os.PathError{Op: "open", Path: name, Err: err}
+		}
+		node = &memNode{name: base, mode: perm.Perm(), modTime: time.Now()}
+		parent.children[base] = node
+		parent.modTime = node.modTime
+	} else {
+		return nil, &os.PathError{Op: "open", Path: name, Err: err}
+	}
+	fp := &memFile{fs: mfs, node: node, name: name, readable: flag&os.O_WRONLY == 0, writable: writable, append: flag&os.O_APPEND != 0}
+	return fp, nil
+}
+
+// Mkdir 创建文件夹
+func (mfs *MemFS) Mkdir(name string, perm os.FileMode) error {
+	mfs.l.Lock()
+	defer mfs.l.Unlock()
+	parent, base, err := mfs.lookupParent(name)
+	if nil != err {
+		return &os.PathError{Op: "mkdir", Path: name, Err: err}
+	}
+	if _, ok := parent.children[base]; ok {
+		return &os.PathError{Op: "mkdir", Path: name, Err: os.ErrExist}
+	}
+	now := time.Now()
+	parent.children[base] = &memNode{name: base, mode: os.ModeDir | perm.Perm(), modTime: now, children: make(map[string]*memNode)}
+	parent.modTime = now
+	return nil
+}
+
+// Remove 删除文件或空文件夹
+func (mfs *MemFS) Remove(name string) error {
+	mfs.l.Lock()
+	defer mfs.l.Unlock()
+	parent, base, err := mfs.lookupParent(name)
+	if nil == err {
+		node, ok := parent.children[base]
+		if !ok {
+			err = os.ErrNotExist
+		} else if len(node.children) > 0 {
+			err = errNotEmpty
+		} else {
+			delete(parent.children, base)
+			parent.modTime = time.Now()
+			return nil
+		}
+	}
+	return &os.PathError{Op: "remove", Path: name, Err: err}
+}
+
+// RemoveAll 删除文件|夹及其中的内容, 路径不存在时不报错
+func (mfs *MemFS) RemoveAll(name string) error {
+	mfs.l.Lock()
+	defer mfs.l.Unlock()
+	parent, base, err := mfs.lookupParent(name)
+	if nil != err {
+		if err == os.ErrNotExist {
+			return nil
+		}
+		return &os.PathError{Op: "remove", Path: name, Err: err}
+	}
+	if _, ok := parent.children[base]; ok {
+		delete(parent.children, base)
+		parent.modTime = time.Now()
+	}
+	return nil
+}
+
+// Rename 重命名, 目标是文件或空文件夹时被替换
+func (mfs *MemFS) Rename(oldname, newname string) error {
+	mfs.l.Lock()
+	defer mfs.l.Unlock()
+	linkErr := func(err error) error {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: err}
+	}
+	oldParent, oldBase, err := mfs.lookupParent(oldname)
+	if nil != err {
+		return linkErr(err)
+	}
+	node, ok := oldParent.children[oldBase]
+	if !ok {
+		return linkErr(os.ErrNotExist)
+	}
+	newParent, newBase, err := mfs.lookupParent(newname)
+	if nil != err {
+		return linkErr(err)
+	}
+	if memPath(newname) == memPath(oldname) {
+		return nil
+	}
+	if nil != node.children && strings.HasPrefix(memPath(newname), memPath(oldname)+"/") {
+		return linkErr(os.ErrInvalid)
+	}
+	if target, ok := newParent.children[newBase]; ok {
+		if nil != target.children && nil == node.children {
+			return linkErr(errIsDir)
+		}
+		if nil == target.children && nil != node.children {
+			return linkErr(errNotDir)
+		}
+		if len(target.children) > 0 {
+			return linkErr(errNotEmpty)
+		}
+	}
+	now := time.Now()
+	delete(oldParent.children, oldBase)
+	node.name = newBase
+	newParent.children[newBase] = node
+	oldParent.modTime, newParent.modTime = now, now
+	return nil
+}
+
+// ReadDir 读取文件夹内容, 按名字排序
+func (mfs *MemFS) ReadDir(name string) ([]os.DirEntry, error) {
+	mfs.l.RLock()
+	defer mfs.l.RUnlock()
+	node, err := mfs.lookup(name)
+	if nil == err && nil == node.children {
+		err = errNotDir
+	}
+	if nil != err {
+		return nil, &os.PathError{Op: "readdir", Path: name, Err: err}
+	}
+	return node.entries(), nil
+}
+
+// Chmod 修改权限
+func (mfs *MemFS) Chmod(name string, mode os.FileMode) error {
+	mfs.l.Lock()
+	defer mfs.l.Unlock()
+	node, err := mfs.lookup(name)
+	if nil != err {
+		return &os.PathError{Op: "chmod", Path: name, Err: err}
+	}
+	node.mode = node.mode&os.ModeType | mode.Perm()
+	return nil
+}
+
+// Chtimes 修改时间, 内存文件系统只记录修改时间
+func (mfs *MemFS) Chtimes(name string, atime, mtime time.Time) error {
+	mfs.l.Lock()
+	defer mfs.l.Unlock()
+	node, err := mfs.lookup(name)
+	if nil != err {
+		return &os.PathError{Op: "chtimes", Path: name, Err: err}
+	}
+	node.modTime = mtime
+	return nil
+}
+
+// MkdirAll 创建文件夹-多级
+func (mfs *MemFS) MkdirAll(name string, perm os.FileMode) error {
+	mfs.l.Lock()
+	defer mfs.l.Unlock()
+	node := mfs.root
+	for _, part := range strings.Split(memPath(name), "/")[1:] {
+		if len(part) == 0 {
+			continue
+		}
+		child, ok := node.children[part]
+		if !ok {
+			child = &memNode{name: part, mode: os.ModeDir | perm.Perm(), modTime: time.Now(), children: make(map[string]*memNode)}
+			node.children[part] = child
+			node.modTime = child.modTime
+		} else if nil == child.children {
+			return &os.PathError{Op: "mkdir", Path: name, Err: errNotDir}
+		}
+		node = child
+	}
+	return nil
+}
+
+// info 文件信息快照, 调用时需持有锁
+func (node *memNode) info() os.FileInfo {
+	return &memFileInfo{name: node.name, size: int64(len(node.data)), mode: node.mode, modTime: node.modTime}
+}
+
+// entries 文件夹内容, 按名字排序, 调用时需持有锁
+func (node *memNode) entries() []os.DirEntry {
+	list := make([]os.DirEntry, 0, len(node.children))
+	for _, child := range node.children {
+		list = append(list, fs.FileInfoToDirEntry(child.info()))
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name() < list[j].Name() })
+	return list
+}
+
+// memFileInfo 文件信息
+type memFileInfo struct {
+	name    string
+	size    int64
+	mode    os.FileMode
+	modTime time.Time
+}
+
+func (info *memFileInfo) Name() string       { return info.name }
+func (info *memFileInfo) Size() int64        { return info.size }
+func (info *memFileInfo) Mode() os.FileMode  { return info.mode }
+func (info *memFileInfo) ModTime() time.Time { return info.modTime }
+func (info *memFileInfo) IsDir() bool        { return info.mode.IsDir() }
+func (info *memFileInfo) Sys() interface{}   { return nil }
+
+// memFile 打开的内存文件
+type memFile struct {
+	fs       *MemFS
+	node     *memNode
+	name     string
+	offset   int64
+	readable bool
+	writable bool
+	append   bool
+	closed   bool
+	dirPos   int // ReadDir读取的位置
+}
+
+func (fp *memFile) pathError(op string, err error) error {
+	return &os.PathError{Op: op, Path: fp.name, Err: err}
+}
+
+// Name 打开时的路径
+func (fp *memFile) Name() string {
+	return fp.name
+}
+
+// Stat 获取文件信息
+func (fp *memFile) Stat() (os.FileInfo, error) {
+	if fp.closed {
+		return nil, fp.pathError("stat", os.ErrClosed)
+	}
+	fp.fs.l.RLock()
+	defer fp.fs.l.RUnlock()
+	return fp.node.info(), nil
+}
+
+// Read 读取
+func (fp *memFile) Read(p []byte) (int, error) {
+	if fp.closed || !fp.readable {
+		return 0, fp.pathError("read", os.ErrClosed)
+	}
+	fp.fs.l.RLock()
+	defer fp.fs.l.RUnlock()
+	if nil != fp.node.children {
+		return 0, fp.pathError("read", errIsDir)
+	}
+	if fp.offset >= int64(len(fp.node.data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, fp.node.data[fp.offset:])
+	fp.offset += int64(n)
+	return n, nil
+}
+
+// Write 写入
+func (fp *memFile) Write(p []byte) (int, error) {
+	if fp.closed || !fp.writable {
+		return 0, fp.pathError("write", os.ErrClosed)
+	}
+	fp.fs.l.Lock()
+	defer fp.fs.l.Unlock()
+	if fp.append {
+		fp.offset = int64(len(fp.node.data))
+	}
+	end := fp.offset + int64(len(p))
+	if end > int64(len(fp.node.data)) {
+		data := make([]byte, end)
+		copy(data, fp.node.data)
+		fp.node.data = data
+	}
+	copy(fp.node.data[fp.offset:], p)
+	fp.offset = end
+	fp.node.modTime = time.Now()
+	return len(p), nil
+}
+
+// Seek 移动读写位置
+func (fp *memFile) Seek(offset int64, whence int) (int64, error) {
+	if fp.closed {
+		return 0, fp.pathError("seek", os.ErrClosed)
+	}
+	fp.fs.l.RLock()
+	size := int64(len(fp.node.data))
+	fp.fs.l.RUnlock()
+	switch whence {
+	case io.SeekCurrent:
+		offset += fp.offset
+	case io.SeekEnd:
+		offset += size
+	}
+	if offset < 0 {
+		return 0, fp.pathError("seek", os.ErrInvalid)
+	}
+	fp.offset = offset
+	return offset, nil
+}
+
+// ReadDir 读取文件夹内容, n>0时每次最多返回n个, 读完后返回io.EOF
+func (fp *memFile) ReadDir(n int) ([]os.DirEntry, error) {
+	if fp.closed {
+		return nil, fp.pathError("readdir", os.ErrClosed)
+	}
+	fp.fs.l.RLock()
+	defer fp.fs.l.RUnlock()
+	if nil == fp.node.children {
+		return nil, fp.pathError("readdir", errNotDir)
+	}
+	list := fp.node.entries()
+	if fp.dirPos >= len(list) {
+		list = list[:0]
+	} else {
+		list = list[fp.dirPos:]
+	}
+	if n > 0 {
+		if len(list) == 0 {
+			return nil, io.EOF
+		}
+		if len(list) > n {
+			list = list[:n]
+		}
+	}
+	fp.dirPos += len(list)
+	return list, nil
+}
+
+// Close 关闭
+func (fp *memFile) Close() error {
+	if fp.closed {
+		return fp.pathError("close", os.ErrClosed)
+	}
+	fp.closed = true
+	return nil
+}
@@ -12,11 +12,10 @@
 package fstool
 
 import (
-	"encoding/json"
-	"io"
+	"context"
+	"errors"
 	"os"
 	"path"
-	"path/filepath"
 	"strings"
 	"time"
 )
@@ -101,34 +100,32 @@ func GetDirList(path string) ([]string, error) {
 
 // GetFileSize 获取文件大小
 func GetFileSize(path string) (int64, error) {
-	f, err := OpenFile(path)
+	fInfo, err := os.Stat(path)
 	if err != nil {
 		return 0, err
 	}
-	fInfo, errStat := f.Stat()
-	f.Close()
-	if errStat != nil {
-		return 0, errStat
-	}
 	return fInfo.Size(), nil
 }
 
-// GetCreateTime 获取创建时间
+// GetCreateTime 获取创建时间, 平台或文件系统不支持时返回修改时间
+// 需要区分时使用GetFileMeta并判断HasBirthTime
 func GetCreateTime(path string) (time.Time, error) {
-	return GetModifyTime(path)
+	meta, err := GetFileMeta(path)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if !meta.HasBirthTime {
+		return meta.ModTime, nil
+	}
+	return meta.BirthTime, nil
 }
 
 // GetModifyTime 获取修改时间
 func GetModifyTime(path string) (time.Time, error) {
-	f, err := OpenFile(path)
+	fInfo, err := os.Stat(path)
 	if err != nil {
 		return time.Time{}, err
 	}
-	fInfo, errStat := f.Stat()
-	f.Close()
-	if errStat != nil {
-		return time.Time{}, errStat
-	}
 	return fInfo.ModTime(), nil
 }
 
@@ -159,6 +156,11 @@ func Rename(old, newName string) error {
 
 // MoveFilesAcrossDisk 移动文件|文件夹,可跨分区移动(源路径, 目标路径, 重复覆盖, 重复忽略, 操作回调) 操作结果
 func MoveFilesAcrossDisk(src, dst string, replace, ignore bool, callback MoveCallback) error {
+	return MoveFilesAcrossDiskWith(src, dst, moveConflict(replace, ignore), callback)
+}
+
+// MoveFilesAcrossDiskWith 移动文件|文件夹,可跨分区移动(源路径, 目标路径, 冲突策略, 操作回调) 操作结果
+func MoveFilesAcrossDiskWith(src, dst string, conflict ConflictOpts, callback MoveCallback) error {
 	src = path.Clean(src)
 	dst = path.Clean(dst)
 	if src == dst && len(src) > 0 {
@@ -168,10 +170,10 @@ func MoveFilesAcrossDisk(src, dst string, replace, ignore bool, callback MoveCal
 		return PathNotExist("MoveFilesAcrossDisk", src)
 	}
 	// 尝试本分区移动
-	return MoveFiles(src, dst, replace, ignore, func(srcPath, dstPath string, mverror error) error {
-		// 尝试跨分区移动
+	return MoveFilesWith(src, dst, conflict, func(srcPath, dstPath string, mverror error) error {
+		// 尝试跨分区移动, 冲突已经处理过, 目标位置不存在
 		if IsAcrossDiskError(mverror) {
-			return MoveFileByCopying(srcPath, dstPath, replace, ignore, callback)
+			return MoveFileByCopyingWith(srcPath, dstPath, conflict, callback)
 		}
 		return callback(srcPath, dstPath, mverror)
 	})
@@ -179,61 +181,38 @@ func MoveFilesAcrossDisk(src, dst string, replace, ignore bool, callback MoveCal
 
 // MoveFiles 移动文件|夹, 如果存在的话就列表后逐一移动 (源路径, 目标路径, 重复覆盖, 重复忽略, 操作回调) 操作结果
 func MoveFiles(src, dst string, replace, ignore bool, callback MoveCallback) error {
-	if src == dst && len(src) > 0 {
-		return nil
-	}
-	if !IsExist(src) {
-		return PathNotExist("MoveFiles", src)
-	}
-	if IsExist(dst) {
-		srcIsfile := IsFile(src)
-		dstIsfile := IsFile(dst)
-		var err error
-		// src&dst都是文件夹, 则考虑合并规则, 处理里面的文件
-		if !srcIsfile && !dstIsfile {
-			list, _ := GetDirList(src)
-			for i := 0; i < len(list); i++ {
-				err = MoveFiles(src+"/"+list[i], dst+"/"+list[i], replace, ignore, callback)
-				if err != nil {
-					return err // 返回终止信号
-				}
-			}
-			if IsExist(src) {
-				return callback(src, dst, os.RemoveAll(src))
-			}
-			return nil
-		}
-		// 非合并模式只考虑删除目标位置
-		if ignore {
-			// 如果忽略则不返回错误
-			return callback(src, dst, err)
-		} else if replace {
-			// 如果覆盖, 则先删除目标位置
-			if dstIsfile {
-				err = os.Remove(dst)
-			} else {
-				err = os.RemoveAll(dst)
-			}
-		} else {
-			err = PathExist("MoveFiles", dst)
-		}
-		if nil != err {
-			return callback(src, dst, err)
-		}
-		return callback(src, dst, os.Rename(src, dst))
-	}
-	// 如果目标文件/夹不存在就直接移动
-	return callback(src, dst, os.Rename(src, dst))
+	return MoveFilesWith(src, dst, moveConflict(replace, ignore), callback)
+}
+
+// MoveFilesWith 移动文件|夹, 如果存在的话就列表后逐一移动 (源路径, 目标路径, 冲突策略, 操作回调) 操作结果
+// 文件夹之间合并, 其中的文件按冲突策略处理, 跳过的源文件在合并结束后随源文件夹一起删除
+func MoveFilesWith(src, dst string, conflict ConflictOpts, callback MoveCallback) error {
+	return MoveFilesFS(osfs, src, dst, conflict, callback)
+}
+
+// moveConflict 移动时的重复覆盖, 重复忽略, 忽略优先
+func moveConflict(replace, ignore bool) ConflictOpts {
+	return conflictFromFlags(replace && !ignore, ignore)
 }
 
 // MoveFileByCopying 移动文件夹 - 跨分区-拷贝
+// 文件先复制到临时文件, 校验一致后重命名再删除源文件, 中断后再次移动会从未完成的位置继续
 func MoveFileByCopying(src, dst string, replace, ignore bool, callback MoveCallback) error {
+	return MoveFileByCopyingWith(src, dst, conflictFromFlags(replace, ignore), callback)
+}
+
+// MoveFileByCopyingWith 移动文件夹 - 跨分区-拷贝(源路径, 目标路径, 冲突策略, 操作回调)
+func MoveFileByCopyingWith(src, dst string, conflict ConflictOpts, callback MoveCallback) error {
 	if src == dst && len(src) > 0 {
 		return nil
 	}
+	if conflict.Policy == ConflictDefault {
+		conflict.Policy = ConflictError
+	}
+	opts := CopyOpts{Conflict: conflict, Workers: 1, Resume: true, Verify: true}
 	if IsFile(src) {
 		var err1 error
-		err := CopyFile(src, dst, replace, ignore)
+		plan, err := CopyTree(context.Background(), src, dst, opts)
 		if err != nil {
 			err1 = callback(src, dst, err)
 		}
@@ -242,15 +221,27 @@ func MoveFileByCopying(src, dst string, replace, ignore bool, callback MoveCallb
 		} else if err != nil {
 			return nil
 		}
+		if len(plan) == 1 && plan[0].Action == CopyActionSkip {
+			return callback(src, dst, nil)
+		}
 		return os.Remove(src)
 	}
 	// 复制文件夹
-	err := CopyFiles(path.Clean(src), path.Clean(dst), replace, ignore, func(srcPath, dstPath string, err error) error {
+	opts.Callback = func(srcPath, dstPath string, err error) error {
 		if err == nil && IsFile(srcPath) {
 			err = os.Remove(srcPath)
 		}
 		return callback(srcPath, dstPath, err)
-	})
+	}
+	plan, err := CopyTree(context.Background(), path.Clean(src), path.Clean(dst), opts)
+	if IsNotExistError(err) || IsExistError(err) {
+		// 源路径不存在或目标是文件, 与CopyFiles一致交给回调处理
+		return callback(src, dst, err)
+	}
+	if err == nil && len(plan) == 1 && plan[0].Action == CopyActionSkip {
+		// 目标是文件且跳过, 保留源文件夹
+		return callback(src, dst, nil)
+	}
 	// 最后的清理
 	if err == nil {
 		err = os.RemoveAll(src)
@@ -258,50 +249,23 @@ func MoveFileByCopying(src, dst string, replace, ignore bool, callback MoveCallb
 	return err
 }
 
-// CopyFile 复制文件(源路径, 目标路径, 重复覆盖, 重复忽略)
+// CopyFile 复制文件(源路径, 目标路径, 重复覆盖, 重复忽略), 不保留元数据
 func CopyFile(src, dst string, replace, ignore bool) error {
-	if src == dst && len(src) > 0 {
-		return nil
-	}
+	return CopyFileWith(src, dst, conflictFromFlags(replace, ignore))
+}
+
+// CopyFileWith 复制文件(源路径, 目标路径, 冲突策略), 与CopyTree使用相同的复制流程, 不保留元数据
+func CopyFileWith(src, dst string, conflict ConflictOpts) error {
+	return CopyFilePreserve(src, dst, conflict, PreserveOpts{})
+}
+
+// CopyFilePreserve 复制文件(源路径, 目标路径, 冲突策略, 保留的元数据)
+// 源路径是指向文件的符号链接且保留符号链接时, 复制链接本身
+func CopyFilePreserve(src, dst string, conflict ConflictOpts, preserve PreserveOpts) error {
 	if !IsFile(src) {
 		return PathNotExist("CopyFile", src)
 	}
-	if IsExist(dst) {
-		if replace {
-			var err error
-			if IsFile(src) {
-				err = os.Remove(dst)
-			} else {
-				err = os.RemoveAll(dst)
-			}
-			if err != nil {
-				return err
-			}
-		} else if ignore {
-			return nil
-		} else {
-			return PathExist("CopyFile", dst)
-		}
-	}
-	RSrc, err := OpenFile(src)
-	defer func() {
-		if nil != RSrc {
-			RSrc.Close()
-		}
-	}()
-	if err != nil {
-		return err
-	}
-	WDst, err := GetWriter(dst)
-	defer func() {
-		if nil != WDst {
-			WDst.Close()
-		}
-	}()
-	if err != nil {
-		return err
-	}
-	_, err = io.Copy(WDst, RSrc)
+	_, err := CopyTree(context.Background(), src, dst, CopyOpts{Conflict: conflict, Preserve: preserve})
 	return err
 }
 
@@ -309,6 +273,18 @@ func CopyFile(src, dst string, replace, ignore bool) error {
 // 如果callback返回错误非空, 该文件则为处理失败, 终止其他操作
 // 如果callback返回nil则继续往下拷贝, 无论是否真的出错
 func CopyFiles(src, dst string, replace, ignore bool, callback CopyCallback) error {
+	return CopyFilesWith(src, dst, conflictFromFlags(replace, ignore), callback)
+}
+
+// CopyFilesWith 复制文件夹 (源路径, 目标路径, 冲突策略, 操作回调) 返回错误即可终止后续拷贝
+// 文件夹之间合并, 其中的文件按冲突策略处理, 不保留元数据, 符号链接复制指向的内容
+// 使用CopyTree并发复制, callback串行调用, 文件的完成顺序与遍历顺序不一定一致
+func CopyFilesWith(src, dst string, conflict ConflictOpts, callback CopyCallback) error {
+	return CopyFilesPreserve(src, dst, conflict, PreserveOpts{}, callback)
+}
+
+// CopyFilesPreserve 复制文件夹 (源路径, 目标路径, 冲突策略, 保留的元数据, 操作回调), 其他规则与CopyFilesWith相同
+func CopyFilesPreserve(src, dst string, conflict ConflictOpts, preserve PreserveOpts, callback CopyCallback) error {
 	if src == dst && len(src) > 0 {
 		return nil
 	}
@@ -318,95 +294,26 @@ func CopyFiles(src, dst string, replace, ignore bool, callback CopyCallback) err
 	if IsFile(dst) {
 		return callback(src, dst, PathExist("CopyFiles", dst))
 	}
-	srcLen := len(src)
-	return filepath.Walk(src, func(s string, f os.FileInfo, err error) error {
-		d := dst + s[srcLen:]
-		if err == nil {
-			if f.IsDir() {
-				if !IsDir(d) {
-					err = os.Mkdir(d, os.ModePerm)
-				}
-			} else {
-				err = CopyFile(s, d, replace, ignore)
-			}
-		}
-		return callback(s, d, err)
-	})
+	_, err := CopyTree(context.Background(), src, dst, CopyOpts{Conflict: conflict, Preserve: preserve, Callback: callback})
+	return err
 }
 
 // ReadFileAsJSON 读取Json文件
 func ReadFileAsJSON(path string, v interface{}) error {
-	if len(path) == 0 {
-		return PathNotExist("ReadFileAsJSON", path)
-	}
-	fp, err := os.OpenFile(path, os.O_RDONLY, 0)
-	defer func() {
-		if nil != fp {
-			fp.Close()
-		}
-	}()
-
-	if err == nil {
-		st, stErr := fp.Stat()
-		if stErr == nil {
-			data := make([]byte, st.Size())
-			_, err = fp.Read(data)
-			if err == nil {
-				return json.Unmarshal(data, v)
-			}
-		} else {
-			err = stErr
-		}
-	}
-	return err
+	return ReadFileAsJSONFS(osfs, path, v)
 }
 
 // WriteFileAsJSON 写入Json文件
 func WriteFileAsJSON(path string, v interface{}) error {
-	if len(path) == 0 {
-		return PathNotExist("WriteFileAsJSON", path)
-	}
-	fp, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0666)
-	defer func() {
-		if nil != fp {
-			fp.Close()
-		}
-	}()
-
-	if err == nil {
-		data, err := json.Marshal(v)
-		if err == nil {
-			_, err := fp.Write(data)
-			return err
-		}
-		return err
-	}
-	return err
+	return WriteFileAsJSONFS(osfs, path, v)
 }
 
 // WriteTextFile 写入文本文件
 func WriteTextFile(path, text string) error {
-	if len(path) == 0 {
-		return PathNotExist("WriteFile", path)
-	}
-	fp, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0666)
-	defer func() {
-		if nil != fp {
-			fp.Close()
-		}
-	}()
-
-	if err == nil {
-		if err == nil {
-			_, err := fp.Write([]byte(text))
-			return err
-		}
-		return err
-	}
-	return err
+	return WriteTextFileFS(osfs, path, text)
 }
 
-// PathExist 路径已经存在的错误
+// PathExist 路径已经存在的错误, errors.Is(err, ErrExist)
 func PathExist(op, path string) error {
 	return &os.PathError{
 		Op:   op,
@@ -415,7 +322,7 @@ func PathExist(op, path string) error {
 	}
 }
 
-// PathNotExist 路径不存在的错误
+// PathNotExist 路径不存在的错误, errors.Is(err, ErrNotExist)
 func PathNotExist(op, path string) error {
 	return &os.PathError{
 		Op:   op,
@@ -426,42 +333,22 @@ func PathNotExist(op, path string) error {
 
 // IsExistError 是否是目标位置已经存在的错误
 func IsExistError(err error) bool {
-	if nil == err {
-		return false
-	}
-	var cpErr error
-	switch err := err.(type) {
-	case *os.PathError:
-		cpErr = err.Err
-	}
-	if cpErr == nil {
-		return false
-	}
-	return cpErr.Error() == os.ErrExist.Error()
+	return errors.Is(err, ErrExist)
 }
 
 // IsNotExistError 是否是目标位置不存在的错误
 func IsNotExistError(err error) bool {
-	var cpErr error
-	switch err := err.(type) {
-	case *os.PathError:
-		cpErr = err.Err
-	}
-	if cpErr == nil {
-		return false
-	}
-	return cpErr.Error() == os.ErrNotExist.Error()
+	return errors.Is(err, ErrNotExist)
 }
 
 // IsAcrossDiskError 是否是跨磁盘错误
 func IsAcrossDiskError(err error) bool {
-	var cpErr error
-	switch err := err.(type) {
-	case *os.LinkError:
-		cpErr = err.Err
+	if errors.Is(err, ErrCrossDevice) {
+		return true
 	}
-	if cpErr == nil {
-		return false
+	var linkErr *os.LinkError
+	if errors.As(err, &linkErr) {
+		return isCrossDeviceErrno(linkErr.Err)
 	}
-	return cpErr.Error() == "The system cannot move the file to a different disk drive."
+	return false
 }
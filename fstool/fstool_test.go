@@ -10,9 +10,20 @@
 package fstool
 
 import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"io/ioutil"
 	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"syscall"
 	"testing"
+	"testing/fstest"
+	"time"
 )
 
 func TestGetDirList(t *testing.T) {
@@ -20,3 +31,1229 @@ func TestGetDirList(t *testing.T) {
 	list, _ := GetDirList(path)
 	fmt.Println(path, list)
 }
+
+// mkTree 在dir下创建文件, 以'/'结尾的为文件夹
+func mkTree(t *testing.T, dir string, files ...string) {
+	for _, file := range files {
+		p := filepath.Join(dir, file)
+		if strings.HasSuffix(file, "/") {
+			if err := MkdirAll(p); nil != err {
+				t.Fatal(err)
+			}
+			continue
+		}
+		if err := MkdirAll(filepath.Dir(p)); nil != err {
+			t.Fatal(err)
+		}
+		if err := WriteTextFile(p, file); nil != err {
+			t.Fatal(err)
+		}
+	}
+}
+
+// 测试遍历时的过滤、.gitignore、符号链接循环、最大深度和提前结束
+func TestWalk(t *testing.T) {
+	root := t.TempDir()
+	mkTree(t, root, "a.go", "a.txt", "src/b.go", "src/sub/c.go", "build/out.go", "vendor/x/d.go", "src/.gitignore")
+	WriteTextFile(filepath.Join(root, "src/.gitignore"), "sub/\n")
+	os.Symlink(root, filepath.Join(root, "src/loop"))
+
+	list := make([]string, 0)
+	err := Walk(root, WalkOpts{
+		Include:     []string{"**/*.go"},
+		Exclude:     []string{"build/", "vendor"},
+		IgnoreFiles: []string{".gitignore"},
+		Symlinks:    SymlinkFollow,
+		Sorted:      true,
+	}, func(entry WalkEntry, err error) error {
+		if err == ErrSymlinkLoop {
+			list = append(list, "loop:"+entry.RelPath)
+			return nil
+		}
+		if nil != err {
+			return err
+		}
+		list = append(list, entry.RelPath)
+		return nil
+	})
+	if nil != err {
+		t.Fatal(err)
+	}
+	if strings.Join(list, ",") != "a.go,src,src/b.go,loop:src/loop" {
+		t.Fatal("遍历结果错误:", list)
+	}
+
+	// 限制深度和提前结束
+	count := 0
+	err = Walk(root, WalkOpts{MaxDepth: 1, Symlinks: SymlinkSkip}, func(entry WalkEntry, err error) error {
+		if entry.Depth > 1 {
+			t.Fatal("超过了最大深度:", entry.RelPath)
+		}
+		if count++; count == 2 {
+			return StopWalk
+		}
+		return nil
+	})
+	if nil != err || count != 2 {
+		t.Fatal("提前结束遍历失败", err, count)
+	}
+}
+
+// 测试并发复制的计划、执行、进度和取消
+func TestCopyTree(t *testing.T) {
+	src, dst := t.TempDir(), filepath.Join(t.TempDir(), "dst")
+	mkTree(t, src, "a.txt", "b/c.txt", "b/d/e.txt", "empty/")
+
+	plan, err := CopyTree(context.Background(), src, dst, CopyOpts{DryRun: true})
+	if nil != err || len(plan) != 7 || IsExist(dst) {
+		t.Fatal("dry-run结果错误:", err, plan)
+	}
+
+	var last CopyProgress
+	copied := 0
+	_, err = CopyTree(context.Background(), src, dst, CopyOpts{
+		Workers: 2,
+		Progress: func(p CopyProgress) {
+			last = p
+		},
+		Callback: func(srcPath, dstPath string, err error) error {
+			copied++
+			return err
+		},
+	})
+	if nil != err {
+		t.Fatal(err)
+	}
+	if copied != 7 || !last.Done || last.CopiedFiles != 3 || last.CopiedBytes != last.TotalBytes || !IsFile(filepath.Join(dst, "b/d/e.txt")) || !IsDir(filepath.Join(dst, "empty")) {
+		t.Fatal("复制结果错误:", copied, last)
+	}
+
+	// 目标已存在且不覆盖不忽略
+	_, err = CopyTree(context.Background(), src, dst, CopyOpts{})
+	if !IsExistError(err) {
+		t.Fatal("目标已存在未报错:", err)
+	}
+	// 取消
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err = CopyTree(ctx, src, dst+"2", CopyOpts{}); err != context.Canceled {
+		t.Fatal("取消后未返回context.Canceled:", err)
+	}
+}
+
+// 测试CopyFiles的回调: 出错交给回调决定是否继续, 回调返回错误则终止
+func TestCopyFiles(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	mkTree(t, src, "a.txt", "sub/", "sub/b.txt", "sub/c.txt", "locked/", "locked/d.txt")
+	mkTree(t, dst, "sub/", "sub/b.txt")
+	if runtime.GOOS != "windows" && os.Geteuid() != 0 {
+		os.Chmod(filepath.Join(src, "locked"), 0)
+		defer os.Chmod(filepath.Join(src, "locked"), 0755)
+	}
+
+	var calls, failed []string
+	err := CopyFiles(src, dst, false, false, func(srcPath, dstPath string, err error) error {
+		calls = append(calls, filepath.Base(srcPath))
+		if nil != err {
+			failed = append(failed, filepath.Base(srcPath))
+		}
+		return nil
+	})
+	if nil != err || len(calls) < 6 || len(failed) < 1 || !IsFile(filepath.Join(dst, "a.txt")) || !IsFile(filepath.Join(dst, "sub/c.txt")) {
+		t.Fatal("出错后应继续复制", err, calls, failed)
+	}
+	if data, _ := ioutil.ReadFile(filepath.Join(dst, "sub/b.txt")); string(data) != "sub/b.txt" {
+		t.Fatal("已存在的文件被修改")
+	}
+
+	stop := errors.New("stop")
+	err = CopyFiles(src, filepath.Join(t.TempDir(), "dst"), false, false, func(srcPath, dstPath string, err error) error {
+		return stop
+	})
+	if err != stop {
+		t.Fatal("回调返回错误时应终止", err)
+	}
+	if err = CopyFiles(filepath.Join(src, "missing"), dst, false, false, func(srcPath, dstPath string, err error) error {
+		return err
+	}); !IsNotExistError(err) {
+		t.Fatal("源路径不存在时应报错", err)
+	}
+	if err = CopyFiles(src, filepath.Join(dst, "a.txt"), true, false, func(srcPath, dstPath string, err error) error {
+		return err
+	}); !IsExistError(err) {
+		t.Fatal("目标是文件时应报错", err)
+	}
+}
+
+// 测试复制时保留权限、时间和符号链接, 覆盖时截断原有内容
+func TestCopyTreePreserve(t *testing.T) {
+	src, dst := t.TempDir(), filepath.Join(t.TempDir(), "dst")
+	mkTree(t, src, "a.txt", "sub/b.txt")
+	mtime := time.Date(2019, 1, 2, 3, 4, 5, 0, time.Local)
+	os.Chmod(filepath.Join(src, "a.txt"), 0640)
+	os.Chtimes(filepath.Join(src, "a.txt"), mtime, mtime)
+	os.Chtimes(filepath.Join(src, "sub"), mtime, mtime)
+	os.Symlink("a.txt", filepath.Join(src, "link"))
+
+	if _, err := CopyTree(context.Background(), src, dst, CopyOpts{Preserve: PreserveAll}); nil != err {
+		t.Fatal(err)
+	}
+	st, err := os.Stat(filepath.Join(dst, "a.txt"))
+	if nil != err || st.Mode().Perm() != 0640 || !st.ModTime().Equal(mtime) {
+		t.Fatal("文件元数据未保留:", err, st.Mode(), st.ModTime())
+	}
+	if st, err = os.Stat(filepath.Join(dst, "sub")); nil != err || !st.ModTime().Equal(mtime) {
+		t.Fatal("文件夹修改时间未保留:", err)
+	}
+	if target, err := os.Readlink(filepath.Join(dst, "link")); nil != err || target != "a.txt" {
+		t.Fatal("符号链接未保留:", target, err)
+	}
+
+	// 覆盖时截断原有内容
+	WriteTextFile(filepath.Join(dst, "sub/b.txt"), "0123456789012345678901234567890123456789")
+	if err = CopyFile(filepath.Join(src, "sub/b.txt"), filepath.Join(dst, "sub/b.txt"), true, false); nil != err {
+		t.Fatal(err)
+	}
+	if size, _ := GetFileSize(filepath.Join(dst, "sub/b.txt")); size != int64(len("sub/b.txt")) {
+		t.Fatal("覆盖后文件大小错误:", size)
+	}
+
+	// CopyFile|CopyFiles的保留元数据版本
+	if err = CopyFilePreserve(filepath.Join(src, "a.txt"), filepath.Join(dst, "c.txt"), ConflictOpts{}, PreserveOpts{Mode: true, Times: true}); nil != err {
+		t.Fatal(err)
+	}
+	if st, err = os.Stat(filepath.Join(dst, "c.txt")); nil != err || st.Mode().Perm() != 0640 || !st.ModTime().Equal(mtime) {
+		t.Fatal("CopyFilePreserve未保留元数据:", err)
+	}
+	other := filepath.Join(t.TempDir(), "other")
+	if err = CopyFilesPreserve(src, other, ConflictOpts{}, PreserveAll, nil); nil != err {
+		t.Fatal(err)
+	}
+	if target, err := os.Readlink(filepath.Join(other, "link")); nil != err || target != "a.txt" {
+		t.Fatal("CopyFilesPreserve未保留符号链接:", target, err)
+	}
+}
+
+// 测试从中断的位置续传, 已复制的内容不一致时重新复制
+func TestCopyResume(t *testing.T) {
+	dir := t.TempDir()
+	src, dst := filepath.Join(dir, "src.bin"), filepath.Join(dir, "dst.bin")
+	data := make([]byte, 3<<20)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+	ioutil.WriteFile(src, data, 0666)
+
+	// 已复制的前缀一致, 从1MB处继续
+	ioutil.WriteFile(PartialPath(dst), data[:1<<20], 0666)
+	var last CopyProgress
+	_, err := CopyTree(context.Background(), src, dst, CopyOpts{Resume: true, Verify: true, Progress: func(p CopyProgress) {
+		last = p
+	}})
+	if nil != err {
+		t.Fatal(err)
+	}
+	res, _ := ioutil.ReadFile(dst)
+	if !bytes.Equal(res, data) || IsExist(PartialPath(dst)) || last.CopiedBytes != int64(len(data)) {
+		t.Fatal("续传结果错误")
+	}
+
+	// 已复制的内容不一致, 重新复制
+	os.Remove(dst)
+	ioutil.WriteFile(PartialPath(dst), []byte("broken"), 0666)
+	if _, err = CopyTree(context.Background(), src, dst, CopyOpts{Resume: true, Verify: true}); nil != err {
+		t.Fatal(err)
+	}
+	if res, _ = ioutil.ReadFile(dst); !bytes.Equal(res, data) {
+		t.Fatal("前缀不一致时未重新复制")
+	}
+
+	// 跨分区移动使用续传复制
+	moved := filepath.Join(dir, "moved.bin")
+	err = MoveFileByCopying(src, moved, false, false, func(srcPath, dstPath string, err error) error {
+		return err
+	})
+	if res, _ = ioutil.ReadFile(moved); nil != err || IsExist(src) || !bytes.Equal(res, data) {
+		t.Fatal("移动结果错误:", err)
+	}
+}
+
+// 测试跨分区移动时退化为复制后删除
+func TestMoveAcrossDisk(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	dst := filepath.Join(dir, "dst")
+	mkTree(t, src, "a.txt", "sub/", "sub/b.txt")
+
+	// 模拟跨分区: rename总是返回EXDEV
+	rename = func(oldpath, newpath string) error {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: syscall.EXDEV}
+	}
+	defer func() { rename = os.Rename }()
+
+	err := MoveFiles(src, dst, false, false, func(_, _ string, err error) error { return err })
+	if !errors.Is(err, ErrCrossDevice) || !IsAcrossDiskError(err) {
+		t.Fatal("跨分区错误识别失败", err)
+	}
+	if !errors.Is(err, syscall.EXDEV) {
+		t.Fatal("应保留原始系统错误", err)
+	}
+	err = MoveFilesAcrossDisk(src, dst, false, false, func(_, _ string, err error) error { return err })
+	if nil != err {
+		t.Fatal("跨分区移动失败", err)
+	}
+	if IsExist(src) {
+		t.Fatal("源文件夹应被删除")
+	}
+	for _, name := range []string{"a.txt", "sub/b.txt"} {
+		if !IsFile(filepath.Join(dst, name)) {
+			t.Fatal("目标文件不存在", name)
+		}
+	}
+}
+
+// 测试错误可以用errors.Is判断类型
+func TestErrorSentinels(t *testing.T) {
+	if !errors.Is(PathExist("op", "p"), ErrExist) || !IsExistError(PathExist("op", "p")) {
+		t.Fatal("ErrExist判断失败")
+	}
+	if !errors.Is(PathNotExist("op", "p"), ErrNotExist) || !IsNotExistError(PathNotExist("op", "p")) {
+		t.Fatal("ErrNotExist判断失败")
+	}
+	_, err := os.Stat(filepath.Join(t.TempDir(), "none"))
+	if !IsNotExistError(err) || IsExistError(err) || IsAcrossDiskError(err) {
+		t.Fatal("系统错误判断失败", err)
+	}
+	if IsExistError(nil) || IsAcrossDiskError(nil) {
+		t.Fatal("nil不是错误")
+	}
+}
+
+// 测试复制时各种冲突策略的处理结果
+func TestConflictPolicy(t *testing.T) {
+	mkDst := func(t *testing.T, dst string) {
+		mkTree(t, dst, "a.txt", "d")
+		if err := WriteTextFile(filepath.Join(dst, "b.txt"), "old"); nil != err {
+			t.Fatal(err)
+		}
+	}
+	readText := func(t *testing.T, path string) string {
+		data, err := ioutil.ReadFile(path)
+		if nil != err {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+	src := filepath.Join(t.TempDir(), "src")
+	mkTree(t, src, "a.txt", "b.txt", "c.txt", "d/e.txt")
+
+	// 重命名
+	dst := filepath.Join(t.TempDir(), "dst")
+	mkDst(t, dst)
+	if _, err := CopyTree(context.Background(), src, dst, CopyOpts{Conflict: ConflictOpts{Policy: ConflictRename}}); nil != err {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"a (1).txt", "b (1).txt", "c.txt", "d (1)/e.txt"} {
+		if !IsFile(filepath.Join(dst, name)) {
+			t.Fatal("重命名后的文件不存在", name)
+		}
+	}
+	if readText(t, filepath.Join(dst, "b.txt")) != "old" || !IsFile(filepath.Join(dst, "d")) {
+		t.Fatal("重命名时不应修改已存在的文件")
+	}
+
+	// 内容不同时覆盖, 文件被同名文件夹覆盖
+	dst = filepath.Join(t.TempDir(), "dst")
+	mkDst(t, dst)
+	var calls []string
+	err := CopyFilesWith(src, dst, ConflictOpts{Policy: ConflictOverwriteDifferent}, func(srcPath, dstPath string, err error) error {
+		calls = append(calls, filepath.Base(srcPath))
+		return err
+	})
+	if nil != err {
+		t.Fatal(err)
+	}
+	if readText(t, filepath.Join(dst, "b.txt")) != "b.txt" || !IsFile(filepath.Join(dst, "d/e.txt")) || len(calls) != 6 {
+		t.Fatal("内容不同时应覆盖", calls)
+	}
+
+	// 目标较新时跳过
+	dst = filepath.Join(t.TempDir(), "dst")
+	mkDst(t, dst)
+	future := time.Now().Add(time.Hour)
+	if err = os.Chtimes(filepath.Join(dst, "b.txt"), future, future); nil != err {
+		t.Fatal(err)
+	}
+	if err = CopyFileWith(filepath.Join(src, "b.txt"), filepath.Join(dst, "b.txt"), ConflictOpts{Policy: ConflictOverwriteNewer}); nil != err {
+		t.Fatal(err)
+	}
+	if readText(t, filepath.Join(dst, "b.txt")) != "old" {
+		t.Fatal("目标较新时不应覆盖")
+	}
+
+	// 逐个询问, 移动后跳过的源文件随源文件夹删除
+	dst = filepath.Join(t.TempDir(), "dst")
+	mkDst(t, dst)
+	asked := 0
+	conflict := ConflictOpts{Policy: ConflictAsk, Ask: func(src, dst string) (ConflictPolicy, error) {
+		asked++
+		if filepath.Base(src) == "a.txt" {
+			return ConflictSkip, nil
+		}
+		return ConflictRename, nil
+	}}
+	err = MoveFilesWith(src, dst, conflict, func(srcPath, dstPath string, err error) error { return err })
+	if nil != err {
+		t.Fatal(err)
+	}
+	if asked != 3 || IsExist(src) || IsExist(filepath.Join(dst, "a (1).txt")) || !IsFile(filepath.Join(dst, "b (1).txt")) || !IsFile(filepath.Join(dst, "d (1)/e.txt")) {
+		t.Fatal("询问结果处理错误", asked)
+	}
+
+	// 默认报错
+	if err = CopyFileWith(filepath.Join(dst, "c.txt"), filepath.Join(dst, "b.txt"), ConflictOpts{}); !errors.Is(err, ErrExist) {
+		t.Fatal("默认应返回ErrExist", err)
+	}
+}
+
+// 测试重命名策略生成不重复的文件名
+func TestUniqueName(t *testing.T) {
+	dir := t.TempDir()
+	mkTree(t, dir, "x.tar.gz", ".bashrc", "a.txt", "a (1).txt")
+	cases := map[string]string{
+		"x.tar.gz": "x.tar (1).gz",
+		".bashrc":  ".bashrc (1)",
+		"a.txt":    "a (2).txt",
+	}
+	for name, want := range cases {
+		if got := uniqueName(osfs, filepath.Join(dir, name), nil); got != filepath.Join(dir, want) {
+			t.Fatal("重命名错误", name, got)
+		}
+	}
+	if got := uniqueName(osfs, filepath.Join(dir, "a.txt"), map[string]bool{filepath.Join(dir, "a (2).txt"): true}); got != filepath.Join(dir, "a (3).txt") {
+		t.Fatal("应跳过已占用的名字", got)
+	}
+}
+
+// 测试内存文件系统, 以及与本地磁盘之间复制和移动
+func TestMemFS(t *testing.T) {
+	mfs := NewMemFS()
+	if err := MkdirAllFS(mfs, "/a/b"); nil != err {
+		t.Fatal(err)
+	}
+	if err := WriteTextFileFS(mfs, "/a/b/c.txt", "hello"); nil != err {
+		t.Fatal(err)
+	}
+	if err := WriteFileAsJSONFS(mfs, "a/conf.json", map[string]int{"n": 1}); nil != err {
+		t.Fatal(err)
+	}
+	var conf map[string]int
+	if err := ReadFileAsJSONFS(mfs, "/a/conf.json", &conf); nil != err || conf["n"] != 1 {
+		t.Fatal("JSON读写失败", conf, err)
+	}
+	if _, err := mfs.Stat("/a/x"); !IsNotExistError(err) {
+		t.Fatal("不存在的文件应返回ErrNotExist", err)
+	}
+	if err := mfs.Mkdir("/a", 0755); !IsExistError(err) {
+		t.Fatal("已存在的文件夹应返回ErrExist", err)
+	}
+	if err := mfs.Remove("/a"); nil == err {
+		t.Fatal("不能删除非空文件夹")
+	}
+	fp, err := mfs.OpenFile("/a/b/c.txt", os.O_WRONLY|os.O_APPEND, 0)
+	if nil != err {
+		t.Fatal(err)
+	}
+	fp.Write([]byte(" world"))
+	fp.Close()
+	if data, _ := ReadFileFS(mfs, "/a/b/c.txt"); string(data) != "hello world" {
+		t.Fatal("追加写入错误", string(data))
+	}
+
+	// 内存与本地磁盘之间复制, 内存中移动
+	dir := t.TempDir()
+	mkTree(t, dir, "x/1.txt", "x/y/2.txt")
+	if err = CopyFilesFS(osfs, filepath.Join(dir, "x"), mfs, "/x", ConflictOpts{}, func(_, _ string, err error) error { return err }); nil != err {
+		t.Fatal(err)
+	}
+	if err = MoveFilesFS(mfs, "/x", "/a/b", ConflictOpts{}, func(_, _ string, err error) error { return err }); nil != err {
+		t.Fatal(err)
+	}
+	names, _ := ReadDirNamesFS(mfs, "/a/b")
+	if fmt.Sprint(names) != "[1.txt c.txt y]" || IsExistFS(mfs, "/x") {
+		t.Fatal("合并移动失败", names)
+	}
+	if err = CopyFilesFS(mfs, "/a", osfs, filepath.Join(dir, "a"), ConflictOpts{}, func(_, _ string, err error) error { return err }); nil != err {
+		t.Fatal(err)
+	}
+	if !IsFile(filepath.Join(dir, "a/b/y/2.txt")) {
+		t.Fatal("复制到磁盘失败")
+	}
+	// 本地之间复制与CopyFilesWith结果一致, 冲突时返回同样的错误
+	for _, target := range []string{"fs", "with"} {
+		copyFiles := CopyFilesWith
+		if target == "fs" {
+			copyFiles = func(src, dst string, conflict ConflictOpts, callback CopyCallback) error {
+				return CopyFilesFS(osfs, src, osfs, dst, conflict, callback)
+			}
+		}
+		dst := filepath.Join(dir, target)
+		if err = copyFiles(filepath.Join(dir, "a"), dst, ConflictOpts{}, func(_, _ string, err error) error { return err }); nil != err {
+			t.Fatal(err)
+		}
+		err = copyFiles(filepath.Join(dir, "a"), dst, ConflictOpts{}, func(_, _ string, err error) error { return err })
+		if files, _ := GetDirList(dst); fmt.Sprint(files) != "[b conf.json]" || !errors.Is(err, ErrExist) {
+			t.Fatal("本地之间复制结果不一致", target, files, err)
+		}
+	}
+
+	// io/fs互通
+	if err = fstest.TestFS(IOFS(mfs), "a/conf.json", "a/b/c.txt", "a/b/y/2.txt"); nil != err {
+		t.Fatal(err)
+	}
+	rfs := FromIOFS(os.DirFS(dir))
+	if data, err := ReadFileFS(rfs, "/a/b/1.txt"); nil != err || string(data) != "x/1.txt" {
+		t.Fatal("读取io/fs失败", string(data), err)
+	}
+	if err = WriteTextFileFS(rfs, "new.txt", ""); !errors.Is(err, ErrReadOnly) {
+		t.Fatal("io/fs应为只读", err)
+	}
+}
+
+// 测试限定目录和只读的文件系统包装
+func TestWrapFS(t *testing.T) {
+	dir := t.TempDir()
+	mkTree(t, dir, "root/a.txt", "secret.txt")
+	bfs := NewBasePathFS(NewOSFS(), filepath.Join(dir, "root"))
+	if !IsFileFS(bfs, "/a.txt") || IsExistFS(bfs, "../secret.txt") {
+		t.Fatal("限定目录的路径错误")
+	}
+	if err := WriteTextFileFS(bfs, "../../b.txt", "b"); nil != err {
+		t.Fatal(err)
+	}
+	if !IsFile(filepath.Join(dir, "root/b.txt")) {
+		t.Fatal("不能写到限定目录以外")
+	}
+	if _, err := bfs.Stat("none"); !IsNotExistError(err) || !strings.Contains(err.Error(), "none") || strings.Contains(err.Error(), dir) {
+		t.Fatal("错误信息应使用相对路径", err)
+	}
+	if err := fstest.TestFS(IOFS(bfs), "a.txt", "b.txt"); nil != err {
+		t.Fatal(err)
+	}
+	// 目录中的符号链接不能用来访问目录以外的内容, 链接本身可以删除
+	if runtime.GOOS != "windows" {
+		os.Symlink(dir, filepath.Join(dir, "root/up"))
+		os.Symlink(filepath.Join(dir, "secret.txt"), filepath.Join(dir, "root/link.txt"))
+		if _, err := ReadFileFS(bfs, "up/secret.txt"); !errors.Is(err, ErrSymlink) {
+			t.Fatal("不应经过指向目录以外的文件夹链接", err)
+		}
+		if err := WriteTextFileFS(bfs, "link.txt", "x"); !errors.Is(err, ErrSymlink) {
+			t.Fatal("不应写入指向目录以外的文件链接", err)
+		}
+		if data, _ := ioutil.ReadFile(filepath.Join(dir, "secret.txt")); string(data) != "secret.txt" {
+			t.Fatal("目录以外的文件被修改", string(data))
+		}
+		if err := bfs.MkdirAll("up/escape", 0755); !errors.Is(err, ErrSymlink) || IsExist(filepath.Join(dir, "escape")) {
+			t.Fatal("不应在目录以外创建文件夹", err)
+		}
+		if st, err := bfs.Lstat("link.txt"); nil != err || st.Mode()&os.ModeSymlink == 0 {
+			t.Fatal("Lstat应返回链接本身", err)
+		}
+		if err := bfs.Remove("link.txt"); nil != err || !IsFile(filepath.Join(dir, "secret.txt")) {
+			t.Fatal("删除链接失败", err)
+		}
+		bfs.Remove("up")
+	}
+
+	rfs := NewReadOnlyFS(bfs)
+	if data, err := ReadFileFS(rfs, "a.txt"); nil != err || string(data) != "root/a.txt" {
+		t.Fatal("只读文件系统读取失败", err)
+	}
+	for _, err := range []error{
+		WriteTextFileFS(rfs, "a.txt", "x"),
+		rfs.Mkdir("d", 0755),
+		rfs.Remove("a.txt"),
+		rfs.Rename("a.txt", "c.txt"),
+		rfs.Chmod("a.txt", 0600),
+		CopyFileFS(bfs, "a.txt", rfs, "c.txt", ConflictOpts{}),
+	} {
+		if !errors.Is(err, ErrReadOnly) {
+			t.Fatal("只读文件系统应返回ErrReadOnly", err)
+		}
+	}
+}
+
+// 测试压缩和解压zip、tar.gz, 以及不安全的路径和大小限制
+func TestArchive(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	mkTree(t, src, "a.txt", "b/c.txt", "b/d.log", "empty/")
+	for _, name := range []string{"out.zip", "out.tar.gz"} {
+		archive := filepath.Join(dir, name)
+		// 压缩包在源文件夹中时不会打包自身
+		inner := filepath.Join(src, "self-"+name)
+		if err := CreateArchive(src, inner, ArchiveOpts{Walk: WalkOpts{Exclude: []string{"*.log"}}}); nil != err {
+			t.Fatal(err)
+		}
+		list, err := ListArchive(inner)
+		if nil != err || len(list) != 4 {
+			t.Fatal("打包自身或未过滤", name, list, err)
+		}
+		os.Remove(inner)
+
+		if err = CreateArchive(src, archive, ArchiveOpts{Prefix: "bak", Walk: WalkOpts{Exclude: []string{"*.log"}}}); nil != err {
+			t.Fatal(err)
+		}
+		list, err = ListArchive(archive)
+		var names []string
+		for _, entry := range list {
+			names = append(names, entry.Name)
+		}
+		if nil != err || strings.Join(names, ",") != "bak,bak/a.txt,bak/b,bak/b/c.txt,bak/empty" {
+			t.Fatal("条目错误", name, names, err)
+		}
+		out := filepath.Join(dir, "out-"+name)
+		if err = ExtractArchive(archive, out, ExtractOpts{}); nil != err {
+			t.Fatal(err)
+		}
+		if data, _ := ioutil.ReadFile(filepath.Join(out, "bak/b/c.txt")); string(data) != "b/c.txt" || !IsDir(filepath.Join(out, "bak/empty")) {
+			t.Fatal("解压内容错误", name)
+		}
+		if err = ExtractArchive(archive, out, ExtractOpts{}); !IsExistError(err) {
+			t.Fatal("已存在时应报错", err)
+		}
+		if err = ExtractArchive(archive, filepath.Join(dir, "limit-"+name), ExtractOpts{MaxEntries: 2}); !errors.Is(err, ErrArchiveLimit) {
+			t.Fatal("应限制条目数", err)
+		}
+		if err = ExtractArchive(archive, filepath.Join(dir, "limit-"+name), ExtractOpts{Replace: true, MaxSize: 6}); !errors.Is(err, ErrArchiveLimit) {
+			t.Fatal("应限制大小", err)
+		}
+	}
+
+	// 第一个文件正好用完MaxSize, 后面的文件不能再解压
+	full := filepath.Join(dir, "full.zip")
+	fp, _ := os.Create(full)
+	zw := zip.NewWriter(fp)
+	for _, name := range []string{"first.txt", "second.txt"} {
+		w, _ := zw.Create(name)
+		w.Write([]byte("123456"))
+	}
+	zw.Close()
+	fp.Close()
+	if err := ExtractArchive(full, filepath.Join(dir, "full"), ExtractOpts{MaxSize: 6}); !errors.Is(err, ErrArchiveLimit) {
+		t.Fatal("用完大小限制后应报错", err)
+	}
+	if IsExist(filepath.Join(dir, "full", "second.txt")) {
+		t.Fatal("超出大小限制的文件被解压")
+	}
+
+	// 写入io.Writer
+	var buf bytes.Buffer
+	if err := WriteArchive(&buf, filepath.Join(src, "a.txt"), ArchiveOpts{}); nil != err || buf.Len() == 0 {
+		t.Fatal("写入io.Writer失败", err)
+	}
+
+	// zip-slip
+	evil := filepath.Join(dir, "evil.zip")
+	fp, _ = os.Create(evil)
+	zw = zip.NewWriter(fp)
+	w, _ := zw.Create("../../evil.txt")
+	w.Write([]byte("evil"))
+	zw.Close()
+	fp.Close()
+	if err := ExtractArchive(evil, filepath.Join(dir, "slip"), ExtractOpts{}); !errors.Is(err, ErrUnsafePath) {
+		t.Fatal("应拒绝超出目标文件夹的路径", err)
+	}
+	if IsExist(filepath.Join(dir, "evil.txt")) || IsExist(filepath.Join(filepath.Dir(dir), "evil.txt")) {
+		t.Fatal("写到了目标文件夹以外")
+	}
+}
+
+// 测试压缩包中的符号链接只能指向解压目录以内
+func TestArchiveSymlink(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	mkTree(t, src, "a.txt")
+	if err := os.Symlink("a.txt", filepath.Join(src, "link")); nil != err {
+		t.Skip("不支持符号链接", err)
+	}
+	os.Symlink("../../outside", filepath.Join(src, "zbad"))
+	archive := filepath.Join(dir, "link.tar.gz")
+	if err := CreateArchive(src, archive, ArchiveOpts{}); nil != err {
+		t.Fatal(err)
+	}
+	out := filepath.Join(dir, "out")
+	if err := ExtractArchive(archive, out, ExtractOpts{}); nil != err || isExistLstat(filepath.Join(out, "link")) {
+		t.Fatal("默认应跳过符号链接", err)
+	}
+	if err := ExtractArchive(archive, out, ExtractOpts{Symlinks: true, Replace: true}); !errors.Is(err, ErrUnsafePath) {
+		t.Fatal("应拒绝指向目标文件夹以外的链接", err)
+	}
+	if link, err := os.Readlink(filepath.Join(out, "link")); nil != err || link != "a.txt" {
+		t.Fatal("符号链接解压错误", link, err)
+	}
+}
+
+// 测试按大小和时间或按内容对比两个文件夹
+func TestDiffDirs(t *testing.T) {
+	dir := t.TempDir()
+	oldDir, newDir := filepath.Join(dir, "old"), filepath.Join(dir, "new")
+	mkTree(t, oldDir, "same.txt", "removed.txt", "gone/x.txt", "type")
+	mkTree(t, newDir, "same.txt", "added.txt", "type/")
+	// 大小相同内容不同, 修改时间相同
+	WriteTextFile(filepath.Join(oldDir, "mod.txt"), "aaaa")
+	WriteTextFile(filepath.Join(newDir, "mod.txt"), "bbbb")
+	mtime := time.Now().Add(-time.Hour)
+	for _, name := range []string{"old/mod.txt", "new/mod.txt", "old/same.txt", "new/same.txt"} {
+		os.Chtimes(filepath.Join(dir, name), mtime, mtime)
+	}
+	format := func(diffs []DiffEntry) string {
+		var list []string
+		for _, d := range diffs {
+			list = append(list, d.Path+":"+string(d.Kind))
+		}
+		return strings.Join(list, ",")
+	}
+	diffs, err := DiffDirs(context.Background(), oldDir, newDir, DiffOpts{})
+	if nil != err || format(diffs) != "added.txt:added,gone:removed,gone/x.txt:removed,removed.txt:removed,type:modified" {
+		t.Fatal("按大小和时间比较错误", format(diffs), err)
+	}
+	diffs, err = DiffDirs(context.Background(), oldDir, newDir, DiffOpts{Compare: CompareHash, Workers: 2})
+	if nil != err || format(diffs) != "added.txt:added,gone:removed,gone/x.txt:removed,mod.txt:modified,removed.txt:removed,type:modified" {
+		t.Fatal("按内容比较错误", format(diffs), err)
+	}
+	if !diffs[5].IsDir || diffs[3].OldSize != 4 {
+		t.Fatal("差异信息错误", diffs)
+	}
+}
+
+// 测试按内容查找重复文件
+func TestFindDuplicates(t *testing.T) {
+	dir := t.TempDir()
+	for name, text := range map[string]string{"a/1.txt": "same", "a/2.txt": "same", "b/3.txt": "same", "b/4.txt": "diff", "b/5.txt": "other content", "b/6.txt": "other content", "empty1": "", "empty2": ""} {
+		MkdirAll(filepath.Dir(filepath.Join(dir, name)))
+		WriteTextFile(filepath.Join(dir, name), text)
+	}
+	groups, err := FindDuplicates(context.Background(), DupOpts{Workers: 3}, filepath.Join(dir, "a"), filepath.Join(dir, "b"))
+	if nil != err || len(groups) != 2 {
+		t.Fatal("重复文件分组错误", groups, err)
+	}
+	if groups[0].Size != 13 || len(groups[0].Paths) != 2 || len(groups[1].Paths) != 3 || groups[1].Paths[0] != filepath.Join(dir, "a/1.txt") {
+		t.Fatal("重复文件结果错误", groups)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err = FindDuplicates(ctx, DupOpts{}, dir); err != context.Canceled {
+		t.Fatal("取消后应返回context.Canceled", err)
+	}
+}
+
+// 测试单向同步的预演、增量同步和删除多余文件, 被排除的内容保留
+func TestSync(t *testing.T) {
+	dir := t.TempDir()
+	src, dst := filepath.Join(dir, "src"), filepath.Join(dir, "dst")
+	mkTree(t, src, "a.txt", "b/c.txt", "skip.log", "type/x.txt")
+	format := func(report *SyncReport) string {
+		var list []string
+		for _, item := range report.Items {
+			list = append(list, item.Path+":"+string(item.Action))
+		}
+		return strings.Join(list, ",")
+	}
+	opts := SyncOpts{Delete: true, Walk: WalkOpts{Exclude: []string{"*.log"}}, Preserve: PreserveOpts{Mode: true, Times: true}}
+
+	// 目标不存在, 预演不修改
+	opts.DryRun = true
+	report, err := Sync(context.Background(), src, dst, opts)
+	if nil != err || IsExist(dst) || report.Copied != 5 || format(report) != "a.txt:copy,b:copy,b/c.txt:copy,type:copy,type/x.txt:copy" {
+		t.Fatal("预演结果错误", format(report), err)
+	}
+	opts.DryRun = false
+	if _, err = Sync(context.Background(), src, dst, opts); nil != err {
+		t.Fatal(err)
+	}
+	if !IsFile(filepath.Join(dst, "b/c.txt")) || IsExist(filepath.Join(dst, "skip.log")) {
+		t.Fatal("同步结果错误")
+	}
+
+	// 没有变化
+	report, err = Sync(context.Background(), src, dst, opts)
+	if nil != err || len(report.Items) != 0 {
+		t.Fatal("没有变化时不应有操作", format(report), err)
+	}
+
+	// 修改, 删除, 类型变化, 被排除的文件不删除
+	WriteTextFile(filepath.Join(src, "a.txt"), "changed")
+	os.RemoveAll(filepath.Join(src, "b"))
+	os.RemoveAll(filepath.Join(src, "type"))
+	mkTree(t, src, "type")
+	mkTree(t, dst, "extra.log")
+	report, err = Sync(context.Background(), src, dst, opts)
+	if nil != err || format(report) != "a.txt:update,b:delete,b/c.txt:delete,type:update,type/x.txt:delete" || report.Bytes != 7+4 {
+		t.Fatal("增量同步结果错误", format(report), report.Bytes, err)
+	}
+	if data, _ := ioutil.ReadFile(filepath.Join(dst, "a.txt")); string(data) != "changed" || IsExist(filepath.Join(dst, "b")) || !IsFile(filepath.Join(dst, "type")) || !IsFile(filepath.Join(dst, "extra.log")) {
+		t.Fatal("增量同步内容错误")
+	}
+	srcSt, _ := os.Stat(src)
+	dstSt, _ := os.Stat(dst)
+	if !srcSt.ModTime().Equal(dstSt.ModTime()) {
+		t.Fatal("文件夹修改时间未保留", srcSt.ModTime(), dstSt.ModTime())
+	}
+
+	// 多余的文件夹中有被排除的文件时, 保留该文件夹和被排除的文件
+	mkTree(t, dst, "build/keep.log", "build/out.txt", "build/sub/x.txt")
+	if _, err = Sync(context.Background(), src, dst, opts); nil != err {
+		t.Fatal(err)
+	}
+	if !IsFile(filepath.Join(dst, "build/keep.log")) || IsExist(filepath.Join(dst, "build/out.txt")) || IsExist(filepath.Join(dst, "build/sub")) {
+		t.Fatal("删除了被排除的文件或未删除多余的文件")
+	}
+
+	// 默认选项按大小和时间比较, 再次同步没有变化
+	dst = filepath.Join(dir, "plain")
+	if _, err = Sync(context.Background(), src, dst, SyncOpts{}); nil != err {
+		t.Fatal(err)
+	}
+	if report, err = Sync(context.Background(), src, dst, SyncOpts{}); nil != err || len(report.Items) != 0 {
+		t.Fatal("默认选项再次同步不应有操作", format(report), err)
+	}
+}
+
+// 测试文件变化监听, 分别使用inotify和轮询
+func TestWatcher(t *testing.T) {
+	for _, polling := range []bool{false, true} {
+		dir := t.TempDir()
+		w, err := NewWatcher(dir, WatcherOpts{Recursive: true, Debounce: 50 * time.Millisecond, Polling: polling, Interval: 20 * time.Millisecond, Exclude: []string{"*.log"}})
+		if nil != err {
+			t.Fatal(err)
+		}
+		wait := func(path string, op WatchOp) WatchEvent {
+			timeout := time.After(5 * time.Second)
+			for {
+				select {
+				case ev := <-w.Events():
+					if ev.Path == filepath.Join(dir, path) && ev.Op.Has(op) {
+						return ev
+					}
+					if strings.HasSuffix(ev.Path, ".log") {
+						t.Fatal("被排除的文件产生了事件", ev.Path)
+					}
+				case <-timeout:
+					t.Fatal("未收到事件", polling, path, op)
+				}
+			}
+		}
+		mkTree(t, dir, "skip.log", "a.txt")
+		wait("a.txt", WatchCreate)
+		mkTree(t, dir, "sub/", "sub/deep/", "sub/deep/x.txt")
+		wait("sub/deep/x.txt", WatchCreate)
+		os.Rename(filepath.Join(dir, "a.txt"), filepath.Join(dir, "sub", "b.txt"))
+		if ev := wait("sub/b.txt", WatchRename); ev.OldPath != filepath.Join(dir, "a.txt") {
+			t.Fatal("重命名前的路径错误", ev.OldPath)
+		}
+		WriteTextFile(filepath.Join(dir, "sub", "b.txt"), "changed content")
+		wait("sub/b.txt", WatchWrite)
+		os.Remove(filepath.Join(dir, "sub", "deep", "x.txt"))
+		wait("sub/deep/x.txt", WatchRemove)
+		if err = w.Close(); nil != err {
+			t.Fatal(err)
+		}
+		if _, ok := <-w.Events(); ok {
+			t.Fatal("关闭后事件通道未关闭")
+		}
+	}
+}
+
+// 测试监听单个文件, 文件被替换后仍然有效
+func TestWatcherFile(t *testing.T) {
+	dir := t.TempDir()
+	mkTree(t, dir, "config.json", "other.json")
+	w, err := NewWatcher(filepath.Join(dir, "config.json"), WatcherOpts{Debounce: 20 * time.Millisecond})
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	WriteTextFile(filepath.Join(dir, "other.json"), "{}")
+	mkTree(t, dir, "config.json.tmp")
+	os.Rename(filepath.Join(dir, "config.json.tmp"), filepath.Join(dir, "config.json"))
+	select {
+	case ev := <-w.Events():
+		if ev.Path != filepath.Join(dir, "config.json") || !ev.Op.Has(WatchCreate|WatchRename) {
+			t.Fatal("事件错误", ev.Path, ev.Op)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("替换文件未通知")
+	}
+	if s := (WatchCreate | WatchWrite).String(); s != "CREATE|WRITE" {
+		t.Fatal(s)
+	}
+}
+
+// 测试持续变化的文件不会推迟其他文件的事件
+func TestWatcherDebounce(t *testing.T) {
+	dir := t.TempDir()
+	mkTree(t, dir, "busy.txt", "once.txt")
+	w, err := NewWatcher(dir, WatcherOpts{Debounce: 100 * time.Millisecond})
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				return
+			case <-time.After(10 * time.Millisecond):
+				WriteTextFile(filepath.Join(dir, "busy.txt"), fmt.Sprint(i))
+			}
+		}
+	}()
+	time.Sleep(30 * time.Millisecond)
+	WriteTextFile(filepath.Join(dir, "once.txt"), "changed")
+	timeout := time.After(2 * time.Second)
+	for {
+		select {
+		case ev := <-w.Events():
+			if ev.Path == filepath.Join(dir, "once.txt") && ev.Op.Has(WatchWrite) {
+				return
+			}
+		case <-timeout:
+			t.Fatal("持续写入的文件推迟了其他文件的事件")
+		}
+	}
+}
+
+// 测试文件夹空间统计和缓存
+func TestUsage(t *testing.T) {
+	dir := t.TempDir()
+	// 文件内容与相对路径相同, 大小即路径长度
+	mkTree(t, dir, "a.txt", "big/", "big/data.bin", "big/sub/", "big/sub/more.bin", "skip/", "skip/x.log", "small/")
+	usage, err := Usage(context.Background(), dir, UsageOpts{Walk: WalkOpts{Exclude: []string{"*.log"}}, Workers: 2})
+	if nil != err {
+		t.Fatal(err)
+	}
+	if usage.Size != 5+12+16 || usage.Files != 3 || usage.Dirs != 4 || len(usage.Children) != 4 {
+		t.Fatal("统计结果错误", usage.Size, usage.Files, usage.Dirs, len(usage.Children))
+	}
+	if first := usage.Children[0]; first.Name != "big" || first.Size != 28 || first.Files != 2 || first.Dirs != 1 {
+		t.Fatal("下级统计错误", first)
+	}
+	if size, err := DirSize(context.Background(), filepath.Join(dir, "skip")); nil != err || size != 10 {
+		t.Fatal("DirSize错误", size, err)
+	}
+
+	cache := NewUsageCache(UsageOpts{}, 0)
+	if err = cache.CheckQuota(context.Background(), dir, 50, 0); nil != err {
+		t.Fatal(err)
+	}
+	mkTree(t, dir, "big/sub/new.bin")
+	if err = cache.CheckQuota(context.Background(), dir, 50, 0); nil != err {
+		t.Fatal("未失效时应使用缓存", err)
+	}
+	cache.Invalidate(filepath.Join(dir, "big", "sub", "new.bin"))
+	if err = cache.CheckQuota(context.Background(), dir, 50, 0); !errors.Is(err, ErrQuotaExceeded) {
+		t.Fatal("失效后应重新统计", err)
+	}
+
+	space, err := GetDiskSpace(dir)
+	if nil != err || space.Total <= 0 || space.Avail > space.Free || space.Used != space.Total-space.Free {
+		t.Fatal("分区空间错误", space, err)
+	}
+}
+
+// 测试获取文件元数据
+func TestFileMeta(t *testing.T) {
+	dir := t.TempDir()
+	mkTree(t, dir, "a.txt")
+	file := filepath.Join(dir, "a.txt")
+	meta, err := GetFileMeta(file)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if meta.Name != "a.txt" || meta.Size != 5 || meta.IsDir || meta.ModTime.IsZero() || meta.AccessTime.IsZero() {
+		t.Fatal("基本信息错误", meta)
+	}
+	if runtime.GOOS != "windows" && (meta.Inode == 0 || meta.Links != 1 || meta.UID != os.Getuid() || meta.ChangeTime.IsZero()) {
+		t.Fatal("inode、链接数或所有者错误", meta)
+	}
+	created, err := GetCreateTime(file)
+	if meta.HasBirthTime {
+		if nil != err || !created.Equal(meta.BirthTime) || meta.BirthTime.After(time.Now()) {
+			t.Fatal("创建时间错误", created, err)
+		}
+	} else if nil != err || !created.Equal(meta.ModTime) {
+		t.Fatal("不支持创建时间时应返回修改时间", created, err)
+	}
+	if modTime, err := GetModifyTime(file); nil != err || !modTime.Equal(meta.ModTime) {
+		t.Fatal("修改时间错误", modTime, err)
+	}
+
+	if runtime.GOOS == "windows" {
+		return
+	}
+	if err = os.Link(file, filepath.Join(dir, "b.txt")); nil != err {
+		t.Fatal(err)
+	}
+	if err = os.Symlink("a.txt", filepath.Join(dir, "link")); nil != err {
+		t.Fatal(err)
+	}
+	if meta, err = GetFileMeta(filepath.Join(dir, "link")); nil != err || meta.Links != 2 || meta.Symlink {
+		t.Fatal("硬链接数错误", meta, err)
+	}
+	if meta, err = LstatFileMeta(filepath.Join(dir, "link")); nil != err || !meta.Symlink {
+		t.Fatal("符号链接信息错误", meta, err)
+	}
+}
+
+// 测试按扩展名和内容识别文件类型
+func TestDetectContentType(t *testing.T) {
+	docx := new(bytes.Buffer)
+	zw := zip.NewWriter(docx)
+	for _, name := range []string{"[Content_Types].xml", "word/document.xml"} {
+		w, _ := zw.Create(name)
+		w.Write([]byte("<xml/>"))
+	}
+	zw.Close()
+	for _, item := range []struct {
+		name     string
+		data     string
+		mime     string
+		category FileCategory
+		mismatch bool
+	}{
+		{"a.png", "\x89PNG\r\n\x1a\n\x00\x00", "image/png", CategoryImage, false},
+		{"a.jpg", "\x7fELF\x02\x01\x01", "application/x-elf", CategoryExecutable, true},
+		{"a.gif", "MZ\x90\x00", "application/vnd.microsoft.portable-executable", CategoryExecutable, true},
+		{"a.pdf", "%PDF-1.7\n", "application/pdf", CategoryDocument, false},
+		{"a.docx", docx.String(), "application/vnd.openxmlformats-officedocument.wordprocessingml.document", CategoryDocument, false},
+		{"a.zip", docx.String(), "application/vnd.openxmlformats-officedocument.wordprocessingml.document", CategoryDocument, false},
+		{"a.mp4", "\x00\x00\x00\x18ftypisom", "video/mp4", CategoryVideo, false},
+		{"a.m4a", "\x00\x00\x00\x18ftypisom", "audio/mp4", CategoryAudio, false},
+		{"a.webp", "RIFF\x00\x00\x00\x00WEBPVP8 ", "image/webp", CategoryImage, false},
+		{"a.json", `{"a":1}`, "application/json", CategoryText, false},
+		{"a.txt", "#!/bin/sh\nrm -rf /\n", "text/x-shellscript", CategoryExecutable, true},
+		{"a.png", "hello", "text/plain", CategoryText, true},
+		{"readme", "<!DOCTYPE html><html></html>", "text/html", CategoryText, false},
+		{"a.bin", "\x00\x01\x02\x03", mimeOctetStream, CategoryOther, false},
+		{"a.png", "\x00\x01\x02\x03", mimeOctetStream, CategoryOther, true},
+		{"a.jpg", "\xca\xfe\xba\xbe\x00\x00\x00\x34", mimeOctetStream, CategoryOther, true},
+		{"a.docx", "\x00\x01\x02\x03", mimeOctetStream, CategoryOther, true},
+		{"a.mkv", "\x00\x01\x02\x03", mimeOctetStream, CategoryOther, true},
+		{"a.macho", "\xca\xfe\xba\xbe\x00\x00\x00\x02", "application/x-mach-binary", CategoryExecutable, false},
+		{"a.tar", "\x00\x01\x02\x03", "application/x-tar", CategoryArchive, false},
+		{"empty.png", "", "image/png", CategoryImage, false},
+	} {
+		ct := DetectContentType(item.name, []byte(item.data))
+		if ct.MIME != item.mime || ct.Category != item.category || ct.Mismatch() != item.mismatch {
+			t.Fatal("识别结果错误", item.name, ct, ct.Mismatch())
+		}
+	}
+
+	dir := t.TempDir()
+	file := filepath.Join(dir, "a.docx")
+	ioutil.WriteFile(file, docx.Bytes(), 0666)
+	if ct, err := DetectFileType(file); nil != err || ct.Category != CategoryDocument || !ct.Sniffed {
+		t.Fatal("文件识别错误", ct, err)
+	}
+	ct, r, err := DetectReaderType("upload.docx", bytes.NewReader(docx.Bytes()))
+	if data, _ := ioutil.ReadAll(r); nil != err || ct.Category != CategoryDocument || !bytes.Equal(data, docx.Bytes()) {
+		t.Fatal("读取流识别错误", ct, err)
+	}
+}
+
+// 测试临时文件、清理和原子写入
+func TestTempFile(t *testing.T) {
+	dir := t.TempDir()
+	fp, err := TempFile(dir, "upload-*.part")
+	if nil != err {
+		t.Fatal(err)
+	}
+	fp.Close()
+	if name := filepath.Base(fp.Name()); !strings.HasPrefix(name, "upload-") || !strings.HasSuffix(name, ".part") || filepath.Dir(fp.Name()) != dir {
+		t.Fatal("临时文件名错误", fp.Name())
+	}
+	if st, _ := os.Stat(fp.Name()); runtime.GOOS != "windows" && st.Mode().Perm() != 0600 {
+		t.Fatal("临时文件只能当前用户读写", st.Mode())
+	}
+	if _, err = TempFile(dir, "a/b*"); nil == err {
+		t.Fatal("模式中包含路径分隔符时应返回错误")
+	}
+
+	cleanup := NewCleanup()
+	tmpDir, err := cleanup.TempDir(dir, "work-")
+	if nil != err {
+		t.Fatal(err)
+	}
+	mkTree(t, tmpDir, "sub/a.txt")
+	kept, err := cleanup.TempFile(dir, "")
+	if nil != err {
+		t.Fatal(err)
+	}
+	kept.Close()
+	cleanup.Keep(kept.Name())
+	if err = cleanup.Close(); nil != err {
+		t.Fatal(err)
+	}
+	if IsExist(tmpDir) || !IsFile(kept.Name()) {
+		t.Fatal("清理结果错误")
+	}
+	if err = cleanup.Add(kept.Name()); !errors.Is(err, os.ErrClosed) {
+		t.Fatal("关闭后不能再登记", err)
+	}
+
+	target := filepath.Join(dir, "target.txt")
+	WriteTextFile(target, "old")
+	os.Chmod(target, 0600)
+	w, err := NewAtomicWriter(target, 0)
+	if nil != err {
+		t.Fatal(err)
+	}
+	w.Write([]byte("discarded"))
+	if err = w.Close(); nil != err || IsExist(w.Name()) {
+		t.Fatal("未提交时应删除临时文件", err)
+	}
+	if data, _ := ioutil.ReadFile(target); string(data) != "old" {
+		t.Fatal("未提交时不应修改目标文件", string(data))
+	}
+	if err = WriteFileAtomic(target, []byte("new"), 0); nil != err {
+		t.Fatal(err)
+	}
+	st, _ := os.Stat(target)
+	if data, _ := ioutil.ReadFile(target); string(data) != "new" || (runtime.GOOS != "windows" && st.Mode().Perm() != 0600) {
+		t.Fatal("原子写入结果错误", string(data), st.Mode())
+	}
+	if names, _ := GetDirList(dir); len(names) != 3 {
+		t.Fatal("残留了临时文件", names)
+	}
+
+	// 写入过程中临时文件为0600, 提交后才是请求的权限
+	if runtime.GOOS != "windows" {
+		w, err = NewAtomicWriter(filepath.Join(dir, "shared.txt"), 0644)
+		if nil != err {
+			t.Fatal(err)
+		}
+		defer w.Close()
+		if st, _ = os.Stat(w.Name()); st.Mode().Perm() != 0600 {
+			t.Fatal("写入中的临时文件权限错误", st.Mode())
+		}
+		w.Write([]byte("shared"))
+		if err = w.Commit(); nil != err {
+			t.Fatal(err)
+		}
+		if st, _ = os.Stat(filepath.Join(dir, "shared.txt")); st.Mode().Perm() != 0644 {
+			t.Fatal("提交后的权限错误", st.Mode())
+		}
+		if err = WriteFileAtomic(filepath.Join(dir, "new.txt"), []byte("new"), 0); nil != err {
+			t.Fatal(err)
+		}
+		if st, _ = os.Stat(filepath.Join(dir, "new.txt")); st.Mode().Perm() != defaultFilePerm() {
+			t.Fatal("新文件应使用默认权限", st.Mode())
+		}
+	}
+}
+
+// 测试回收站的放入、列出、还原和清理
+func TestTrash(t *testing.T) {
+	dir := t.TempDir()
+	trash, err := NewTrash(TrashOpts{Dir: filepath.Join(dir, "Trash")})
+	if nil != err {
+		t.Fatal(err)
+	}
+	mkTree(t, dir, "a b.txt", "docs/", "docs/readme.md")
+	first, err := trash.Put(filepath.Join(dir, "a b.txt"))
+	if nil != err {
+		t.Fatal(err)
+	}
+	mkTree(t, dir, "a b.txt")
+	second, err := trash.Put(filepath.Join(dir, "a b.txt"))
+	if nil != err || second.Name != "a b.2.txt" {
+		t.Fatal("重名时应生成新名称", second, err)
+	}
+	if _, err = trash.Put(filepath.Join(dir, "docs")); nil != err {
+		t.Fatal(err)
+	}
+	if IsExist(filepath.Join(dir, "a b.txt")) || IsExist(filepath.Join(dir, "docs")) {
+		t.Fatal("放入回收站后原路径应不存在")
+	}
+	info, _ := ioutil.ReadFile(filepath.Join(dir, "Trash", "info", "a b.txt.trashinfo"))
+	if !strings.HasPrefix(string(info), "[Trash Info]\nPath="+filepath.ToSlash(dir)+"/a%20b.txt\nDeletionDate=") {
+		t.Fatal("信息文件格式错误", string(info))
+	}
+
+	items, err := trash.List()
+	if nil != err || len(items) != 3 {
+		t.Fatal("列出结果错误", items, err)
+	}
+	for _, item := range items {
+		if item.Name == "docs" && (!item.IsDir || item.Size != int64(len("docs/readme.md")) || item.OriginalPath != filepath.Join(dir, "docs")) {
+			t.Fatal("文件夹信息错误", item)
+		}
+	}
+
+	// 原路径被占用时不能还原
+	mkTree(t, dir, "a b.txt")
+	if err = trash.Restore(*first); !IsExistError(err) {
+		t.Fatal("原路径已存在时应返回ErrExist", err)
+	}
+	os.Remove(filepath.Join(dir, "a b.txt"))
+	if err = trash.Restore(*first); nil != err || !IsFile(filepath.Join(dir, "a b.txt")) {
+		t.Fatal("还原失败", err)
+	}
+
+	// 删除时间改为两天前后清理
+	old := "[Trash Info]\nPath=" + filepath.ToSlash(filepath.Join(dir, "a b.txt")) + "\nDeletionDate=" + time.Now().Add(-48*time.Hour).Format("2006-01-02T15:04:05") + "\n"
+	ioutil.WriteFile(filepath.Join(dir, "Trash", "info", "a b.2.txt.trashinfo"), []byte(old), 0600)
+	if n, err := trash.PurgeOlderThan(24 * time.Hour); nil != err || n != 1 {
+		t.Fatal("按时间清理错误", n, err)
+	}
+	if n, err := trash.PurgeToSize(0); nil != err || n != 1 {
+		t.Fatal("按大小清理错误", n, err)
+	}
+
+	// 超出大小上限时自动清理最早的项, 刚放入的项保留
+	limited, _ := NewTrash(TrashOpts{Dir: filepath.Join(dir, "Trash"), MaxSize: 8})
+	mkTree(t, dir, "x.txt", "y.txt")
+	limited.Put(filepath.Join(dir, "x.txt"))
+	time.Sleep(1100 * time.Millisecond)
+	limited.Put(filepath.Join(dir, "y.txt"))
+	if items, _ = trash.List(); len(items) != 1 || items[0].Name != "y.txt" {
+		t.Fatal("自动清理错误", items)
+	}
+	if err = trash.Empty(); nil != err || IsExist(filepath.Join(dir, "Trash", "files", "y.txt")) {
+		t.Fatal("清空失败", err)
+	}
+}
+
+// 测试分区回收站必须是当前用户私有的真实文件夹
+func TestPrivateTrashDir(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Windows不使用分区回收站")
+	}
+	dir := t.TempDir()
+	if err := privateTrashDir(filepath.Join(dir, ".Trash-1000"), false); !IsNotExistError(err) {
+		t.Fatal("不存在时应返回ErrNotExist", err)
+	}
+	if err := privateTrashDir(filepath.Join(dir, ".Trash-1000"), true); nil != err {
+		t.Fatal("创建失败", err)
+	}
+	// 其他用户预先创建的符号链接和可访问的文件夹
+	mkTree(t, dir, "elsewhere/", "shared/")
+	os.Symlink(filepath.Join(dir, "elsewhere"), filepath.Join(dir, "link"))
+	os.Chmod(filepath.Join(dir, "shared"), 0777)
+	for _, name := range []string{"link", "shared"} {
+		if err := privateTrashDir(filepath.Join(dir, name), true); !errors.Is(err, ErrUnsafeTrash) {
+			t.Fatal("不安全的回收站应拒绝", name, err)
+		}
+	}
+	if os.Getuid() == 0 {
+		mkTree(t, dir, "other/")
+		os.Chmod(filepath.Join(dir, "other"), 0700)
+		os.Chown(filepath.Join(dir, "other"), 65534, 65534)
+		if err := privateTrashDir(filepath.Join(dir, "other"), true); !errors.Is(err, ErrUnsafeTrash) {
+			t.Fatal("其他用户的文件夹应拒绝", err)
+		}
+	}
+}
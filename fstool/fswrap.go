@@ -0,0 +1,409 @@
+// Copyright (C) 2019 WuPeng <wupeng364@outlook.com>.
+// Use of this source code is governed by an MIT-style.
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction,
+// including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software,
+// and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+// 文件工具-文件系统包装
+// 只读文件系统, 限定在某个目录下的文件系统, 以及与io/fs的相互转换
+
+package fstool
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ReadOnlyFS 只读文件系统, 所有写操作返回ErrReadOnly
+type ReadOnlyFS struct {
+	fsys FS
+}
+
+// NewReadOnlyFS 包装为只读文件系统
+func NewReadOnlyFS(fsys FS) *ReadOnlyFS {
+	return &ReadOnlyFS{fsys: fsys}
+}
+
+func readOnlyError(op, name string) error {
+	return &os.PathError{Op: op, Path: name, Err: ErrReadOnly}
+}
+
+// Stat 获取文件信息
+func (rfs *ReadOnlyFS) Stat(name string) (os.FileInfo, error) { return rfs.fsys.Stat(name) }
+
+// Lstat 获取文件信息, 不跟随符号链接
+func (rfs *ReadOnlyFS) Lstat(name string) (os.FileInfo, error) { return LstatFS(rfs.fsys, name) }
+
+// Open 只读打开
+func (rfs *ReadOnlyFS) Open(name string) (File, error) {
+	return rfs.OpenFile(name, os.O_RDONLY, 0)
+}
+
+// Create 返回ErrReadOnly
+func (rfs *ReadOnlyFS) Create(name string) (File, error) {
+	return nil, readOnlyError("open", name)
+}
+
+// OpenFile 只允许只读打开
+func (rfs *ReadOnlyFS) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	if flag&(os.O_WRONLY|os.O_RDWR|os.O_APPEND|os.O_CREATE|os.O_TRUNC) != 0 {
+		return nil, readOnlyError("open", name)
+	}
+	fp, err := rfs.fsys.OpenFile(name, flag, perm)
+	if nil != err {
+		return nil, err
+	}
+	return &readOnlyFile{File: fp}, nil
+}
+
+// Mkdir 返回ErrReadOnly
+func (rfs *ReadOnlyFS) Mkdir(name string, perm os.FileMode) error {
+	return readOnlyError("mkdir", name)
+}
+
+// Remove 返回ErrReadOnly
+func (rfs *ReadOnlyFS) Remove(name string) error { return readOnlyError("remove", name) }
+
+// Rename 返回ErrReadOnly
+func (rfs *ReadOnlyFS) Rename(oldname, newname string) error {
+	return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: ErrReadOnly}
+}
+
+// ReadDir 读取文件夹内容
+func (rfs *ReadOnlyFS) ReadDir(name string) ([]os.DirEntry, error) { return rfs.fsys.ReadDir(name) }
+
+// Chmod 返回ErrReadOnly
+func (rfs *ReadOnlyFS) Chmod(name string, mode os.FileMode) error {
+	return readOnlyError("chmod", name)
+}
+
+// readOnlyFile 只读的文件
+type readOnlyFile struct {
+	File
+}
+
+func (fp *readOnlyFile) Write(p []byte) (int, error) {
+	return 0, readOnlyError("write", fp.Name())
+}
+
+// BasePathFS 限定在某个目录下的文件系统, 路径都相对该目录, 不能通过..访问目录以外的内容
+// 目录中的符号链接可能指向目录以外, 路径经过符号链接时返回ErrSymlink
+// 错误信息中的路径为传入的相对路径
+type BasePathFS struct {
+	fsys FS
+	base string
+}
+
+// NewBasePathFS 创建限定在base目录下的文件系统
+func NewBasePathFS(fsys FS, base string) *BasePathFS {
+	return &BasePathFS{fsys: fsys, base: filepath.Clean(base)}
+}
+
+// realPath 转换为底层文件系统的路径, 检查base以下的每一级, 遇到符号链接时返回ErrSymlink
+// follow为false时不检查最后一级, 用于Lstat、Remove等不跟随符号链接的操作
+func (bfs *BasePathFS) realPath(op, name string, follow bool) (string, error) {
+	rel := path.Clean("/" + filepath.ToSlash(name))
+	if rel == "/" {
+		return bfs.base, nil
+	}
+	parts := strings.Split(rel[1:], "/")
+	real := bfs.base
+	for i, part := range parts {
+		real = filepath.Join(real, part)
+		if i == len(parts)-1 && !follow {
+			break
+		}
+		st, err := LstatFS(bfs.fsys, real)
+		if nil != err {
+			// 不存在时后面的路径也不存在, 交给实际的操作报错
+			break
+		}
+		if st.Mode()&os.ModeSymlink != 0 {
+			return "", &os.PathError{Op: op, Path: name, Err: ErrSymlink}
+		}
+	}
+	return filepath.Join(bfs.base, filepath.FromSlash(rel)), nil
+}
+
+// restoreError 把错误中的真实路径替换为相对路径
+func (bfs *BasePathFS) restoreError(err error, names ...string) error {
+	switch e := err.(type) {
+	case *os.PathError:
+		return &os.PathError{Op: e.Op, Path: names[0], Err: e.Err}
+	case *os.LinkError:
+		if len(names) > 1 {
+			return &os.LinkError{Op: e.Op, Old: names[0], New: names[1], Err: e.Err}
+		}
+	}
+	return err
+}
+
+// Stat 获取文件信息
+func (bfs *BasePathFS) Stat(name string) (os.FileInfo, error) {
+	real, err := bfs.realPath("stat", name, true)
+	if nil != err {
+		return nil, err
+	}
+	st, err := bfs.fsys.Stat(real)
+	return st, bfs.restoreError(err, name)
+}
+
+// Lstat 获取文件信息, 不跟随符号链接
+func (bfs *BasePathFS) Lstat(name string) (os.FileInfo, error) {
+	real, err := bfs.realPath("lstat", name, false)
+	if nil != err {
+		return nil, err
+	}
+	st, err := LstatFS(bfs.fsys, real)
+	return st, bfs.restoreError(err, name)
+}
+
+// Open 只读打开
+func (bfs *BasePathFS) Open(name string) (File, error) {
+	return bfs.OpenFile(name, os.O_RDONLY, 0)
+}
+
+// Create 创建或清空文件, 读写打开
+func (bfs *BasePathFS) Create(name string) (File, error) {
+	return bfs.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+}
+
+// OpenFile 按标志打开文件
+func (bfs *BasePathFS) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	real, err := bfs.realPath("open", name, true)
+	if nil != err {
+		return nil, err
+	}
+	fp, err := bfs.fsys.OpenFile(real, flag, perm)
+	if nil != err {
+		return nil, bfs.restoreError(err, name)
+	}
+	return &basePathFile{File: fp, name: name}, nil
+}
+
+// Mkdir 创建文件夹
+func (bfs *BasePathFS) Mkdir(name string, perm os.FileMode) error {
+	real, err := bfs.realPath("mkdir", name, false)
+	if nil != err {
+		return err
+	}
+	return bfs.restoreError(bfs.fsys.Mkdir(real, perm), name)
+}
+
+// MkdirAll 创建文件夹-多级
+func (bfs *BasePathFS) MkdirAll(name string, perm os.FileMode) error {
+	real, err := bfs.realPath("mkdir", name, true)
+	if nil != err {
+		return err
+	}
+	return bfs.restoreError(MkdirAllFS(bfs.fsys, real), name)
+}
+
+// Remove 删除文件或空文件夹, 符号链接只删除链接本身
+func (bfs *BasePathFS) Remove(name string) error {
+	real, err := bfs.realPath("remove", name, false)
+	if nil != err {
+		return err
+	}
+	return bfs.restoreError(bfs.fsys.Remove(real), name)
+}
+
+// RemoveAll 删除文件|夹及其中的内容
+func (bfs *BasePathFS) RemoveAll(name string) error {
+	real, err := bfs.realPath("removeall", name, false)
+	if nil != err {
+		return err
+	}
+	return bfs.restoreError(RemoveAllFS(bfs.fsys, real), name)
+}
+
+// Rename 重命名, 符号链接只重命名链接本身
+func (bfs *BasePathFS) Rename(oldname, newname string) error {
+	oldReal, err := bfs.realPath("rename", oldname, false)
+	if nil != err {
+		return err
+	}
+	newReal, err := bfs.realPath("rename", newname, false)
+	if nil != err {
+		return err
+	}
+	return bfs.restoreError(bfs.fsys.Rename(oldReal, newReal), oldname, newname)
+}
+
+// ReadDir 读取文件夹内容
+func (bfs *BasePathFS) ReadDir(name string) ([]os.DirEntry, error) {
+	real, err := bfs.realPath("readdir", name, true)
+	if nil != err {
+		return nil, err
+	}
+	list, err := bfs.fsys.ReadDir(real)
+	return list, bfs.restoreError(err, name)
+}
+
+// Chmod 修改权限
+func (bfs *BasePathFS) Chmod(name string, mode os.FileMode) error {
+	real, err := bfs.realPath("chmod", name, true)
+	if nil != err {
+		return err
+	}
+	return bfs.restoreError(bfs.fsys.Chmod(real, mode), name)
+}
+
+// basePathFile 名字为相对路径的文件
+type basePathFile struct {
+	File
+	name string
+}
+
+func (fp *basePathFile) Name() string {
+	return fp.name
+}
+
+// IOFS 转换为io/fs.FS, 路径按io/fs的规则使用'/'分隔且不能以'/'开头, "."为根
+// 本地文件系统一般先用NewBasePathFS限定目录
+func IOFS(fsys FS) fs.FS {
+	return &ioFS{fsys: fsys}
+}
+
+// ioFS io/fs.FS的实现
+type ioFS struct {
+	fsys FS
+}
+
+// name 检查并转换路径
+func (ifs *ioFS) name(op, name string) (string, error) {
+	if !fs.ValidPath(name) {
+		return "", &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	return filepath.FromSlash(name), nil
+}
+
+func (ifs *ioFS) Open(name string) (fs.File, error) {
+	real, err := ifs.name("open", name)
+	if nil != err {
+		return nil, err
+	}
+	fp, err := ifs.fsys.Open(real)
+	if nil != err {
+		return nil, err
+	}
+	return fp, nil
+}
+
+func (ifs *ioFS) Stat(name string) (fs.FileInfo, error) {
+	real, err := ifs.name("stat", name)
+	if nil != err {
+		return nil, err
+	}
+	return ifs.fsys.Stat(real)
+}
+
+func (ifs *ioFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	real, err := ifs.name("readdir", name)
+	if nil != err {
+		return nil, err
+	}
+	return ifs.fsys.ReadDir(real)
+}
+
+func (ifs *ioFS) ReadFile(name string) ([]byte, error) {
+	real, err := ifs.name("readfile", name)
+	if nil != err {
+		return nil, err
+	}
+	return ReadFileFS(ifs.fsys, real)
+}
+
+// FromIOFS 把io/fs.FS转换为只读的FS, 写操作返回ErrReadOnly, 路径可以以'/'开头
+func FromIOFS(fsys fs.FS) *ReadOnlyFS {
+	return NewReadOnlyFS(&fromIOFS{fsys: fsys})
+}
+
+// fromIOFS 只实现读操作, 写操作由ReadOnlyFS拦截
+type fromIOFS struct {
+	fsys fs.FS
+}
+
+// name 转换为io/fs的路径
+func (ffs *fromIOFS) name(name string) string {
+	name = strings.TrimPrefix(path.Clean("/"+filepath.ToSlash(name)), "/")
+	if len(name) == 0 {
+		return "."
+	}
+	return name
+}
+
+func (ffs *fromIOFS) Stat(name string) (os.FileInfo, error) {
+	return fs.Stat(ffs.fsys, ffs.name(name))
+}
+
+func (ffs *fromIOFS) Open(name string) (File, error) {
+	fp, err := ffs.fsys.Open(ffs.name(name))
+	if nil != err {
+		return nil, err
+	}
+	return &fromIOFile{File: fp, name: name}, nil
+}
+
+func (ffs *fromIOFS) Create(name string) (File, error) {
+	return nil, readOnlyError("open", name)
+}
+
+func (ffs *fromIOFS) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	return ffs.Open(name)
+}
+
+func (ffs *fromIOFS) Mkdir(name string, perm os.FileMode) error {
+	return readOnlyError("mkdir", name)
+}
+
+func (ffs *fromIOFS) Remove(name string) error {
+	return readOnlyError("remove", name)
+}
+
+func (ffs *fromIOFS) Rename(oldname, newname string) error {
+	return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: ErrReadOnly}
+}
+
+func (ffs *fromIOFS) ReadDir(name string) ([]os.DirEntry, error) {
+	return fs.ReadDir(ffs.fsys, ffs.name(name))
+}
+
+func (ffs *fromIOFS) Chmod(name string, mode os.FileMode) error {
+	return readOnlyError("chmod", name)
+}
+
+// fromIOFile 把fs.File转换为File, 底层不支持的操作返回错误
+type fromIOFile struct {
+	fs.File
+	name string
+}
+
+func (fp *fromIOFile) Name() string {
+	return fp.name
+}
+
+func (fp *fromIOFile) Write(p []byte) (int, error) {
+	return 0, readOnlyError("write", fp.name)
+}
+
+func (fp *fromIOFile) Seek(offset int64, whence int) (int64, error) {
+	if seeker, ok := fp.File.(io.Seeker); ok {
+		return seeker.Seek(offset, whence)
+	}
+	return 0, &os.PathError{Op: "seek", Path: fp.name, Err: fs.ErrInvalid}
+}
+
+func (fp *fromIOFile) ReadDir(n int) ([]os.DirEntry, error) {
+	if dir, ok := fp.File.(fs.ReadDirFile); ok {
+		return dir.ReadDir(n)
+	}
+	return nil, &os.PathError{Op: "readdir", Path: fp.name, Err: errNotDir}
+}
@@ -0,0 +1,539 @@
+// Copyright (C) 2019 WuPeng <wupeng364@outlook.com>.
+// Use of this source code is governed by an MIT-style.
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction,
+// including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software,
+// and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+// 文件工具-文件类型识别
+// 结合扩展名和文件头的特征字节判断MIME类型和分类, 可以发现扩展名与内容不符的文件
+
+package fstool
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+// sniffLen 判断文件类型时读取的文件头长度
+const sniffLen = 4096
+
+// FileCategory 文件分类
+type FileCategory string
+
+const (
+	// CategoryImage 图片
+	CategoryImage FileCategory = "image"
+	// CategoryVideo 视频
+	CategoryVideo FileCategory = "video"
+	// CategoryAudio 音频
+	CategoryAudio FileCategory = "audio"
+	// CategoryDocument 文档, 如pdf、office
+	CategoryDocument FileCategory = "document"
+	// CategoryArchive 压缩包
+	CategoryArchive FileCategory = "archive"
+	// CategoryText 文本, 如txt、json、html
+	CategoryText FileCategory = "text"
+	// CategoryFont 字体
+	CategoryFont FileCategory = "font"
+	// CategoryExecutable 可执行文件和脚本
+	CategoryExecutable FileCategory = "executable"
+	// CategoryOther 其他
+	CategoryOther FileCategory = "other"
+)
+
+// mimeOctetStream 未知的二进制内容
+const mimeOctetStream = "application/octet-stream"
+
+// ContentType 文件类型识别结果
+type ContentType struct {
+	MIME     string       // MIME类型, 不带参数, 无法识别时为application/octet-stream
+	Category FileCategory // 分类
+	ExtMIME  string       // 按扩展名判断的MIME类型, 未知扩展名为空
+	Sniffed  bool         // MIME类型是否由文件内容判断
+}
+
+// Mismatch 文件内容与扩展名不符, 如把可执行文件改名为.jpg
+// 扩展名是通用格式而内容是基于该格式的具体格式时视为相符, 如.zip的docx、.txt的html
+func (ct ContentType) Mismatch() bool {
+	return ct.Sniffed && len(ct.ExtMIME) > 0 && ct.MIME != ct.ExtMIME && !isCompatibleMIME(ct.ExtMIME, ct.MIME)
+}
+
+// extMIMEs 扩展名对应的MIME类型
+var extMIMEs = map[string]string{
+	".png":   "image/png",
+	".jpg":   "image/jpeg",
+	".jpeg":  "image/jpeg",
+	".gif":   "image/gif",
+	".webp":  "image/webp",
+	".bmp":   "image/bmp",
+	".ico":   "image/x-icon",
+	".tif":   "image/tiff",
+	".tiff":  "image/tiff",
+	".svg":   "image/svg+xml",
+	".heic":  "image/heic",
+	".avif":  "image/avif",
+	".mp4":   "video/mp4",
+	".m4v":   "video/mp4",
+	".mov":   "video/quicktime",
+	".webm":  "video/webm",
+	".mkv":   "video/x-matroska",
+	".avi":   "video/x-msvideo",
+	".flv":   "video/x-flv",
+	".mpg":   "video/mpeg",
+	".mpeg":  "video/mpeg",
+	".3gp":   "video/3gpp",
+	".mp3":   "audio/mpeg",
+	".m4a":   "audio/mp4",
+	".wav":   "audio/wav",
+	".ogg":   "audio/ogg",
+	".flac":  "audio/flac",
+	".pdf":   "application/pdf",
+	".rtf":   "application/rtf",
+	".doc":   "application/msword",
+	".xls":   "application/vnd.ms-excel",
+	".ppt":   "application/vnd.ms-powerpoint",
+	".docx":  "application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+	".xlsx":  "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+	".pptx":  "application/vnd.openxmlformats-officedocument.presentationml.presentation",
+	".odt":   "application/vnd.oasis.opendocument.text",
+	".ods":   "application/vnd.oasis.opendocument.spreadsheet",
+	".odp":   "application/vnd.oasis.opendocument.presentation",
+	".epub":  "application/epub+zip",
+	".zip":   "application/zip",
+	".gz":    "application/gzip",
+	".tgz":   "application/gzip",
+	".tar":   "application/x-tar",
+	".7z":    "application/x-7z-compressed",
+	".rar":   "application/vnd.rar",
+	".bz2":   "application/x-bzip2",
+	".xz":    "application/x-xz",
+	".jar":   "application/java-archive",
+	".apk":   "application/vnd.android.package-archive",
+	".txt":   "text/plain",
+	".log":   "text/plain",
+	".md":    "text/markdown",
+	".csv":   "text/csv",
+	".html":  "text/html",
+	".htm":   "text/html",
+	".css":   "text/css",
+	".js":    "text/javascript",
+	".json":  "application/json",
+	".xml":   "text/xml",
+	".yaml":  "application/yaml",
+	".yml":   "application/yaml",
+	".woff":  "font/woff",
+	".woff2": "font/woff2",
+	".ttf":   "font/ttf",
+	".otf":   "font/otf",
+	".exe":   "application/vnd.microsoft.portable-executable",
+	".dll":   "application/vnd.microsoft.portable-executable",
+	".msi":   "application/x-msi",
+	".wasm":  "application/wasm",
+	".sh":    "text/x-shellscript",
+}
+
+// mimeCategories 不能从MIME类型前缀判断分类的类型
+var mimeCategories = map[string]FileCategory{
+	"application/pdf":               CategoryDocument,
+	"application/rtf":               CategoryDocument,
+	"application/msword":            CategoryDocument,
+	"application/vnd.ms-excel":      CategoryDocument,
+	"application/vnd.ms-powerpoint": CategoryDocument,
+	"application/vnd.openxmlformats-officedocument.wordprocessingml.document":   CategoryDocument,
+	"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet":         CategoryDocument,
+	"application/vnd.openxmlformats-officedocument.presentationml.presentation": CategoryDocument,
+	"application/vnd.oasis.opendocument.text":                                   CategoryDocument,
+	"application/vnd.oasis.opendocument.spreadsheet":                            CategoryDocument,
+	"application/vnd.oasis.opendocument.presentation":                           CategoryDocument,
+	"application/epub+zip":                          CategoryDocument,
+	"application/x-ole-storage":                     CategoryDocument,
+	"application/zip":                               CategoryArchive,
+	"application/gzip":                              CategoryArchive,
+	"application/x-tar":                             CategoryArchive,
+	"application/x-7z-compressed":                   CategoryArchive,
+	"application/vnd.rar":                           CategoryArchive,
+	"application/x-bzip2":                           CategoryArchive,
+	"application/x-xz":                              CategoryArchive,
+	"application/java-archive":                      CategoryArchive,
+	"application/vnd.android.package-archive":       CategoryArchive,
+	"application/json":                              CategoryText,
+	"application/yaml":                              CategoryText,
+	"application/vnd.microsoft.portable-executable": CategoryExecutable,
+	"application/x-elf":                             CategoryExecutable,
+	"application/x-mach-binary":                     CategoryExecutable,
+	"application/x-msi":                             CategoryExecutable,
+	"application/wasm":                              CategoryExecutable,
+	"text/x-shellscript":                            CategoryExecutable,
+}
+
+// magic 固定位置的特征字节
+type magic struct {
+	offset int
+	sig    string
+	mime   string
+}
+
+// magics 按顺序匹配的特征字节, 需要进一步判断的格式在sniff中处理
+var magics = []magic{
+	{0, "\x89PNG\r\n\x1a\n", "image/png"},
+	{0, "\xff\xd8\xff", "image/jpeg"},
+	{0, "GIF87a", "image/gif"},
+	{0, "GIF89a", "image/gif"},
+	{0, "II*\x00", "image/tiff"},
+	{0, "MM\x00*", "image/tiff"},
+	{0, "\x00\x00\x01\x00", "image/x-icon"},
+	{0, "%PDF-", "application/pdf"},
+	{0, "{\\rtf", "application/rtf"},
+	{0, "\xd0\xcf\x11\xe0\xa1\xb1\x1a\xe1", "application/x-ole-storage"},
+	{0, "\x1f\x8b", "application/gzip"},
+	{0, "7z\xbc\xaf\x27\x1c", "application/x-7z-compressed"},
+	{0, "Rar!\x1a\x07", "application/vnd.rar"},
+	{0, "BZh", "application/x-bzip2"},
+	{0, "\xfd7zXZ\x00", "application/x-xz"},
+	{257, "ustar", "application/x-tar"},
+	{0, "FLV", "video/x-flv"},
+	{0, "\x00\x00\x01\xba", "video/mpeg"},
+	{0, "ID3", "audio/mpeg"},
+	{0, "OggS", "audio/ogg"},
+	{0, "fLaC", "audio/flac"},
+	{0, "wOFF", "font/woff"},
+	{0, "wOF2", "font/woff2"},
+	{0, "OTTO", "font/otf"},
+	{0, "\x00\x01\x00\x00\x00", "font/ttf"},
+	{0, "\x7fELF", "application/x-elf"},
+	{0, "MZ", "application/vnd.microsoft.portable-executable"},
+	{0, "\xfe\xed\xfa\xce", "application/x-mach-binary"},
+	{0, "\xfe\xed\xfa\xcf", "application/x-mach-binary"},
+	{0, "\xce\xfa\xed\xfe", "application/x-mach-binary"},
+	{0, "\xcf\xfa\xed\xfe", "application/x-mach-binary"},
+	{0, "\x00asm", "application/wasm"},
+	{0, "#!", "text/x-shellscript"},
+}
+
+// compatibleMIMEs 内容只能判断出通用格式时, 扩展名对应的具体格式也视为相符
+var compatibleMIMEs = map[string][]string{
+	"application/zip": {
+		"application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+		"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+		"application/vnd.openxmlformats-officedocument.presentationml.presentation",
+		"application/vnd.oasis.opendocument.text", "application/vnd.oasis.opendocument.spreadsheet",
+		"application/vnd.oasis.opendocument.presentation", "application/epub+zip",
+		"application/java-archive", "application/vnd.android.package-archive",
+	},
+	"application/x-ole-storage": {"application/msword", "application/vnd.ms-excel", "application/vnd.ms-powerpoint", "application/x-msi"},
+	"video/mp4":                 {"audio/mp4", "video/quicktime", "video/3gpp"},
+	"video/x-matroska":          {"video/webm"},
+	"text/xml":                  {"image/svg+xml"},
+	"text/plain": {
+		"text/markdown", "text/csv", "text/html", "text/css", "text/javascript", "text/xml",
+		"application/json", "application/yaml", "image/svg+xml",
+	},
+}
+
+// signedMIMEs 有固定特征字节的格式, 扩展名是这些格式而内容中找不到特征时视为内容与扩展名不符
+// 文本类格式和没有可靠特征的格式(如旧式tar)不在其中
+var signedMIMEs = map[string]bool{
+	"image/png":                     true,
+	"image/jpeg":                    true,
+	"image/gif":                     true,
+	"image/webp":                    true,
+	"image/bmp":                     true,
+	"image/x-icon":                  true,
+	"image/tiff":                    true,
+	"image/heic":                    true,
+	"image/avif":                    true,
+	"video/mp4":                     true,
+	"video/quicktime":               true,
+	"video/webm":                    true,
+	"video/x-matroska":              true,
+	"video/x-msvideo":               true,
+	"video/x-flv":                   true,
+	"video/mpeg":                    true,
+	"video/3gpp":                    true,
+	"audio/mpeg":                    true,
+	"audio/mp4":                     true,
+	"audio/wav":                     true,
+	"audio/ogg":                     true,
+	"audio/flac":                    true,
+	"application/pdf":               true,
+	"application/rtf":               true,
+	"application/msword":            true,
+	"application/vnd.ms-excel":      true,
+	"application/vnd.ms-powerpoint": true,
+	"application/vnd.openxmlformats-officedocument.wordprocessingml.document":   true,
+	"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet":         true,
+	"application/vnd.openxmlformats-officedocument.presentationml.presentation": true,
+	"application/vnd.oasis.opendocument.text":                                   true,
+	"application/vnd.oasis.opendocument.spreadsheet":                            true,
+	"application/vnd.oasis.opendocument.presentation":                           true,
+	"application/epub+zip":                    true,
+	"application/zip":                         true,
+	"application/gzip":                        true,
+	"application/x-7z-compressed":             true,
+	"application/vnd.rar":                     true,
+	"application/x-bzip2":                     true,
+	"application/x-xz":                        true,
+	"application/java-archive":                true,
+	"application/vnd.android.package-archive": true,
+	"font/woff":                               true,
+	"font/woff2":                              true,
+	"font/ttf":                                true,
+	"font/otf":                                true,
+	"application/vnd.microsoft.portable-executable": true,
+	"application/x-msi":                             true,
+	"application/wasm":                              true,
+}
+
+// isCompatibleMIME specific是否是基于通用格式generic的具体格式
+func isCompatibleMIME(generic, specific string) bool {
+	for _, mime := range compatibleMIMEs[generic] {
+		if mime == specific {
+			return true
+		}
+	}
+	return false
+}
+
+// ContentTypeByExt 按扩展名判断MIME类型, 未知扩展名返回空
+func ContentTypeByExt(name string) string {
+	return extMIMEs[strings.ToLower(filepath.Ext(name))]
+}
+
+// CategoryOf MIME类型的分类
+func CategoryOf(mime string) FileCategory {
+	if category, ok := mimeCategories[mime]; ok {
+		return category
+	}
+	switch {
+	case strings.HasPrefix(mime, "image/"):
+		return CategoryImage
+	case strings.HasPrefix(mime, "video/"):
+		return CategoryVideo
+	case strings.HasPrefix(mime, "audio/"):
+		return CategoryAudio
+	case strings.HasPrefix(mime, "font/"):
+		return CategoryFont
+	case strings.HasPrefix(mime, "text/"):
+		return CategoryText
+	}
+	return CategoryOther
+}
+
+// DetectContentType 根据文件名和文件头判断类型, data一般取文件的前4096字节
+// 内容可以识别时以内容为准, 内容只能判断出通用格式(如zip、纯文本)时使用扩展名对应的具体格式
+// 扩展名对应的格式有特征字节而内容中没有时, 结果为application/octet-stream并视为与扩展名不符
+func DetectContentType(name string, data []byte) ContentType {
+	ct := ContentType{ExtMIME: ContentTypeByExt(name)}
+	sniffed := sniff(data)
+	switch {
+	case len(sniffed) > 0:
+		ct.MIME, ct.Sniffed = sniffed, true
+		if isCompatibleMIME(sniffed, ct.ExtMIME) {
+			ct.MIME = ct.ExtMIME
+		}
+	case len(data) > 0 && signedMIMEs[ct.ExtMIME]:
+		ct.MIME, ct.Sniffed = mimeOctetStream, true
+	case len(ct.ExtMIME) > 0:
+		ct.MIME = ct.ExtMIME
+	default:
+		ct.MIME = mimeOctetStream
+	}
+	ct.Category = CategoryOf(ct.MIME)
+	return ct
+}
+
+// DetectFileType 读取文件头判断文件类型
+func DetectFileType(path string) (ContentType, error) {
+	fp, err := os.Open(path)
+	if nil != err {
+		return ContentType{}, err
+	}
+	defer fp.Close()
+	data, err := readHeader(fp)
+	if nil != err {
+		return ContentType{}, err
+	}
+	return DetectContentType(path, data), nil
+}
+
+// DetectReaderType 读取r的开头判断类型, 返回的Reader包含已读取的内容, 用于上传等不能回退的流
+func DetectReaderType(name string, r io.Reader) (ContentType, io.Reader, error) {
+	data, err := readHeader(r)
+	if nil != err {
+		return ContentType{}, nil, err
+	}
+	return DetectContentType(name, data), io.MultiReader(bytes.NewReader(data), r), nil
+}
+
+// readHeader 读取最多sniffLen字节
+func readHeader(r io.Reader) ([]byte, error) {
+	data := make([]byte, sniffLen)
+	n, err := io.ReadFull(r, data)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		err = nil
+	}
+	return data[:n], err
+}
+
+// sniff 根据内容判断MIME类型, 无法判断时返回空
+func sniff(data []byte) string {
+	if len(data) == 0 {
+		return ""
+	}
+	switch {
+	case hasSig(data, 0, "PK\x03\x04") || hasSig(data, 0, "PK\x05\x06"):
+		return sniffZip(data)
+	case hasSig(data, 0, "RIFF") && len(data) >= 12:
+		switch string(data[8:12]) {
+		case "WEBP":
+			return "image/webp"
+		case "WAVE":
+			return "audio/wav"
+		case "AVI ":
+			return "video/x-msvideo"
+		}
+	case hasSig(data, 4, "ftyp") && len(data) >= 12:
+		return sniffFtyp(string(data[8:12]))
+	case hasSig(data, 0, "\x1a\x45\xdf\xa3"):
+		if bytes.Contains(data[:minInt(len(data), 64)], []byte("webm")) {
+			return "video/webm"
+		}
+		return "video/x-matroska"
+	case hasSig(data, 0, "\xca\xfe\xba\xbe") && len(data) >= 8:
+		// Mach-O通用二进制与Java class文件的开头相同, 架构数不会很大
+		if data[4] == 0 && data[5] == 0 && data[6] == 0 && data[7] > 0 && data[7] < 20 {
+			return "application/x-mach-binary"
+		}
+	case hasSig(data, 0, "BM") && hasSig(data, 6, "\x00\x00\x00\x00"):
+		// 只有两个字节的特征容易与文本混淆, 同时检查保留字段
+		return "image/bmp"
+	}
+	for _, m := range magics {
+		if hasSig(data, m.offset, m.sig) {
+			return m.mime
+		}
+	}
+	// MP3没有ID3标签时以帧同步开头
+	if len(data) >= 2 && data[0] == 0xff && (data[1]&0xe0) == 0xe0 && (data[1]&0x06) != 0 {
+		return "audio/mpeg"
+	}
+	return sniffText(data)
+}
+
+// sniffZip 根据zip中的文件名判断office等基于zip的格式
+func sniffZip(data []byte) string {
+	// ODF和epub的第一个文件是未压缩的mimetype
+	if hasSig(data, 30, "mimetype") {
+		mime := string(data[38:minInt(len(data), 38+80)])
+		for _, prefix := range []string{"application/vnd.oasis.opendocument.", "application/epub+zip"} {
+			if strings.HasPrefix(mime, prefix) {
+				end := strings.IndexFunc(mime, func(r rune) bool {
+					return !(r >= 'a' && r <= 'z' || r == '.' || r == '/' || r == '+' || r == '-')
+				})
+				if end > 0 {
+					mime = mime[:end]
+				}
+				return mime
+			}
+		}
+	}
+	for _, item := range []struct {
+		name string
+		mime string
+	}{
+		{"word/", "application/vnd.openxmlformats-officedocument.wordprocessingml.document"},
+		{"xl/", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"},
+		{"ppt/", "application/vnd.openxmlformats-officedocument.presentationml.presentation"},
+		{"AndroidManifest.xml", "application/vnd.android.package-archive"},
+		{"META-INF/MANIFEST.MF", "application/java-archive"},
+	} {
+		if containsZipName(data, item.name) {
+			return item.mime
+		}
+	}
+	return "application/zip"
+}
+
+// containsZipName 文件头中是否有以name开头的zip条目
+func containsZipName(data []byte, name string) bool {
+	for offset := 0; ; {
+		i := bytes.Index(data[offset:], []byte("PK\x03\x04"))
+		if i < 0 || offset+i+30 > len(data) {
+			return false
+		}
+		start := offset + i + 30
+		nameLen := int(data[offset+i+26]) | int(data[offset+i+27])<<8
+		if start+nameLen <= len(data) && strings.HasPrefix(string(data[start:start+nameLen]), name) {
+			return true
+		}
+		offset = start
+	}
+}
+
+// sniffFtyp 根据ISO媒体文件的brand判断类型
+func sniffFtyp(brand string) string {
+	switch brand {
+	case "heic", "heix", "mif1", "msf1":
+		return "image/heic"
+	case "avif", "avis":
+		return "image/avif"
+	case "qt  ":
+		return "video/quicktime"
+	case "M4A ", "M4B ":
+		return "audio/mp4"
+	}
+	if strings.HasPrefix(brand, "3g") {
+		return "video/3gpp"
+	}
+	return "video/mp4"
+}
+
+// sniffText 判断html、xml和纯文本, 含有控制字符或不是utf-8时不是文本
+func sniffText(data []byte) string {
+	text := data
+	// 截断的最后一个字符不完整
+	if len(text) == sniffLen {
+		for i := 0; i < utf8.UTFMax && len(text) > 0 && !utf8.Valid(text); i++ {
+			text = text[:len(text)-1]
+		}
+	}
+	text = bytes.TrimPrefix(text, []byte("\xef\xbb\xbf"))
+	if !utf8.Valid(text) {
+		return ""
+	}
+	for _, c := range text {
+		if c < 0x20 && c != '\t' && c != '\n' && c != '\r' && c != '\f' {
+			return ""
+		}
+	}
+	lower := bytes.ToLower(bytes.TrimLeft(text, " \t\r\n"))
+	switch {
+	case bytes.HasPrefix(lower, []byte("<!doctype html")) || bytes.HasPrefix(lower, []byte("<html")):
+		return "text/html"
+	case bytes.HasPrefix(lower, []byte("<svg")) || bytes.HasPrefix(lower, []byte("<?xml")) && bytes.Contains(lower, []byte("<svg")):
+		return "image/svg+xml"
+	case bytes.HasPrefix(lower, []byte("<?xml")):
+		return "text/xml"
+	}
+	return "text/plain"
+}
+
+// hasSig data在offset处是否是sig
+func hasSig(data []byte, offset int, sig string) bool {
+	return len(data) >= offset+len(sig) && string(data[offset:offset+len(sig)]) == sig
+}
+
+// minInt 较小的值
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,182 @@
+// Copyright (C) 2019 WuPeng <wupeng364@outlook.com>.
+// Use of this source code is governed by an MIT-style.
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction,
+// including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software,
+// and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+// 文件工具-单向同步
+// 比较源文件夹和目标文件夹, 只复制新增和修改的内容, 可以删除目标中多余的内容
+
+package fstool
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// SyncAction 同步时的操作
+type SyncAction string
+
+const (
+	// SyncCopy 复制新增的文件|夹
+	SyncCopy SyncAction = "copy"
+	// SyncUpdate 覆盖修改过的文件, 或替换类型不同的文件|夹
+	SyncUpdate SyncAction = "update"
+	// SyncDelete 删除目标中多余的文件|夹
+	SyncDelete SyncAction = "delete"
+)
+
+// SyncOpts 同步选项
+type SyncOpts struct {
+	Delete        bool                 // 删除目标中源文件夹没有的内容, 被排除的内容不会删除
+	Walk          WalkOpts             // 遍历选项, 两边使用相同的过滤规则
+	Compare       CompareMode          // 判断修改的方式, 默认比较大小和修改时间
+	TimeTolerance time.Duration        // 修改时间相差不超过该值视为相同
+	Preserve      PreserveOpts         // 保留的元数据, 按大小和时间比较时总是保留修改时间
+	Workers       int                  // 同时复制的文件数, 默认4
+	Atomic        bool                 // 先写入临时文件, 完成后重命名
+	DryRun        bool                 // 只生成报告, 不执行
+	Progress      func(p CopyProgress) // 进度回调
+}
+
+// SyncItem 报告中的一项操作
+type SyncItem struct {
+	Path   string     // 相对路径, 使用'/'分隔
+	Action SyncAction // 操作
+	IsDir  bool       // 是否是文件夹
+	Size   int64      // 复制的文件大小
+}
+
+// SyncReport 同步报告
+type SyncReport struct {
+	Items   []SyncItem // 按路径排序的操作
+	Copied  int        // 新增的文件|夹数
+	Updated int        // 覆盖的文件|夹数
+	Deleted int        // 删除的文件|夹数, 包含被删除的文件夹中的内容
+	Bytes   int64      // 需要复制的字节数
+	DryRun  bool       // 是否只生成了报告
+}
+
+// Sync 把src单向同步到dst, dst不存在时创建
+// 先删除多余的内容, 再复制新增和修改的内容, 最后设置文件夹的元数据; 出错时返回已生成的报告和错误
+func Sync(ctx context.Context, src, dst string, opts SyncOpts) (*SyncReport, error) {
+	src = filepath.Clean(src)
+	dst = filepath.Clean(dst)
+	report := &SyncReport{DryRun: opts.DryRun}
+	if !IsDir(src) {
+		return report, PathNotExist("Sync", src)
+	}
+	if IsFile(dst) {
+		return report, PathExist("Sync", dst)
+	}
+	// 不保留修改时间时, 复制后的文件下次同步都会被视为已修改
+	if opts.Compare == CompareSizeTime {
+		opts.Preserve.Times = true
+	}
+	walkOpts := opts.Walk
+	if !opts.Preserve.Symlinks && walkOpts.Symlinks == SymlinkNoFollow {
+		walkOpts.Symlinks = SymlinkFollow
+	}
+	diffOpts := DiffOpts{Compare: opts.Compare, Walk: walkOpts, Workers: opts.Workers, TimeTolerance: opts.TimeTolerance}
+	diffs, _, srcEntries, err := diffDirs(ctx, dst, src, diffOpts, true)
+	if nil != err {
+		return report, err
+	}
+
+	// 生成复制计划, 保留元数据时所有文件夹都需要在最后重新设置
+	plan := []CopyOp{{Src: src, Dst: dst, IsDir: true, Action: CopyActionMkdir}}
+	changed := make(map[string]bool)
+	var removed []DiffEntry
+	for _, diff := range diffs {
+		if diff.Kind == DiffRemoved {
+			removed = append(removed, diff)
+			continue
+		}
+		entry := srcEntries[diff.Path]
+		item := SyncItem{Path: diff.Path, Action: SyncCopy, IsDir: entry.IsDir}
+		op := CopyOp{Src: entry.Path, Dst: filepath.Join(dst, filepath.FromSlash(diff.Path)), IsDir: entry.IsDir, Action: CopyActionCopy}
+		if diff.Kind == DiffModified {
+			item.Action, op.Action = SyncUpdate, CopyActionReplace
+			report.Updated++
+		} else {
+			report.Copied++
+		}
+		if entry.IsDir {
+			if op.Action == CopyActionCopy {
+				op.Action = CopyActionMkdir
+			}
+		} else if entry.Symlink && walkOpts.Symlinks == SymlinkNoFollow {
+			op.Symlink = true
+		} else {
+			item.Size, op.Size = entry.Size, entry.Size
+			report.Bytes += entry.Size
+		}
+		changed[diff.Path] = true
+		report.Items = append(report.Items, item)
+		plan = append(plan, op)
+	}
+	if opts.Preserve != (PreserveOpts{}) {
+		for rel, entry := range srcEntries {
+			if entry.IsDir && !changed[rel] {
+				plan = append(plan, CopyOp{Src: entry.Path, Dst: filepath.Join(dst, filepath.FromSlash(rel)), IsDir: true, Action: CopyActionMkdir})
+			}
+		}
+		// 上级文件夹需要在其内容之前创建
+		sort.SliceStable(plan[1:], func(i, j int) bool { return plan[i+1].Dst < plan[j+1].Dst })
+	}
+	if opts.Delete {
+		for _, diff := range removed {
+			report.Items = append(report.Items, SyncItem{Path: diff.Path, Action: SyncDelete, IsDir: diff.IsDir})
+			report.Deleted++
+		}
+		sortSyncItems(report.Items)
+	}
+	if opts.DryRun {
+		return report, nil
+	}
+
+	if opts.Delete {
+		if err = deleteExtraneous(ctx, dst, removed); nil != err {
+			return report, err
+		}
+	}
+	copyOpts := CopyOpts{Workers: opts.Workers, Atomic: opts.Atomic, Preserve: opts.Preserve, Progress: opts.Progress}
+	return report, newCopyEngine(copyOpts).run(ctx, plan)
+}
+
+// deleteExtraneous 删除目标中多余的内容, 从最深的路径开始逐个删除
+// removed中不包含被排除的内容, 含有被排除内容的文件夹删除失败时保留
+func deleteExtraneous(ctx context.Context, dst string, removed []DiffEntry) error {
+	paths := make([]DiffEntry, len(removed))
+	copy(paths, removed)
+	// 下级路径排在上级之后, 倒序即先删除下级
+	sort.SliceStable(paths, func(i, j int) bool { return paths[i].Path > paths[j].Path })
+	for _, diff := range paths {
+		if err := ctx.Err(); nil != err {
+			return err
+		}
+		path := filepath.Join(dst, filepath.FromSlash(diff.Path))
+		err := os.Remove(path)
+		if nil == err || os.IsNotExist(err) {
+			continue
+		}
+		if diff.IsDir {
+			if names, lerr := GetDirList(path); nil == lerr && len(names) > 0 {
+				continue
+			}
+		}
+		return err
+	}
+	return nil
+}
+
+// sortSyncItems 按路径排序
+func sortSyncItems(items []SyncItem) {
+	sort.SliceStable(items, func(i, j int) bool { return items[i].Path < items[j].Path })
+}
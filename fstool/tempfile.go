@@ -0,0 +1,261 @@
+// Copyright (C) 2019 WuPeng <wupeng364@outlook.com>.
+// Use of this source code is governed by an MIT-style.
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction,
+// including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software,
+// and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+// 文件工具-临时文件
+// 在指定目录创建临时文件|夹, 统一清理; 先写入临时文件, 提交时重命名为目标文件
+
+package fstool
+
+import (
+	"errors"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+// errBadPattern 临时文件名的模式中不能包含路径分隔符
+var errBadPattern = errors.New("pattern contains path separator")
+
+// TempFile 在dir下创建临时文件, pattern中最后一个'*'替换为随机字符串, 没有'*'时追加在末尾
+// dir为空时使用系统临时目录, 权限为0600, 使用完毕后需要自行删除
+func TempFile(dir, pattern string) (*os.File, error) {
+	if err := checkPattern(dir, pattern); nil != err {
+		return nil, err
+	}
+	return os.CreateTemp(dir, pattern)
+}
+
+// TempDir 在dir下创建临时文件夹, 规则与TempFile相同, 权限为0700
+func TempDir(dir, pattern string) (string, error) {
+	if err := checkPattern(dir, pattern); nil != err {
+		return "", err
+	}
+	return os.MkdirTemp(dir, pattern)
+}
+
+// checkPattern 模式中不能包含路径分隔符, 斜杠和反斜杠在所有系统上都不允许
+func checkPattern(dir, pattern string) error {
+	if strings.ContainsAny(pattern, `/\`) || strings.ContainsRune(pattern, os.PathSeparator) {
+		return &os.PathError{Op: "TempFile", Path: filepath.Join(dir, pattern), Err: errBadPattern}
+	}
+	return nil
+}
+
+// Cleanup 一组需要清理的临时文件|夹, Close时删除
+// 调用CleanupOnSignal后, 进程收到退出信号时也会删除
+type Cleanup struct {
+	paths  []string
+	closed bool
+	l      *sync.Mutex
+}
+
+var (
+	// cleanups 未关闭的Cleanup, 收到退出信号时清理
+	cleanups     = make(map[*Cleanup]bool)
+	cleanupsLock = new(sync.Mutex)
+	// signalOnce 只注册一次信号处理
+	signalOnce = new(sync.Once)
+)
+
+// NewCleanup 创建临时文件清理器
+func NewCleanup() *Cleanup {
+	c := &Cleanup{l: new(sync.Mutex)}
+	cleanupsLock.Lock()
+	cleanups[c] = true
+	cleanupsLock.Unlock()
+	return c
+}
+
+// TempFile 创建临时文件并在Close时删除, 规则与TempFile相同
+func (c *Cleanup) TempFile(dir, pattern string) (*os.File, error) {
+	fp, err := TempFile(dir, pattern)
+	if nil != err {
+		return nil, err
+	}
+	if err = c.Add(fp.Name()); nil != err {
+		fp.Close()
+		os.Remove(fp.Name())
+		return nil, err
+	}
+	return fp, nil
+}
+
+// TempDir 创建临时文件夹并在Close时删除, 规则与TempDir相同
+func (c *Cleanup) TempDir(dir, pattern string) (string, error) {
+	name, err := TempDir(dir, pattern)
+	if nil != err {
+		return "", err
+	}
+	if err = c.Add(name); nil != err {
+		os.Remove(name)
+		return "", err
+	}
+	return name, nil
+}
+
+// Add 登记需要在Close时删除的文件|夹, 已关闭时返回错误
+func (c *Cleanup) Add(path string) error {
+	c.l.Lock()
+	defer c.l.Unlock()
+	if c.closed {
+		return &os.PathError{Op: "Cleanup.Add", Path: path, Err: os.ErrClosed}
+	}
+	c.paths = append(c.paths, path)
+	return nil
+}
+
+// Keep 不再删除path, 如临时文件已经被重命名为正式文件
+func (c *Cleanup) Keep(path string) {
+	c.l.Lock()
+	defer c.l.Unlock()
+	for i, p := range c.paths {
+		if p == path {
+			c.paths = append(c.paths[:i], c.paths[i+1:]...)
+			return
+		}
+	}
+}
+
+// Close 按登记的倒序删除所有文件|夹, 返回第一个错误; 不存在的路径忽略
+func (c *Cleanup) Close() error {
+	cleanupsLock.Lock()
+	delete(cleanups, c)
+	cleanupsLock.Unlock()
+	return c.removeAll()
+}
+
+// removeAll 删除登记的文件|夹
+func (c *Cleanup) removeAll() error {
+	c.l.Lock()
+	defer c.l.Unlock()
+	c.closed = true
+	var firstErr error
+	for i := len(c.paths) - 1; i >= 0; i-- {
+		if err := os.RemoveAll(c.paths[i]); nil != err && nil == firstErr {
+			firstErr = err
+		}
+	}
+	c.paths = nil
+	return firstErr
+}
+
+// CleanupOnSignal 收到退出信号时删除所有未关闭的Cleanup登记的文件|夹, 然后以128+信号值的状态码退出
+// 默认处理os.Interrupt和SIGTERM; 只有第一次调用生效, 需要自行处理退出流程的程序应在退出前调用Close
+func CleanupOnSignal(sigs ...os.Signal) {
+	signalOnce.Do(func() {
+		if len(sigs) == 0 {
+			sigs = []os.Signal{os.Interrupt, syscall.SIGTERM}
+		}
+		ch := make(chan os.Signal, 1)
+		signal.Notify(ch, sigs...)
+		go func() {
+			sig := <-ch
+			cleanupsLock.Lock()
+			for c := range cleanups {
+				c.removeAll()
+			}
+			cleanupsLock.Unlock()
+			code := 1
+			if s, ok := sig.(syscall.Signal); ok {
+				code = 128 + int(s)
+			}
+			os.Exit(code)
+		}()
+	})
+}
+
+// AtomicWriter 先写入目标文件同目录下的临时文件, Commit时重命名为目标文件
+// 读取目标文件的程序只会看到旧内容或完整的新内容
+type AtomicWriter struct {
+	fp     *os.File
+	path   string
+	perm   os.FileMode
+	closed bool
+}
+
+// NewAtomicWriter 创建原子写入, perm为0时沿用目标文件的权限, 目标不存在时为0666(受umask影响)
+// 使用完毕后需要调用Close, 没有Commit时丢弃写入的内容
+func NewAtomicWriter(path string, perm os.FileMode) (*AtomicWriter, error) {
+	if perm == 0 {
+		perm = defaultFilePerm()
+		if st, err := os.Stat(path); nil == err {
+			perm = st.Mode().Perm()
+		}
+	}
+	fp, err := createTemp(filepath.Dir(path), "."+filepath.Base(path)+".", ".tmp")
+	if nil != err {
+		return nil, err
+	}
+	return &AtomicWriter{fp: fp, path: path, perm: perm}, nil
+}
+
+// Name 临时文件的路径
+func (w *AtomicWriter) Name() string {
+	return w.fp.Name()
+}
+
+// Write 写入临时文件
+func (w *AtomicWriter) Write(p []byte) (int, error) {
+	if w.closed {
+		return 0, &os.PathError{Op: "write", Path: w.path, Err: os.ErrClosed}
+	}
+	return w.fp.Write(p)
+}
+
+// Commit 把临时文件写入磁盘并重命名为目标文件
+func (w *AtomicWriter) Commit() error {
+	if w.closed {
+		return &os.PathError{Op: "commit", Path: w.path, Err: os.ErrClosed}
+	}
+	w.closed = true
+	err := w.fp.Sync()
+	if cerr := w.fp.Close(); nil == err {
+		err = cerr
+	}
+	// 临时文件以0600创建, 写入完成后才设置为目标权限
+	if nil == err {
+		err = os.Chmod(w.fp.Name(), w.perm)
+	}
+	if nil == err {
+		err = renameFile(w.fp.Name(), w.path)
+	}
+	if nil != err {
+		os.Remove(w.fp.Name())
+	}
+	return err
+}
+
+// Close 没有Commit时删除临时文件, 已经Commit时不做任何操作
+func (w *AtomicWriter) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	err := w.fp.Close()
+	if rerr := os.Remove(w.fp.Name()); nil == err {
+		err = rerr
+	}
+	return err
+}
+
+// WriteFileAtomic 原子地写入文件内容, perm规则与NewAtomicWriter相同
+func WriteFileAtomic(path string, data []byte, perm os.FileMode) error {
+	w, err := NewAtomicWriter(path, perm)
+	if nil != err {
+		return err
+	}
+	defer w.Close()
+	if _, err = w.Write(data); nil != err {
+		return err
+	}
+	return w.Commit()
+}
@@ -0,0 +1,476 @@
+// Copyright (C) 2019 WuPeng <wupeng364@outlook.com>.
+// Use of this source code is governed by an MIT-style.
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction,
+// including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software,
+// and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+// 文件工具-回收站
+// 按freedesktop.org回收站规范实现: files中保存删除的文件|夹, info中的.trashinfo记录原路径和删除时间
+// 其他分区上的文件放入该分区根目录下的.Trash/$uid或.Trash-$uid, 避免跨分区复制
+
+package fstool
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// trashTimeFormat .trashinfo中删除时间的格式, 本地时间
+const trashTimeFormat = "2006-01-02T15:04:05"
+
+// trashInfoExt 回收站信息文件的扩展名
+const trashInfoExt = ".trashinfo"
+
+// ErrUnsafeTrash 分区回收站不是当前用户的文件夹, 或其他用户可以访问, 按规范不能使用
+var ErrUnsafeTrash = errors.New("trash directory is not private to the current user")
+
+// TrashOpts 回收站选项
+type TrashOpts struct {
+	Dir     string // 指定回收站路径, 此时只使用这一个回收站, 不能放入其他分区的文件; 默认$XDG_DATA_HOME/Trash
+	MaxSize int64  // 每个回收站的总大小上限, 放入后超出时从最早删除的开始清理, 0不限制
+}
+
+// Trash 回收站, 包括主回收站和各分区根目录下的回收站
+type Trash struct {
+	opts       TrashOpts
+	home       trashDir
+	standalone bool // 指定了回收站路径, 不使用分区回收站
+}
+
+// TrashItem 回收站中的一项
+type TrashItem struct {
+	Name         string    // 在回收站中的名称, 同一回收站内唯一
+	OriginalPath string    // 删除前的完整路径
+	DeletionDate time.Time // 删除时间
+	IsDir        bool      // 是否是文件夹
+	Size         int64     // 大小, 文件夹为其中所有文件的大小之和
+	dir          trashDir  // 所在的回收站
+}
+
+// trashDir 一个回收站目录
+type trashDir struct {
+	dir    string // 回收站路径, 包含files和info
+	topdir string // 分区回收站所在的分区根目录, 原路径相对它保存; 主回收站为空
+}
+
+// NewTrash 打开当前用户的回收站, 没有指定Dir时只支持使用freedesktop.org规范的平台
+func NewTrash(opts TrashOpts) (*Trash, error) {
+	standalone := len(opts.Dir) > 0
+	if !standalone {
+		if runtime.GOOS == "windows" || runtime.GOOS == "darwin" {
+			return nil, &os.PathError{Op: "NewTrash", Path: "Trash", Err: ErrNotSupported}
+		}
+		dataHome := os.Getenv("XDG_DATA_HOME")
+		if len(dataHome) == 0 {
+			home, err := os.UserHomeDir()
+			if nil != err {
+				return nil, err
+			}
+			dataHome = filepath.Join(home, ".local", "share")
+		}
+		opts.Dir = filepath.Join(dataHome, "Trash")
+	}
+	dir, err := filepath.Abs(opts.Dir)
+	if nil != err {
+		return nil, err
+	}
+	return &Trash{opts: opts, home: trashDir{dir: dir}, standalone: standalone}, nil
+}
+
+// MoveToTrash 把文件|夹放入当前用户的回收站
+func MoveToTrash(path string) error {
+	trash, err := NewTrash(TrashOpts{})
+	if nil != err {
+		return err
+	}
+	_, err = trash.Put(path)
+	return err
+}
+
+// Put 把文件|夹放入回收站, 与主回收站不在同一分区时放入所在分区的回收站
+// 非Linux平台不使用分区回收站, 此时返回的错误可以用errors.Is(err, ErrCrossDevice)判断
+func (trash *Trash) Put(path string) (*TrashItem, error) {
+	path, err := filepath.Abs(path)
+	if nil != err {
+		return nil, err
+	}
+	st, err := os.Lstat(path)
+	if nil != err {
+		return nil, err
+	}
+	item, err := trash.home.put(path, st)
+	if errors.Is(err, ErrCrossDevice) && !trash.standalone && topdirTrashes {
+		var dir trashDir
+		if dir, err = topdirTrash(path, true); nil == err {
+			item, err = dir.put(path, st)
+		}
+	}
+	if nil != err {
+		return nil, err
+	}
+	if trash.opts.MaxSize > 0 {
+		if _, err = trash.purgeToSize([]trashDir{item.dir}, trash.opts.MaxSize, item.Name); nil != err {
+			return item, err
+		}
+	}
+	return item, nil
+}
+
+// List 列出所有回收站中的内容, 按删除时间从早到晚排序; 信息文件损坏或文件已不存在的项会被跳过
+func (trash *Trash) List() ([]TrashItem, error) {
+	return trash.list(trash.dirs())
+}
+
+// Restore 把回收站中的一项还原到原路径, 原路径已存在时返回ErrExist, 上级文件夹不存在时自动创建
+func (trash *Trash) Restore(item TrashItem) error {
+	return trash.RestoreTo(item, item.OriginalPath)
+}
+
+// RestoreTo 把回收站中的一项还原到dst, dst已存在时返回ErrExist
+func (trash *Trash) RestoreTo(item TrashItem, dst string) error {
+	if _, err := os.Lstat(dst); nil == err {
+		return PathExist("Restore", dst)
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), os.ModePerm); nil != err {
+		return err
+	}
+	src := filepath.Join(item.dir.dir, "files", item.Name)
+	err := renameFile(src, dst)
+	if errors.Is(err, ErrCrossDevice) {
+		err = MoveFileByCopyingWith(src, dst, ConflictOpts{Policy: ConflictError}, func(srcPath, dstPath string, err error) error {
+			return err
+		})
+	}
+	if nil != err {
+		return err
+	}
+	return os.Remove(item.dir.infoPath(item.Name))
+}
+
+// Remove 彻底删除回收站中的一项
+func (trash *Trash) Remove(item TrashItem) error {
+	if err := os.RemoveAll(filepath.Join(item.dir.dir, "files", item.Name)); nil != err {
+		return err
+	}
+	err := os.Remove(item.dir.infoPath(item.Name))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// PurgeOlderThan 彻底删除所有回收站中删除时间早于age之前的项, 返回删除的项数
+func (trash *Trash) PurgeOlderThan(age time.Duration) (int, error) {
+	items, err := trash.List()
+	if nil != err {
+		return 0, err
+	}
+	deadline := time.Now().Add(-age)
+	count := 0
+	for _, item := range items {
+		if !item.DeletionDate.Before(deadline) {
+			break
+		}
+		if err = trash.Remove(item); nil != err {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
+
+// PurgeToSize 每个回收站从最早删除的项开始彻底删除, 直到总大小不超过maxSize, 返回删除的项数
+func (trash *Trash) PurgeToSize(maxSize int64) (int, error) {
+	count := 0
+	for _, dir := range trash.dirs() {
+		n, err := trash.purgeToSize([]trashDir{dir}, maxSize, "")
+		count += n
+		if nil != err {
+			return count, err
+		}
+	}
+	return count, nil
+}
+
+// Empty 清空所有回收站
+func (trash *Trash) Empty() error {
+	items, err := trash.List()
+	if nil != err {
+		return err
+	}
+	for _, item := range items {
+		if err = trash.Remove(item); nil != err {
+			return err
+		}
+	}
+	return nil
+}
+
+// purgeToSize 从最早删除的项开始删除直到总大小不超过maxSize, 名称为keep的项不删除
+func (trash *Trash) purgeToSize(dirs []trashDir, maxSize int64, keep string) (int, error) {
+	items, err := trash.list(dirs)
+	if nil != err {
+		return 0, err
+	}
+	var total int64
+	for _, item := range items {
+		total += item.Size
+	}
+	count := 0
+	for _, item := range items {
+		if total <= maxSize {
+			break
+		}
+		if item.Name == keep {
+			continue
+		}
+		if err = trash.Remove(item); nil != err {
+			return count, err
+		}
+		total -= item.Size
+		count++
+	}
+	return count, nil
+}
+
+// dirs 主回收站和已存在的分区回收站
+func (trash *Trash) dirs() []trashDir {
+	dirs := []trashDir{trash.home}
+	if trash.standalone {
+		return dirs
+	}
+	for _, mount := range mountPoints() {
+		if dir, err := topdirTrash(mount, false); nil == err && dir.dir != trash.home.dir {
+			dirs = append(dirs, dir)
+		}
+	}
+	return dirs
+}
+
+// list 读取回收站中的内容
+func (trash *Trash) list(dirs []trashDir) ([]TrashItem, error) {
+	var items []TrashItem
+	for _, dir := range dirs {
+		names, err := GetDirList(filepath.Join(dir.dir, "info"))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if nil != err {
+			return nil, err
+		}
+		for _, info := range names {
+			if !strings.HasSuffix(info, trashInfoExt) {
+				continue
+			}
+			item, err := dir.readInfo(strings.TrimSuffix(info, trashInfoExt))
+			if nil != err {
+				continue
+			}
+			items = append(items, *item)
+		}
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		if !items[i].DeletionDate.Equal(items[j].DeletionDate) {
+			return items[i].DeletionDate.Before(items[j].DeletionDate)
+		}
+		return items[i].Name < items[j].Name
+	})
+	return items, nil
+}
+
+// infoPath 信息文件路径
+func (dir trashDir) infoPath(name string) string {
+	return filepath.Join(dir.dir, "info", name+trashInfoExt)
+}
+
+// put 先独占创建信息文件确定名称, 再把文件|夹移入files
+func (dir trashDir) put(path string, st os.FileInfo) (*TrashItem, error) {
+	if path == dir.dir || strings.HasPrefix(dir.dir, path+string(filepath.Separator)) {
+		return nil, &os.PathError{Op: "Trash", Path: path, Err: errors.New("cannot trash the trash directory or its parent")}
+	}
+	for _, sub := range []string{"files", "info"} {
+		if err := os.MkdirAll(filepath.Join(dir.dir, sub), 0700); nil != err {
+			return nil, err
+		}
+	}
+	original := path
+	if len(dir.topdir) > 0 {
+		rel, err := filepath.Rel(dir.topdir, path)
+		if nil != err {
+			return nil, err
+		}
+		original = rel
+	}
+	now := time.Now()
+	content := "[Trash Info]\nPath=" + (&url.URL{Path: filepath.ToSlash(original)}).EscapedPath() +
+		"\nDeletionDate=" + now.Format(trashTimeFormat) + "\n"
+	base := filepath.Base(path)
+	ext := filepath.Ext(base)
+	stem := strings.TrimSuffix(base, ext)
+	for i := 1; ; i++ {
+		name := base
+		if i > 1 {
+			name = stem + "." + strconv.Itoa(i) + ext
+		}
+		fp, err := os.OpenFile(dir.infoPath(name), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if os.IsExist(err) {
+			continue
+		}
+		if nil != err {
+			return nil, err
+		}
+		// 没有信息文件的残留文件
+		if _, err = os.Lstat(filepath.Join(dir.dir, "files", name)); nil == err {
+			fp.Close()
+			os.Remove(fp.Name())
+			continue
+		}
+		_, err = fp.WriteString(content)
+		if cerr := fp.Close(); nil == err {
+			err = cerr
+		}
+		if nil == err {
+			err = renameFile(path, filepath.Join(dir.dir, "files", name))
+		}
+		if nil != err {
+			os.Remove(fp.Name())
+			return nil, err
+		}
+		item := &TrashItem{Name: name, OriginalPath: path, DeletionDate: now.Truncate(time.Second), IsDir: st.IsDir(), Size: st.Size(), dir: dir}
+		if item.IsDir {
+			item.Size, _ = DirSize(context.Background(), filepath.Join(dir.dir, "files", name))
+		}
+		return item, nil
+	}
+}
+
+// readInfo 读取信息文件
+func (dir trashDir) readInfo(name string) (*TrashItem, error) {
+	fp, err := os.Open(dir.infoPath(name))
+	if nil != err {
+		return nil, err
+	}
+	defer fp.Close()
+	item := &TrashItem{Name: name, dir: dir}
+	section := false
+	scanner := bufio.NewScanner(fp)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "[") {
+			section = line == "[Trash Info]"
+			continue
+		}
+		kv := strings.SplitN(line, "=", 2)
+		if !section || len(kv) != 2 {
+			continue
+		}
+		switch kv[0] {
+		case "Path":
+			if item.OriginalPath, err = url.PathUnescape(kv[1]); nil != err {
+				return nil, err
+			}
+			item.OriginalPath = filepath.FromSlash(item.OriginalPath)
+			if len(dir.topdir) > 0 && !filepath.IsAbs(item.OriginalPath) {
+				item.OriginalPath = filepath.Join(dir.topdir, item.OriginalPath)
+			}
+		case "DeletionDate":
+			if item.DeletionDate, err = time.ParseInLocation(trashTimeFormat, kv[1], time.Local); nil != err {
+				return nil, err
+			}
+		}
+	}
+	if err = scanner.Err(); nil != err {
+		return nil, err
+	}
+	if len(item.OriginalPath) == 0 {
+		return nil, &os.PathError{Op: "Trash", Path: dir.infoPath(name), Err: errors.New("invalid trash info")}
+	}
+	st, err := os.Lstat(filepath.Join(dir.dir, "files", name))
+	if nil != err {
+		return nil, err
+	}
+	item.IsDir, item.Size = st.IsDir(), st.Size()
+	if item.IsDir {
+		item.Size, _ = DirSize(context.Background(), filepath.Join(dir.dir, "files", name))
+	}
+	return item, nil
+}
+
+// topdirTrash path所在分区的回收站, create为false时只返回已存在的回收站
+// 优先使用管理员创建的带粘滞位的.Trash/$uid, 否则使用.Trash-$uid
+// 分区根目录通常其他用户也可以写入, 回收站必须是当前用户所有且其他用户不能访问的真实文件夹
+func topdirTrash(path string, create bool) (trashDir, error) {
+	topdir, err := mountPointOf(path)
+	if nil != err {
+		return trashDir{}, err
+	}
+	uid := strconv.Itoa(os.Getuid())
+	shared := filepath.Join(topdir, ".Trash")
+	if st, err := os.Lstat(shared); nil == err && st.IsDir() && st.Mode()&os.ModeSticky != 0 {
+		dir := filepath.Join(shared, uid)
+		if nil == privateTrashDir(dir, create) {
+			return trashDir{dir: dir, topdir: topdir}, nil
+		}
+	}
+	dir := filepath.Join(topdir, ".Trash-"+uid)
+	if err = privateTrashDir(dir, create); nil != err {
+		return trashDir{}, err
+	}
+	return trashDir{dir: dir, topdir: topdir}, nil
+}
+
+// privateTrashDir 检查回收站是当前用户所有, 组和其他用户没有权限的文件夹, 不能是符号链接
+// 不存在且create为true时创建
+func privateTrashDir(dir string, create bool) error {
+	if create {
+		if err := os.Mkdir(dir, 0700); nil != err && !os.IsExist(err) {
+			return err
+		}
+	}
+	meta, err := LstatFileMeta(dir)
+	if nil != err {
+		if os.IsNotExist(err) {
+			return PathNotExist("Trash", dir)
+		}
+		return err
+	}
+	if meta.Symlink || !meta.IsDir || meta.UID != os.Getuid() || meta.Mode.Perm()&0077 != 0 {
+		return &os.PathError{Op: "Trash", Path: dir, Err: ErrUnsafeTrash}
+	}
+	return nil
+}
+
+// mountPointOf path所在分区的根目录, 向上查找直到设备号变化
+func mountPointOf(path string) (string, error) {
+	meta, err := LstatFileMeta(path)
+	if nil != err {
+		return "", err
+	}
+	dir := path
+	for {
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return dir, nil
+		}
+		pmeta, err := LstatFileMeta(parent)
+		if nil != err {
+			return "", err
+		}
+		if pmeta.Device != meta.Device {
+			return dir, nil
+		}
+		dir = parent
+	}
+}
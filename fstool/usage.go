@@ -0,0 +1,301 @@
+// Copyright (C) 2019 WuPeng <wupeng364@outlook.com>.
+// Use of this source code is governed by an MIT-style.
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction,
+// including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software,
+// and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+// 文件工具-空间占用统计
+// 并发统计文件夹占用的空间, 可以缓存结果; 查询分区的总空间和剩余空间
+
+package fstool
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrQuotaExceeded 超出文件夹的空间配额
+var ErrQuotaExceeded = errors.New("directory quota exceeded")
+
+// UsageOpts 空间统计选项
+type UsageOpts struct {
+	Walk       WalkOpts // 遍历选项, 被排除的内容不统计
+	Workers    int      // 同时统计的下级文件夹数, 默认4
+	SkipErrors bool     // 跳过无法读取的文件|夹, 记录在Errors中; 否则遇到错误立即返回
+}
+
+// DirUsage 文件夹的空间占用
+type DirUsage struct {
+	Path     string     // 完整路径
+	Name     string     // 名称
+	IsDir    bool       // 是否是文件夹
+	Size     int64      // 文件大小之和, 不含文件夹本身; 硬链接的文件按链接数重复统计
+	Files    int64      // 文件数
+	Dirs     int64      // 文件夹数, 不含自身
+	Errors   int64      // 跳过的无法读取的文件|夹数
+	Children []DirUsage // 直接下级的占用, 按大小从大到小排序, 只有统计的起点才有
+}
+
+// DirSize 统计文件夹占用的空间, 只返回总大小
+func DirSize(ctx context.Context, path string) (int64, error) {
+	usage, err := Usage(ctx, path, UsageOpts{})
+	if nil != err {
+		return 0, err
+	}
+	return usage.Size, nil
+}
+
+// Usage 统计文件夹占用的空间及每个直接下级的占用, 各个下级文件夹并发统计
+func Usage(ctx context.Context, path string, opts UsageOpts) (*DirUsage, error) {
+	path = filepath.Clean(path)
+	st, err := os.Stat(path)
+	if nil != err {
+		return nil, err
+	}
+	if !st.IsDir() {
+		return nil, &os.PathError{Op: "Usage", Path: path, Err: errors.New("not a directory")}
+	}
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = 4
+	}
+	// 第一级逐个读取, 文件夹交给worker遍历
+	walkOpts := opts.Walk
+	walkOpts.MaxDepth = 1
+	var children []DirUsage
+	var skipped int64
+	err = Walk(path, walkOpts, func(entry WalkEntry, err error) error {
+		if nil != err {
+			if opts.SkipErrors && entry.Path != path {
+				skipped++
+				return nil
+			}
+			return err
+		}
+		child := DirUsage{Path: entry.Path, Name: entry.Name, IsDir: entry.IsDir}
+		if !entry.IsDir {
+			child.Size, child.Files = entry.Size, 1
+		}
+		children = append(children, child)
+		return nil
+	})
+	if nil != err {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var firstErr error
+	var l sync.Mutex
+	jobs := make(chan *DirUsage)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for child := range jobs {
+				if err := usageOf(ctx, path, child, opts); nil != err {
+					l.Lock()
+					if nil == firstErr {
+						firstErr = err
+						cancel()
+					}
+					l.Unlock()
+				}
+			}
+		}()
+	}
+	for i := range children {
+		if !children[i].IsDir {
+			continue
+		}
+		select {
+		case jobs <- &children[i]:
+		case <-ctx.Done():
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	if nil != firstErr {
+		return nil, firstErr
+	}
+	if err = ctx.Err(); nil != err {
+		return nil, err
+	}
+
+	usage := &DirUsage{Path: path, Name: filepath.Base(path), IsDir: true, Errors: skipped, Children: children}
+	for _, child := range children {
+		usage.Size += child.Size
+		usage.Files += child.Files
+		usage.Dirs += child.Dirs
+		usage.Errors += child.Errors
+		if child.IsDir {
+			usage.Dirs++
+		}
+	}
+	sort.SliceStable(usage.Children, func(i, j int) bool {
+		if usage.Children[i].Size != usage.Children[j].Size {
+			return usage.Children[i].Size > usage.Children[j].Size
+		}
+		return usage.Children[i].Name < usage.Children[j].Name
+	})
+	return usage, nil
+}
+
+// usageOf 统计root的下级文件夹child, 过滤规则相对root生效
+func usageOf(ctx context.Context, root string, child *DirUsage, opts UsageOpts) error {
+	st, err := os.Stat(child.Path)
+	if nil != err {
+		if opts.SkipErrors {
+			child.Errors++
+			return nil
+		}
+		return err
+	}
+	rootSt, err := os.Stat(root)
+	if nil != err {
+		return err
+	}
+	w := &walker{
+		opts:    opts.Walk,
+		include: parseRules("", opts.Walk.Include),
+		exclude: parseRules("", opts.Walk.Exclude),
+	}
+	w.fn = func(entry WalkEntry, err error) error {
+		if nil != err {
+			if opts.SkipErrors {
+				child.Errors++
+				return nil
+			}
+			return err
+		}
+		if err = ctx.Err(); nil != err {
+			return err
+		}
+		if entry.IsDir {
+			child.Dirs++
+		} else {
+			child.Size += entry.Size
+			child.Files++
+		}
+		return nil
+	}
+	if opts.Walk.MaxDepth > 0 && opts.Walk.MaxDepth < 2 {
+		return nil
+	}
+	ignores := w.loadIgnoreFiles(root, "", nil)
+	err = w.walkDir(child.Path, child.Name, 2, []os.FileInfo{rootSt, st}, ignores)
+	if err == StopWalk {
+		return nil
+	}
+	return err
+}
+
+// UsageCache 缓存文件夹的空间统计结果, 超过有效期或调用Invalidate后重新统计
+type UsageCache struct {
+	opts    UsageOpts
+	ttl     time.Duration
+	entries map[string]usageCacheEntry
+	l       *sync.Mutex
+}
+
+// usageCacheEntry 缓存的统计结果
+type usageCacheEntry struct {
+	usage   *DirUsage
+	expires time.Time
+}
+
+// NewUsageCache 创建空间统计缓存, ttl<=0时只能通过Invalidate失效
+func NewUsageCache(opts UsageOpts, ttl time.Duration) *UsageCache {
+	return &UsageCache{
+		opts:    opts,
+		ttl:     ttl,
+		entries: make(map[string]usageCacheEntry),
+		l:       new(sync.Mutex),
+	}
+}
+
+// Get 获取文件夹的空间占用, 有缓存时直接返回; 返回的结果是共享的, 不能修改
+func (c *UsageCache) Get(ctx context.Context, path string) (*DirUsage, error) {
+	path, err := filepath.Abs(path)
+	if nil != err {
+		return nil, err
+	}
+	c.l.Lock()
+	entry, ok := c.entries[path]
+	c.l.Unlock()
+	if ok && (c.ttl <= 0 || time.Now().Before(entry.expires)) {
+		return entry.usage, nil
+	}
+	usage, err := Usage(ctx, path, c.opts)
+	if nil != err {
+		return nil, err
+	}
+	c.l.Lock()
+	c.entries[path] = usageCacheEntry{usage: usage, expires: time.Now().Add(c.ttl)}
+	c.l.Unlock()
+	return usage, nil
+}
+
+// Invalidate 路径下的内容发生了变化, 清除包含该路径的文件夹和该路径下文件夹的缓存
+func (c *UsageCache) Invalidate(path string) {
+	path, err := filepath.Abs(path)
+	if nil != err {
+		return
+	}
+	sep := string(filepath.Separator)
+	c.l.Lock()
+	defer c.l.Unlock()
+	for cached := range c.entries {
+		if cached == path || strings.HasPrefix(path, strings.TrimSuffix(cached, sep)+sep) || strings.HasPrefix(cached, path+sep) {
+			delete(c.entries, cached)
+		}
+	}
+}
+
+// InvalidateAll 清除所有缓存
+func (c *UsageCache) InvalidateAll() {
+	c.l.Lock()
+	defer c.l.Unlock()
+	c.entries = make(map[string]usageCacheEntry)
+}
+
+// CheckQuota 检查文件夹再写入incoming字节后是否超出配额quota, 超出时返回ErrQuotaExceeded
+// 使用缓存的统计结果, 写入完成后需要调用Invalidate
+func (c *UsageCache) CheckQuota(ctx context.Context, dir string, quota, incoming int64) error {
+	usage, err := c.Get(ctx, dir)
+	if nil != err {
+		return err
+	}
+	if usage.Size+incoming > quota {
+		return &os.PathError{Op: "CheckQuota", Path: dir, Err: ErrQuotaExceeded}
+	}
+	return nil
+}
+
+// DiskSpace 分区的空间信息, 单位字节
+type DiskSpace struct {
+	Total int64 // 总空间
+	Free  int64 // 剩余空间, 包含只有root可以使用的保留空间
+	Avail int64 // 当前用户可以使用的空间
+	Used  int64 // 已使用的空间
+}
+
+// GetDiskSpace 获取路径所在分区的空间信息
+func GetDiskSpace(path string) (DiskSpace, error) {
+	space, err := diskSpace(path)
+	if nil != err {
+		return space, &os.PathError{Op: "GetDiskSpace", Path: path, Err: err}
+	}
+	space.Used = space.Total - space.Free
+	return space, nil
+}
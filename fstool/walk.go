@@ -0,0 +1,297 @@
+// Copyright (C) 2019 WuPeng <wupeng364@outlook.com>.
+// Use of this source code is governed by an MIT-style.
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction,
+// including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software,
+// and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+// 文件工具-目录遍历
+// 规则语法与.gitignore一致: 不含'/'的规则匹配任意一级的名称, 含'/'的规则从遍历起点(或规则文件所在目录)开始匹配
+// 支持 * ? [] 和 ** (匹配任意多级目录), '!'开头表示取反, '/'结尾只匹配目录
+
+package fstool
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SymlinkPolicy 符号链接的处理方式
+type SymlinkPolicy int
+
+const (
+	// SymlinkNoFollow 返回链接本身, 不进入链接指向的目录
+	SymlinkNoFollow SymlinkPolicy = iota
+	// SymlinkFollow 返回链接指向的文件信息, 进入链接指向的目录, 检测循环
+	SymlinkFollow
+	// SymlinkSkip 忽略符号链接
+	SymlinkSkip
+)
+
+var (
+	// SkipDir 遍历回调返回此错误时不进入该目录, 对文件返回时跳过同级的剩余文件
+	SkipDir = filepath.SkipDir
+	// StopWalk 遍历回调返回此错误时结束遍历, Walk返回nil
+	StopWalk = errors.New("stop walk")
+	// ErrSymlinkLoop 跟随符号链接时出现循环
+	ErrSymlinkLoop = errors.New("symlink loop")
+)
+
+// WalkOpts 目录遍历选项
+type WalkOpts struct {
+	Include     []string      // 包含的文件规则, 为空时包含全部, 只对文件生效
+	Exclude     []string      // 排除的文件|夹规则, 排除的目录不再进入
+	IgnoreFiles []string      // 每个目录下按gitignore规则生效的文件名, 如: .gitignore
+	MaxDepth    int           // 最大深度, 0不限制, 1只遍历起点下一级
+	Symlinks    SymlinkPolicy // 符号链接的处理方式
+	Sorted      bool          // 同级按名称排序遍历
+}
+
+// WalkEntry 遍历到的文件|夹信息
+type WalkEntry struct {
+	Path    string      // 完整路径
+	RelPath string      // 相对遍历起点的路径, 使用'/'分隔
+	Name    string      // 名称
+	Depth   int         // 深度, 起点下一级为1
+	Size    int64       // 大小
+	Mode    os.FileMode // 权限和类型
+	ModTime time.Time   // 修改时间
+	IsDir   bool        // 是否是文件夹
+	Symlink bool        // 是否是符号链接
+}
+
+// WalkFunc 遍历回调(文件信息, 错误信息), 出错时entry只有路径信息
+// 返回SkipDir跳过目录, 返回StopWalk结束遍历, 返回其他错误终止遍历并返回该错误
+type WalkFunc func(entry WalkEntry, err error) error
+
+// Walk 遍历root下的文件|夹, 不包含root本身
+func Walk(root string, opts WalkOpts, fn WalkFunc) error {
+	st, err := os.Stat(root)
+	if nil != err {
+		return err
+	}
+	if !st.IsDir() {
+		return &os.PathError{Op: "Walk", Path: root, Err: errors.New("not a directory")}
+	}
+	w := &walker{
+		opts:    opts,
+		fn:      fn,
+		include: parseRules("", opts.Include),
+		exclude: parseRules("", opts.Exclude),
+	}
+	err = w.walkDir(root, "", 1, []os.FileInfo{st}, nil)
+	if err == StopWalk {
+		return nil
+	}
+	return err
+}
+
+// MatchPattern 相对路径是否匹配规则, 规则语法与WalkOpts一致
+func MatchPattern(pattern, relPath string, isDir bool) bool {
+	rules := parseRules("", []string{pattern})
+	return len(rules) > 0 && rules[0].match(relPath, isDir)
+}
+
+// walker 遍历状态
+type walker struct {
+	opts    WalkOpts
+	fn      WalkFunc
+	include []walkRule
+	exclude []walkRule
+}
+
+// walkDir 遍历一个目录, ancestors用于检测循环, ignores为上级目录的规则文件中的规则
+func (w *walker) walkDir(dir, rel string, depth int, ancestors []os.FileInfo, ignores []walkRule) error {
+	ignores = w.loadIgnoreFiles(dir, rel, ignores)
+	names, err := GetDirList(dir)
+	if nil != err {
+		return w.fn(WalkEntry{Path: dir, RelPath: rel, Name: filepath.Base(dir), Depth: depth - 1, IsDir: true}, err)
+	}
+	if w.opts.Sorted {
+		sort.Strings(names)
+	}
+	for _, name := range names {
+		entry := WalkEntry{Path: filepath.Join(dir, name), RelPath: joinRelPath(rel, name), Name: name, Depth: depth}
+		info, err := os.Lstat(entry.Path)
+		if nil == err && info.Mode()&os.ModeSymlink != 0 {
+			entry.Symlink = true
+			if w.opts.Symlinks == SymlinkSkip {
+				continue
+			}
+			if w.opts.Symlinks == SymlinkFollow {
+				info, err = os.Stat(entry.Path)
+			}
+		}
+		if nil != err {
+			if err = w.fn(entry, err); nil != err {
+				return err
+			}
+			continue
+		}
+		entry.Size, entry.Mode, entry.ModTime, entry.IsDir = info.Size(), info.Mode(), info.ModTime(), info.IsDir()
+		if matchRules(w.exclude, entry.RelPath, entry.IsDir) || matchRules(ignores, entry.RelPath, entry.IsDir) {
+			continue
+		}
+		if !entry.IsDir && len(w.include) > 0 && !matchRules(w.include, entry.RelPath, false) {
+			continue
+		}
+		if entry.IsDir && w.opts.Symlinks == SymlinkFollow && isAncestor(ancestors, info) {
+			if err = w.fn(entry, ErrSymlinkLoop); nil != err {
+				return err
+			}
+			continue
+		}
+
+		err = w.fn(entry, nil)
+		if err == SkipDir {
+			if entry.IsDir {
+				continue
+			}
+			return nil
+		}
+		if nil != err {
+			return err
+		}
+		if entry.IsDir && (w.opts.MaxDepth <= 0 || depth < w.opts.MaxDepth) {
+			if err = w.walkDir(entry.Path, entry.RelPath, depth+1, append(ancestors, info), ignores); nil != err {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// loadIgnoreFiles 读取目录下的规则文件, 返回新的规则列表
+func (w *walker) loadIgnoreFiles(dir, rel string, ignores []walkRule) []walkRule {
+	res := ignores[:len(ignores):len(ignores)]
+	for _, name := range w.opts.IgnoreFiles {
+		fp, err := os.Open(filepath.Join(dir, name))
+		if nil != err {
+			continue
+		}
+		lines := make([]string, 0)
+		scanner := bufio.NewScanner(fp)
+		for scanner.Scan() {
+			lines = append(lines, scanner.Text())
+		}
+		fp.Close()
+		res = append(res, parseRules(rel, lines)...)
+	}
+	return res
+}
+
+// walkRule 一条匹配规则
+type walkRule struct {
+	base     string   // 规则生效的目录, 相对遍历起点
+	segments []string // 按'/'分隔的规则
+	negate   bool     // '!'开头, 取反
+	dirOnly  bool     // '/'结尾, 只匹配目录
+	anchored bool     // 含'/', 从base开始匹配
+}
+
+// parseRules 解析规则, 忽略空行和'#'开头的注释
+func parseRules(base string, lines []string) []walkRule {
+	rules := make([]walkRule, 0, len(lines))
+	for _, line := range lines {
+		line = strings.TrimRight(line, " \t\r")
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		rule := walkRule{base: base}
+		if strings.HasPrefix(line, "!") {
+			rule.negate = true
+			line = line[1:]
+		}
+		if strings.HasSuffix(line, "/") {
+			rule.dirOnly = true
+			line = strings.TrimRight(line, "/")
+		}
+		if strings.Contains(line, "/") {
+			rule.anchored = true
+			line = strings.TrimLeft(line, "/")
+		}
+		if len(line) == 0 {
+			continue
+		}
+		rule.segments = strings.Split(line, "/")
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+// match 规则是否匹配相对路径
+func (rule walkRule) match(relPath string, isDir bool) bool {
+	if rule.dirOnly && !isDir {
+		return false
+	}
+	if len(rule.base) > 0 {
+		if !strings.HasPrefix(relPath, rule.base+"/") {
+			return false
+		}
+		relPath = relPath[len(rule.base)+1:]
+	}
+	if rule.anchored {
+		return matchSegments(rule.segments, strings.Split(relPath, "/"))
+	}
+	ok, _ := path.Match(rule.segments[0], path.Base(relPath))
+	return ok
+}
+
+// matchRules 按顺序匹配规则, 最后一条匹配的规则决定结果
+func matchRules(rules []walkRule, relPath string, isDir bool) bool {
+	res := false
+	for _, rule := range rules {
+		if rule.match(relPath, isDir) {
+			res = !rule.negate
+		}
+	}
+	return res
+}
+
+// matchSegments 逐级匹配, '**'匹配任意多级
+func matchSegments(pattern, segments []string) bool {
+	if len(pattern) == 0 {
+		return len(segments) == 0
+	}
+	if pattern[0] == "**" {
+		for i := 0; i <= len(segments); i++ {
+			if matchSegments(pattern[1:], segments[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(segments) == 0 {
+		return false
+	}
+	if ok, _ := path.Match(pattern[0], segments[0]); !ok {
+		return false
+	}
+	return matchSegments(pattern[1:], segments[1:])
+}
+
+// isAncestor 目录是否已经在遍历路径上
+func isAncestor(ancestors []os.FileInfo, info os.FileInfo) bool {
+	for _, ancestor := range ancestors {
+		if os.SameFile(ancestor, info) {
+			return true
+		}
+	}
+	return false
+}
+
+// joinRelPath 拼接相对路径
+func joinRelPath(rel, name string) string {
+	if len(rel) == 0 {
+		return name
+	}
+	return rel + "/" + name
+}
@@ -0,0 +1,398 @@
+// Copyright (C) 2019 WuPeng <wupeng364@outlook.com>.
+// Use of this source code is governed by an MIT-style.
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction,
+// including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software,
+// and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+// 文件工具-文件变化监听
+// Linux下使用inotify, 其他平台或inotify不可用时使用轮询; 可以递归监听子文件夹, 合并短时间内的重复事件
+
+package fstool
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// WatchOp 文件变化类型, 合并后的事件可能包含多种类型
+type WatchOp uint32
+
+const (
+	// WatchCreate 创建
+	WatchCreate WatchOp = 1 << iota
+	// WatchWrite 内容修改
+	WatchWrite
+	// WatchRemove 删除, 或移出监听范围
+	WatchRemove
+	// WatchRename 在监听范围内重命名, OldPath为原路径
+	WatchRename
+	// WatchChmod 权限等属性修改
+	WatchChmod
+)
+
+// ErrEventOverflow 事件太多, 内核队列溢出, 部分事件已丢失
+var ErrEventOverflow = errors.New("watch event queue overflow")
+
+// Has 是否包含某种变化
+func (op WatchOp) Has(o WatchOp) bool {
+	return op&o != 0
+}
+
+// String 变化类型名称, 如 "CREATE|WRITE"
+func (op WatchOp) String() string {
+	var names []string
+	for _, item := range []struct {
+		op   WatchOp
+		name string
+	}{{WatchCreate, "CREATE"}, {WatchWrite, "WRITE"}, {WatchRemove, "REMOVE"}, {WatchRename, "RENAME"}, {WatchChmod, "CHMOD"}} {
+		if op.Has(item.op) {
+			names = append(names, item.name)
+		}
+	}
+	return strings.Join(names, "|")
+}
+
+// WatchEvent 文件变化事件
+type WatchEvent struct {
+	Path    string  // 完整路径
+	OldPath string  // 重命名前的路径
+	Op      WatchOp // 变化类型
+	IsDir   bool    // 是否是文件夹
+}
+
+// WatcherOpts 监听选项
+type WatcherOpts struct {
+	Recursive bool          // 是否监听子文件夹, 包括之后新建的子文件夹
+	Debounce  time.Duration // 同一路径在该时间内没有新的事件才发出, 期间的事件合并; 0不合并
+	Polling   bool          // 强制使用轮询方式
+	Interval  time.Duration // 轮询间隔, 默认1秒
+	Exclude   []string      // 排除规则, 与WalkOpts.Exclude相同, 相对监听的文件夹
+}
+
+// Watcher 文件变化监听器
+type Watcher struct {
+	root    string // 监听的文件夹
+	file    string // 监听单个文件时的文件名
+	opts    WatcherOpts
+	exclude []walkRule
+	events  chan WatchEvent
+	errors  chan error
+	raw     chan WatchEvent // 后端产生的事件
+	done    chan struct{}
+	backend io.Closer
+	once    *sync.Once
+	wg      *sync.WaitGroup
+}
+
+// NewWatcher 监听文件夹或文件, 监听文件时实际监听其所在的文件夹, 文件被替换后仍然有效
+// 使用完毕后需要调用Close
+func NewWatcher(path string, opts WatcherOpts) (*Watcher, error) {
+	absPath, err := filepath.Abs(path)
+	if nil != err {
+		return nil, err
+	}
+	st, err := os.Stat(absPath)
+	if nil != err {
+		return nil, err
+	}
+	if opts.Interval <= 0 {
+		opts.Interval = time.Second
+	}
+	w := &Watcher{
+		root:    absPath,
+		opts:    opts,
+		exclude: parseRules("", opts.Exclude),
+		events:  make(chan WatchEvent, 64),
+		errors:  make(chan error, 16),
+		raw:     make(chan WatchEvent, 64),
+		done:    make(chan struct{}),
+		once:    new(sync.Once),
+		wg:      new(sync.WaitGroup),
+	}
+	if !st.IsDir() {
+		w.root, w.file = filepath.Dir(absPath), filepath.Base(absPath)
+		w.opts.Recursive = false
+	}
+	if !opts.Polling {
+		w.backend, err = newInotifyBackend(w)
+	}
+	if opts.Polling || nil != err {
+		w.backend = newPollingBackend(w)
+	}
+	w.wg.Add(1)
+	go w.dispatch()
+	return w, nil
+}
+
+// Events 文件变化事件, Close后关闭
+func (w *Watcher) Events() <-chan WatchEvent {
+	return w.events
+}
+
+// Errors 监听过程中的错误, 如ErrEventOverflow, 来不及处理的错误会被丢弃; Close后关闭
+func (w *Watcher) Errors() <-chan error {
+	return w.errors
+}
+
+// Close 停止监听, 关闭事件通道
+func (w *Watcher) Close() error {
+	var err error
+	w.once.Do(func() {
+		close(w.done)
+		err = w.backend.Close()
+		w.wg.Wait()
+		close(w.events)
+		close(w.errors)
+	})
+	return err
+}
+
+// accept 路径是否在监听范围内
+func (w *Watcher) accept(path string, isDir bool) bool {
+	rel, err := filepath.Rel(w.root, path)
+	if nil != err || rel == "." || strings.HasPrefix(rel, "..") {
+		return false
+	}
+	rel = filepath.ToSlash(rel)
+	if len(w.file) > 0 {
+		return rel == w.file
+	}
+	if !w.opts.Recursive && strings.Contains(rel, "/") {
+		return false
+	}
+	return !matchRules(w.exclude, rel, isDir)
+}
+
+// emit 后端发出事件
+func (w *Watcher) emit(ev WatchEvent) {
+	if !w.accept(ev.Path, ev.IsDir) {
+		if len(ev.OldPath) == 0 || !w.accept(ev.OldPath, ev.IsDir) {
+			return
+		}
+		// 移出监听范围
+		ev = WatchEvent{Path: ev.OldPath, Op: WatchRemove, IsDir: ev.IsDir}
+	} else if len(ev.OldPath) > 0 && !w.accept(ev.OldPath, ev.IsDir) {
+		// 从监听范围外移入
+		ev = WatchEvent{Path: ev.Path, Op: WatchCreate, IsDir: ev.IsDir}
+	}
+	select {
+	case w.raw <- ev:
+	case <-w.done:
+	}
+}
+
+// emitError 后端发出错误, 没有及时处理时丢弃
+func (w *Watcher) emitError(err error) {
+	select {
+	case w.errors <- err:
+	default:
+	}
+}
+
+// dispatch 合并事件后发出
+func (w *Watcher) dispatch() {
+	defer w.wg.Done()
+	type pendingEvent struct {
+		event    WatchEvent
+		deadline time.Time
+	}
+	pending := make(map[string]*pendingEvent)
+	timer := time.NewTimer(time.Hour)
+	timer.Stop()
+	for {
+		select {
+		case <-w.done:
+			timer.Stop()
+			return
+		case ev := <-w.raw:
+			if w.opts.Debounce <= 0 {
+				w.send(ev)
+				continue
+			}
+			deadline := time.Now().Add(w.opts.Debounce)
+			// 短时间内创建后重命名, 视为直接创建了新文件
+			if old, ok := pending[ev.OldPath]; ok && ev.Op == WatchRename && old.event.Op.Has(WatchCreate) {
+				delete(pending, ev.OldPath)
+				ev = WatchEvent{Path: ev.Path, Op: WatchCreate | old.event.Op&WatchWrite, IsDir: ev.IsDir}
+			}
+			if old, ok := pending[ev.Path]; ok {
+				if old.event.Op.Has(WatchCreate) && ev.Op.Has(WatchRemove) {
+					// 临时文件, 创建后又被删除
+					delete(pending, ev.Path)
+				} else {
+					old.event.Op |= ev.Op
+					old.event.IsDir = ev.IsDir
+					if len(ev.OldPath) > 0 {
+						old.event.OldPath = ev.OldPath
+					}
+					old.deadline = deadline
+				}
+			} else {
+				pending[ev.Path] = &pendingEvent{event: ev, deadline: deadline}
+			}
+			// 按最早到期的事件设置定时器, 持续变化的路径不能推迟其他路径的事件
+			var next time.Time
+			for _, p := range pending {
+				if next.IsZero() || p.deadline.Before(next) {
+					next = p.deadline
+				}
+			}
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+			if !next.IsZero() {
+				timer.Reset(time.Until(next))
+			}
+		case now := <-timer.C:
+			var ready []*pendingEvent
+			var next time.Time
+			for path, p := range pending {
+				if !p.deadline.After(now) {
+					ready = append(ready, p)
+					delete(pending, path)
+				} else if next.IsZero() || p.deadline.Before(next) {
+					next = p.deadline
+				}
+			}
+			sort.Slice(ready, func(i, j int) bool { return ready[i].deadline.Before(ready[j].deadline) })
+			for _, p := range ready {
+				w.send(p.event)
+			}
+			if !next.IsZero() {
+				timer.Reset(time.Until(next))
+			}
+		}
+	}
+}
+
+// send 发出事件, 关闭时放弃
+func (w *Watcher) send(ev WatchEvent) {
+	select {
+	case w.events <- ev:
+	case <-w.done:
+	}
+}
+
+// pollingBackend 轮询方式, 定时比较文件的大小、修改时间和权限
+type pollingBackend struct {
+	done chan struct{}
+	once *sync.Once
+}
+
+// newPollingBackend 创建轮询后端
+func newPollingBackend(w *Watcher) *pollingBackend {
+	pb := &pollingBackend{done: make(chan struct{}), once: new(sync.Once)}
+	last := w.scan()
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		ticker := time.NewTicker(w.opts.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-pb.done:
+				return
+			case <-ticker.C:
+				cur := w.scan()
+				for _, ev := range diffSnapshots(last, cur) {
+					w.emit(ev)
+				}
+				last = cur
+			}
+		}
+	}()
+	return pb
+}
+
+// Close 停止轮询
+func (pb *pollingBackend) Close() error {
+	pb.once.Do(func() {
+		close(pb.done)
+	})
+	return nil
+}
+
+// scan 获取监听范围内所有文件的信息
+func (w *Watcher) scan() map[string]os.FileInfo {
+	res := make(map[string]os.FileInfo)
+	opts := WalkOpts{Exclude: w.opts.Exclude}
+	if !w.opts.Recursive {
+		opts.MaxDepth = 1
+	}
+	if len(w.file) > 0 {
+		if st, err := os.Lstat(filepath.Join(w.root, w.file)); nil == err {
+			res[filepath.Join(w.root, w.file)] = st
+		}
+		return res
+	}
+	Walk(w.root, opts, func(entry WalkEntry, err error) error {
+		if nil == err {
+			if st, err := os.Lstat(entry.Path); nil == err {
+				res[entry.Path] = st
+			}
+		}
+		return nil
+	})
+	return res
+}
+
+// diffSnapshots 比较两次扫描的结果, 同一个文件换了路径视为重命名
+func diffSnapshots(last, cur map[string]os.FileInfo) []WatchEvent {
+	var created, removed []string
+	var events []WatchEvent
+	for path, st := range cur {
+		old, ok := last[path]
+		if !ok {
+			created = append(created, path)
+			continue
+		}
+		var op WatchOp
+		if !os.SameFile(old, st) || !old.ModTime().Equal(st.ModTime()) || old.Size() != st.Size() {
+			op |= WatchWrite
+		}
+		if old.Mode() != st.Mode() {
+			op |= WatchChmod
+		}
+		if op != 0 && !(st.IsDir() && op == WatchWrite) {
+			events = append(events, WatchEvent{Path: path, Op: op, IsDir: st.IsDir()})
+		}
+	}
+	for path := range last {
+		if _, ok := cur[path]; !ok {
+			removed = append(removed, path)
+		}
+	}
+	sort.Strings(created)
+	sort.Strings(removed)
+	renamed := make(map[string]bool)
+	for _, path := range created {
+		ev := WatchEvent{Path: path, Op: WatchCreate, IsDir: cur[path].IsDir()}
+		for _, old := range removed {
+			if !renamed[old] && os.SameFile(last[old], cur[path]) {
+				renamed[old] = true
+				ev.Op, ev.OldPath = WatchRename, old
+				break
+			}
+		}
+		events = append(events, ev)
+	}
+	for _, path := range removed {
+		if !renamed[path] {
+			events = append(events, WatchEvent{Path: path, Op: WatchRemove, IsDir: last[path].IsDir()})
+		}
+	}
+	sort.SliceStable(events, func(i, j int) bool { return events[i].Path < events[j].Path })
+	return events
+}
@@ -0,0 +1,247 @@
+// Copyright (C) 2019 WuPeng <wupeng364@outlook.com>.
+// Use of this source code is governed by an MIT-style.
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction,
+// including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software,
+// and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+// 文件工具-文件变化监听, inotify实现
+
+package fstool
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+// inotifyMask 关注的inotify事件
+const inotifyMask = syscall.IN_CREATE | syscall.IN_MODIFY | syscall.IN_ATTRIB | syscall.IN_DELETE |
+	syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO | syscall.IN_DELETE_SELF | syscall.IN_MOVE_SELF
+
+// inotifyBackend inotify后端, 每个文件夹一个watch
+type inotifyBackend struct {
+	w     *Watcher
+	file  *os.File
+	fd    int
+	wds   map[int32]string // watch对应的文件夹
+	paths map[string]int32 // 文件夹对应的watch
+	l     *sync.Mutex
+}
+
+// newInotifyBackend 创建inotify后端, 递归时为所有子文件夹添加watch
+func newInotifyBackend(w *Watcher) (io.Closer, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if nil != err {
+		return nil, os.NewSyscallError("inotify_init1", err)
+	}
+	ib := &inotifyBackend{
+		w: w,
+		// 非阻塞的fd交给runtime poller, Close时可以中断Read
+		file:  os.NewFile(uintptr(fd), "inotify"),
+		fd:    fd,
+		wds:   make(map[int32]string),
+		paths: make(map[string]int32),
+		l:     new(sync.Mutex),
+	}
+	if _, err = ib.addTree(w.root, false); nil != err {
+		ib.file.Close()
+		return nil, err
+	}
+	w.wg.Add(1)
+	go ib.readEvents()
+	return ib, nil
+}
+
+// addWatch 为文件夹添加watch
+func (ib *inotifyBackend) addWatch(dir string) error {
+	wd, err := syscall.InotifyAddWatch(ib.fd, dir, inotifyMask)
+	if nil != err {
+		return os.NewSyscallError("inotify_add_watch", err)
+	}
+	ib.l.Lock()
+	ib.wds[int32(wd)] = dir
+	ib.paths[dir] = int32(wd)
+	ib.l.Unlock()
+	return nil
+}
+
+// addTree 为文件夹及其子文件夹添加watch, 返回其中已有的内容
+// 新建的文件夹在添加watch之前可能已经有内容, 需要补发创建事件
+func (ib *inotifyBackend) addTree(dir string, collect bool) ([]WatchEvent, error) {
+	if err := ib.addWatch(dir); nil != err {
+		return nil, err
+	}
+	if !ib.w.opts.Recursive {
+		return nil, nil
+	}
+	var events []WatchEvent
+	rel, _ := filepath.Rel(ib.w.root, dir)
+	err := Walk(dir, WalkOpts{Sorted: true}, func(entry WalkEntry, err error) error {
+		if nil != err {
+			return nil
+		}
+		relPath := filepath.ToSlash(filepath.Join(rel, entry.RelPath))
+		if matchRules(ib.w.exclude, relPath, entry.IsDir) {
+			if entry.IsDir {
+				return SkipDir
+			}
+			return nil
+		}
+		if collect {
+			events = append(events, WatchEvent{Path: entry.Path, Op: WatchCreate, IsDir: entry.IsDir})
+		}
+		if entry.IsDir {
+			if err := ib.addWatch(entry.Path); nil != err {
+				ib.w.emitError(err)
+			}
+		}
+		return nil
+	})
+	return events, err
+}
+
+// removeTree 移除文件夹及其子文件夹的watch
+func (ib *inotifyBackend) removeTree(dir string) {
+	ib.l.Lock()
+	defer ib.l.Unlock()
+	for path, wd := range ib.paths {
+		if path == dir || strings.HasPrefix(path, dir+string(filepath.Separator)) {
+			syscall.InotifyRmWatch(ib.fd, uint32(wd))
+			delete(ib.paths, path)
+			delete(ib.wds, wd)
+		}
+	}
+}
+
+// renameTree 文件夹在监听范围内重命名后更新路径
+func (ib *inotifyBackend) renameTree(oldDir, newDir string) {
+	ib.l.Lock()
+	defer ib.l.Unlock()
+	for path, wd := range ib.paths {
+		if path == oldDir || strings.HasPrefix(path, oldDir+string(filepath.Separator)) {
+			moved := newDir + path[len(oldDir):]
+			delete(ib.paths, path)
+			ib.paths[moved] = wd
+			ib.wds[wd] = moved
+		}
+	}
+}
+
+// readEvents 读取并转换inotify事件
+func (ib *inotifyBackend) readEvents() {
+	defer ib.w.wg.Done()
+	buf := make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+	for {
+		n, err := ib.file.Read(buf)
+		if nil != err {
+			return
+		}
+		moves := make(map[uint32]WatchEvent) // 本批次中未配对的IN_MOVED_FROM
+		var order []uint32
+		for offset := 0; offset+syscall.SizeofInotifyEvent <= n; {
+			event := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			start := offset + syscall.SizeofInotifyEvent
+			end := start + int(event.Len)
+			if end > n {
+				break
+			}
+			offset = end
+			name := strings.TrimRight(string(buf[start:end]), "\x00")
+			if event.Mask&syscall.IN_Q_OVERFLOW != 0 {
+				ib.w.emitError(ErrEventOverflow)
+				continue
+			}
+			ib.l.Lock()
+			dir, ok := ib.wds[event.Wd]
+			if event.Mask&syscall.IN_IGNORED != 0 {
+				delete(ib.wds, event.Wd)
+				if ok && ib.paths[dir] == event.Wd {
+					delete(ib.paths, dir)
+				}
+			}
+			ib.l.Unlock()
+			if !ok {
+				continue
+			}
+			path := dir
+			if len(name) > 0 {
+				path = filepath.Join(dir, name)
+			}
+			isDir := event.Mask&syscall.IN_ISDIR != 0
+			switch {
+			case event.Mask&(syscall.IN_DELETE_SELF|syscall.IN_MOVE_SELF) != 0:
+				// 子文件夹的删除由上级文件夹的事件通知, 这里只处理监听的根文件夹
+				if path == ib.w.root {
+					select {
+					case ib.w.raw <- WatchEvent{Path: path, Op: WatchRemove, IsDir: true}:
+					case <-ib.w.done:
+					}
+				}
+			case event.Mask&syscall.IN_CREATE != 0:
+				ib.w.emit(WatchEvent{Path: path, Op: WatchCreate, IsDir: isDir})
+				if isDir && ib.w.opts.Recursive && ib.w.accept(path, true) {
+					ib.addNewDir(path)
+				}
+			case event.Mask&syscall.IN_MODIFY != 0:
+				ib.w.emit(WatchEvent{Path: path, Op: WatchWrite, IsDir: isDir})
+			case event.Mask&syscall.IN_ATTRIB != 0:
+				ib.w.emit(WatchEvent{Path: path, Op: WatchChmod, IsDir: isDir})
+			case event.Mask&syscall.IN_DELETE != 0:
+				ib.w.emit(WatchEvent{Path: path, Op: WatchRemove, IsDir: isDir})
+			case event.Mask&syscall.IN_MOVED_FROM != 0:
+				moves[event.Cookie] = WatchEvent{Path: path, Op: WatchRemove, IsDir: isDir}
+				order = append(order, event.Cookie)
+			case event.Mask&syscall.IN_MOVED_TO != 0:
+				from, paired := moves[event.Cookie]
+				delete(moves, event.Cookie)
+				if !paired {
+					ib.w.emit(WatchEvent{Path: path, Op: WatchCreate, IsDir: isDir})
+					if isDir && ib.w.opts.Recursive && ib.w.accept(path, true) {
+						ib.addNewDir(path)
+					}
+					break
+				}
+				ib.w.emit(WatchEvent{Path: path, OldPath: from.Path, Op: WatchRename, IsDir: isDir})
+				if isDir && ib.w.opts.Recursive {
+					if ib.w.accept(path, true) {
+						ib.renameTree(from.Path, path)
+					} else {
+						ib.removeTree(from.Path)
+					}
+				}
+			}
+		}
+		// 移出监听范围的文件|夹
+		for _, cookie := range order {
+			if from, ok := moves[cookie]; ok {
+				ib.w.emit(from)
+				if from.IsDir {
+					ib.removeTree(from.Path)
+				}
+			}
+		}
+	}
+}
+
+// addNewDir 为新文件夹添加watch, 补发其中已有内容的创建事件
+func (ib *inotifyBackend) addNewDir(dir string) {
+	events, err := ib.addTree(dir, true)
+	if nil != err {
+		ib.w.emitError(err)
+	}
+	for _, ev := range events {
+		ib.w.emit(ev)
+	}
+}
+
+// Close 关闭inotify
+func (ib *inotifyBackend) Close() error {
+	return ib.file.Close()
+}
@@ -59,6 +59,11 @@ type mrecorder interface {
 	SetValue(key string, value string) error
 }
 
+// 支持批量写入的记录器, 多个值一次性保存
+type batchRecorder interface {
+	SetValues(values map[string]string) error
+}
+
 // Returns 函数执行后的返回值, 暂时不封装
 type Returns []reflect.Value
 
@@ -164,8 +169,17 @@ func (mloader *Loader) getInstalledVersion(opts Opts) string {
 
 // setVersion 设置模块版本号 - 模块保留小数两位
 func (mloader *Loader) setVersion(opts Opts) {
-	mloader.mrecord.SetValue(opts.Name+".SetupVer", strconv.FormatFloat(opts.Version, 'f', 2, 64))
-	mloader.mrecord.SetValue(opts.Name+".SetupDate", strconv.FormatInt(time.Now().UnixNano(), 10))
+	setupVer := strconv.FormatFloat(opts.Version, 'f', 2, 64)
+	setupDate := strconv.FormatInt(time.Now().UnixNano(), 10)
+	if brd, ok := mloader.mrecord.(batchRecorder); ok {
+		brd.SetValues(map[string]string{
+			opts.Name + ".SetupVer":  setupVer,
+			opts.Name + ".SetupDate": setupDate,
+		})
+		return
+	}
+	mloader.mrecord.SetValue(opts.Name+".SetupVer", setupVer)
+	mloader.mrecord.SetValue(opts.Name+".SetupDate", setupDate)
 }
 
 // doReady 模块准备
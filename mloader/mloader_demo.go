@@ -59,3 +59,15 @@ func (jrd *jsonrecorder) GetValue(key string) string {
 func (jrd *jsonrecorder) SetValue(key string, value string) error {
 	return jrd.config.SetConfig(key, value)
 }
+
+// 批量写入配置, 只写入一次文件
+func (jrd *jsonrecorder) SetValues(values map[string]string) error {
+	return jrd.config.Update(func(tx *conftool.Tx) error {
+		for key, value := range values {
+			if err := tx.Set(key, value); nil != err {
+				return err
+			}
+		}
+		return nil
+	})
+}